@@ -0,0 +1,6 @@
+// Package api holds the protobuf sources of the Meterus services. The Go
+// packages meters/v1, subject/v1 and validation/v1 are generated from them
+// by go generate, which needs protoc, protoc-gen-go and protoc-gen-go-grpc.
+package api
+
+//go:generate protoc -I . --go_out=.. --go_opt=module=github.com/elliot14A/meterus-go --go-grpc_out=.. --go-grpc_opt=module=github.com/elliot14A/meterus-go v1/meter.proto v1/subject.proto proto/validation.proto
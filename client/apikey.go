@@ -0,0 +1,45 @@
+package client
+
+import (
+	"context"
+
+	validation "github.com/elliot14A/meterus-go/validation/v1"
+)
+
+// CreateApiKey issues a new API key. The returned secret is the key itself;
+// Meterus does not store it, so it cannot be retrieved again later.
+func (v *ValidationService) CreateApiKey(ctx context.Context, req *validation.CreateApiKeyRequest) (*validation.ApiKey, string, error) {
+	ctx = AddApiKeyAuthorizationHeader(ctx, v.apiKey)
+	res, err := v.client.CreateApiKey(ctx, req)
+	if err != nil {
+		return nil, "", wrapError("CreateApiKey", err)
+	}
+	return res.ApiKey, res.Secret, nil
+}
+
+// ListApiKeys retrieves a page of API keys, optionally restricted to the keys
+// of one subject. Secrets are never included.
+func (v *ValidationService) ListApiKeys(ctx context.Context, req *validation.ListApiKeysRequest) (*validation.ListApiKeysResponse, error) {
+	ctx = AddApiKeyAuthorizationHeader(ctx, v.apiKey)
+	res, err := v.client.ListApiKeys(ctx, req)
+	return res, wrapError("ListApiKeys", err)
+}
+
+// RevokeApiKey revokes an API key so that it no longer validates.
+func (v *ValidationService) RevokeApiKey(ctx context.Context, id string) error {
+	ctx = AddApiKeyAuthorizationHeader(ctx, v.apiKey)
+	_, err := v.client.RevokeApiKey(ctx, &validation.ApiKeyId{ApiKeyId: id})
+	return wrapError("RevokeApiKey", err)
+}
+
+// RotateApiKey issues a new secret for an API key, keeping its subject and
+// scopes. The previous secret stays valid for the grace period of the request,
+// if any. Like CreateApiKey, this is the only time the new secret is returned.
+func (v *ValidationService) RotateApiKey(ctx context.Context, req *validation.RotateApiKeyRequest) (*validation.ApiKey, string, error) {
+	ctx = AddApiKeyAuthorizationHeader(ctx, v.apiKey)
+	res, err := v.client.RotateApiKey(ctx, req)
+	if err != nil {
+		return nil, "", wrapError("RotateApiKey", err)
+	}
+	return res.ApiKey, res.Secret, nil
+}
@@ -0,0 +1,125 @@
+package client_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elliot14A/meterus-go/meterustest"
+	validation "github.com/elliot14A/meterus-go/validation/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestApiKeyLifecycle(t *testing.T) {
+	clock := meterustest.NewClock(time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC))
+	srv, _ := newServer(t, meterustest.WithClock(clock.Now))
+	c := newClient(t, srv)
+	keys := c.NewValidationService()
+	ctx := context.Background()
+
+	key, secret, err := keys.CreateApiKey(ctx, &validation.CreateApiKeyRequest{
+		Name:    "billing",
+		Subject: "acme",
+		Scopes:  []string{"meters:write"},
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, secret)
+	assert.NotEmpty(t, key.Id)
+	assert.Equal(t, "billing", key.Name)
+	assert.Equal(t, "acme", key.Subject)
+	assert.Equal(t, []string{"meters:write"}, key.Scopes)
+	assert.True(t, strings.HasPrefix(secret, key.Prefix) && key.Prefix != secret, "keys must show a prefix of their secret only")
+	assert.True(t, key.CreatedAt.AsTime().Equal(clock.Now()))
+
+	res, err := keys.ValidateApiKey(ctx, secret, []string{"meters:write"})
+	require.NoError(t, err)
+	assert.True(t, res.Valid)
+	assert.Equal(t, "acme", res.Subject)
+
+	other, _, err := keys.CreateApiKey(ctx, &validation.CreateApiKeyRequest{Subject: "globex"})
+	require.NoError(t, err)
+
+	list, err := keys.ListApiKeys(ctx, &validation.ListApiKeysRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, uint32(2), list.Total)
+	require.Len(t, list.ApiKeys, 2)
+	assert.Equal(t, key.Id, list.ApiKeys[0].Id)
+	assert.Equal(t, other.Id, list.ApiKeys[1].Id)
+	b, err := protojson.Marshal(list)
+	require.NoError(t, err)
+	assert.NotContains(t, string(b), secret, "listing must never return secrets")
+
+	list, err = keys.ListApiKeys(ctx, &validation.ListApiKeysRequest{Subject: "globex"})
+	require.NoError(t, err)
+	require.Len(t, list.ApiKeys, 1)
+	assert.Equal(t, other.Id, list.ApiKeys[0].Id)
+
+	require.NoError(t, keys.RevokeApiKey(ctx, key.Id))
+	require.NoError(t, keys.RevokeApiKey(ctx, key.Id), "revoking must be idempotent")
+	res, err = keys.ValidateApiKey(ctx, secret, nil)
+	require.NoError(t, err)
+	assert.False(t, res.Valid, "revoked keys must not validate")
+
+	list, err = keys.ListApiKeys(ctx, &validation.ListApiKeysRequest{})
+	require.NoError(t, err)
+	require.Len(t, list.ApiKeys, 1, "revoked keys are hidden by default")
+	list, err = keys.ListApiKeys(ctx, &validation.ListApiKeysRequest{IncludeRevoked: true})
+	require.NoError(t, err)
+	require.Len(t, list.ApiKeys, 2)
+	assert.NotNil(t, list.ApiKeys[0].RevokedAt)
+
+	err = keys.RevokeApiKey(ctx, "unknown")
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, _, err = keys.RotateApiKey(ctx, &validation.RotateApiKeyRequest{ApiKeyId: key.Id})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err), "revoked keys cannot be rotated")
+}
+
+func TestApiKeyRotationGracePeriod(t *testing.T) {
+	clock := meterustest.NewClock(time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC))
+	srv, _ := newServer(t, meterustest.WithClock(clock.Now))
+	c := newClient(t, srv)
+	keys := c.NewValidationService()
+	ctx := context.Background()
+
+	key, oldSecret, err := keys.CreateApiKey(ctx, &validation.CreateApiKeyRequest{Subject: "acme", Scopes: []string{"meters:read"}})
+	require.NoError(t, err)
+
+	rotated, newSecret, err := keys.RotateApiKey(ctx, &validation.RotateApiKeyRequest{
+		ApiKeyId:    key.Id,
+		GracePeriod: durationpb.New(time.Hour),
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, newSecret)
+	assert.NotEqual(t, oldSecret, newSecret)
+	assert.Equal(t, key.Id, rotated.Id)
+	assert.Equal(t, key.Subject, rotated.Subject)
+	assert.Equal(t, key.Scopes, rotated.Scopes)
+	assert.True(t, strings.HasPrefix(newSecret, rotated.Prefix))
+
+	valid := func(secret string) bool {
+		t.Helper()
+		res, err := keys.ValidateApiKey(ctx, secret, []string{"meters:read"})
+		require.NoError(t, err)
+		return res.Valid
+	}
+	assert.True(t, valid(newSecret))
+	assert.True(t, valid(oldSecret), "the old secret must stay valid during the grace period")
+
+	clock.Advance(time.Hour)
+	assert.True(t, valid(newSecret))
+	assert.False(t, valid(oldSecret), "the old secret must expire with the grace period")
+
+	_, newest, err := keys.RotateApiKey(ctx, &validation.RotateApiKeyRequest{ApiKeyId: key.Id})
+	require.NoError(t, err)
+	assert.True(t, valid(newest))
+	assert.False(t, valid(newSecret), "rotating without a grace period must invalidate the secret at once")
+
+	_, _, err = keys.RotateApiKey(ctx, &validation.RotateApiKeyRequest{ApiKeyId: "unknown"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
@@ -0,0 +1,491 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	meter "github.com/elliot14A/meterus-go/meters/v1"
+	subject "github.com/elliot14A/meterus-go/subject/v1"
+	validation "github.com/elliot14A/meterus-go/validation/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// BalancingPolicy selects the endpoint a call is sent to.
+type BalancingPolicy int
+
+const (
+	// RoundRobin spreads calls evenly over the healthy endpoints.
+	RoundRobin BalancingPolicy = iota
+	// PickFirst sends calls to the first healthy endpoint, in the order they
+	// were given, and fails over to the next one.
+	PickFirst
+)
+
+// dnsScheme prefixes endpoints whose host name is resolved to all of its
+// addresses, each becoming an endpoint.
+const dnsScheme = "dns:///"
+
+// BalancerOption configures a client created with NewBalancedMeterusClient.
+type BalancerOption func(*balancerConfig)
+
+type balancerConfig struct {
+	policy       BalancingPolicy
+	dialOpts     []grpc.DialOption
+	maxFailures  int
+	baseEjection time.Duration
+	maxEjection  time.Duration
+	sticky       bool
+	dnsRefresh   time.Duration
+	lookupHost   func(ctx context.Context, host string) ([]string, error)
+	now          func() time.Time
+}
+
+// WithBalancingPolicy sets the policy selecting the endpoint of each call. It
+// defaults to RoundRobin.
+func WithBalancingPolicy(policy BalancingPolicy) BalancerOption {
+	return func(c *balancerConfig) {
+		c.policy = policy
+	}
+}
+
+// WithEndpointDialOptions passes options to the gRPC connection of every
+// endpoint, such as transport credentials. Connections are insecure unless
+// credentials are given, and apply the default timeouts unless a
+// TimeoutPolicy is given with its DialOption.
+func WithEndpointDialOptions(opts ...grpc.DialOption) BalancerOption {
+	return func(c *balancerConfig) {
+		c.dialOpts = append(c.dialOpts, opts...)
+	}
+}
+
+// WithOutlierEjection ejects an endpoint after maxFailures consecutive calls
+// failed with Unavailable, DeadlineExceeded, Internal or Unknown. Calls ended
+// by the caller's context, including its deadline, do not count. The first
+// ejection lasts baseEjection and each following one twice as long as the
+// previous, up to ten times baseEjection, until a call succeeds. Ejected
+// endpoints receive no calls unless all endpoints are ejected. Ejection is
+// disabled by default.
+func WithOutlierEjection(maxFailures int, baseEjection time.Duration) BalancerOption {
+	return func(c *balancerConfig) {
+		c.maxFailures = maxFailures
+		c.baseEjection = baseEjection
+		c.maxEjection = 10 * baseEjection
+	}
+}
+
+// WithStickySubjects routes the calls concerning a subject to the same
+// endpoint while it is healthy, using rendezvous hashing. The subject of a call
+// is the one set with WithRoutingKey, or else the subject of its event,
+// subject ID or single QueryMeter subject.
+func WithStickySubjects() BalancerOption {
+	return func(c *balancerConfig) {
+		c.sticky = true
+	}
+}
+
+// WithDNSRefresh sets how often the host names of dns:/// endpoints are
+// resolved again. It defaults to 30 seconds.
+func WithDNSRefresh(interval time.Duration) BalancerOption {
+	return func(c *balancerConfig) {
+		if interval > 0 {
+			c.dnsRefresh = interval
+		}
+	}
+}
+
+// WithHostLookup sets the function resolving the host names of dns:///
+// endpoints. It defaults to net.DefaultResolver.LookupHost.
+func WithHostLookup(lookup func(ctx context.Context, host string) ([]string, error)) BalancerOption {
+	return func(c *balancerConfig) {
+		c.lookupHost = lookup
+	}
+}
+
+type routingKeyContextKey struct{}
+
+// WithRoutingKey returns a context routing the calls made with it by key,
+// rather than by the subject of the request, on a client created with
+// WithStickySubjects.
+func WithRoutingKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, routingKeyContextKey{}, key)
+}
+
+// NewBalancedMeterusClient creates a new MeterusClient that spreads calls over
+// several Meterus endpoints and fails over between them. An endpoint is a
+// host:port address, or dns:///host:port to use every address the host name
+// resolves to, kept up to date as it changes. A call to an idempotent method
+// failing with Unavailable is retried on another endpoint. Calls that may
+// have taken effect, such as Ingest, CreateMeter and ValidateAndMeter, are
+// not: their error is returned.
+func NewBalancedMeterusClient(endpoints []string, apiKey string, opts ...BalancerOption) (*Client, error) {
+	if len(endpoints) == 0 {
+		return nil, errors.New("failed to create balanced client: no endpoints")
+	}
+	cfg := balancerConfig{
+		dnsRefresh: 30 * time.Second,
+		lookupHost: net.DefaultResolver.LookupHost,
+		now:        time.Now,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	cfg.dialOpts = withDefaultTimeouts(cfg.dialOpts)
+	b := &balancedConn{
+		cfg:      cfg,
+		targets:  slices.Clone(endpoints),
+		resolved: make(map[string][]string),
+		conns:    make(map[string]*endpoint),
+		stop:     make(chan struct{}),
+	}
+	if err := b.resolve(context.Background()); err != nil {
+		b.Close()
+		return nil, err
+	}
+	if slices.ContainsFunc(endpoints, isDNSEndpoint) {
+		b.wg.Add(1)
+		go b.refresh()
+	}
+	return &Client{conn: b, apiKey: apiKey}, nil
+}
+
+// EndpointStatus describes an endpoint of a balanced client.
+type EndpointStatus struct {
+	Address string
+	// Ejected reports whether the endpoint is ejected, until EjectedUntil.
+	Ejected      bool
+	EjectedUntil time.Time
+	// ConsecutiveFailures counts the failed calls since the last success.
+	ConsecutiveFailures int
+	// Calls counts the calls sent to the endpoint.
+	Calls uint64
+}
+
+// Endpoints returns the status of the endpoints of a client created with
+// NewBalancedMeterusClient, in the order they are tried by PickFirst. It
+// returns nil for other clients.
+func (c *Client) Endpoints() []EndpointStatus {
+	b, ok := c.conn.(*balancedConn)
+	if !ok {
+		return nil
+	}
+	return b.status()
+}
+
+// balancedConn sends calls to one of several endpoints.
+type balancedConn struct {
+	cfg     balancerConfig
+	targets []string
+	next    atomic.Uint64
+
+	mu        sync.RWMutex
+	endpoints []*endpoint
+	conns     map[string]*endpoint
+	// resolved holds the addresses last resolved for each dns:/// target.
+	resolved map[string][]string
+
+	stop      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// endpoint is a connection to one address and its health.
+type endpoint struct {
+	addr  string
+	conn  *grpc.ClientConn
+	calls atomic.Uint64
+
+	mu           sync.Mutex
+	failures     int
+	ejections    int
+	ejectedUntil time.Time
+}
+
+func isDNSEndpoint(target string) bool {
+	return strings.HasPrefix(target, dnsScheme)
+}
+
+// resolve updates the endpoints from the targets, connecting to new addresses
+// and closing connections to addresses that are gone. A host name that fails
+// to resolve keeps the addresses it last resolved to.
+func (b *balancedConn) resolve(ctx context.Context) error {
+	var addrs []string
+	resolved := make(map[string][]string)
+	for _, target := range b.targets {
+		if !isDNSEndpoint(target) {
+			addrs = append(addrs, target)
+			continue
+		}
+		host, port, err := net.SplitHostPort(strings.TrimPrefix(target, dnsScheme))
+		if err != nil {
+			return fmt.Errorf("failed to parse endpoint %s: %w", target, err)
+		}
+		hosts, err := b.cfg.lookupHost(ctx, host)
+		if err != nil {
+			b.mu.RLock()
+			last, ok := b.resolved[target]
+			b.mu.RUnlock()
+			if !ok {
+				return fmt.Errorf("failed to resolve endpoint %s: %w", target, err)
+			}
+			resolved[target] = last
+			addrs = append(addrs, last...)
+			continue
+		}
+		sort.Strings(hosts)
+		for _, h := range hosts {
+			resolved[target] = append(resolved[target], "passthrough:///"+net.JoinHostPort(h, port))
+		}
+		addrs = append(addrs, resolved[target]...)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var endpoints []*endpoint
+	seen := make(map[string]bool)
+	for _, addr := range addrs {
+		if seen[addr] {
+			continue
+		}
+		seen[addr] = true
+		e, ok := b.conns[addr]
+		if !ok {
+			opts := append([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}, b.cfg.dialOpts...)
+			conn, err := grpc.NewClient(addr, opts...)
+			if err != nil {
+				return fmt.Errorf("failed to create connection to %s: %w", addr, err)
+			}
+			e = &endpoint{addr: addr, conn: conn}
+			b.conns[addr] = e
+		}
+		endpoints = append(endpoints, e)
+	}
+	for addr, e := range b.conns {
+		if !seen[addr] {
+			e.conn.Close()
+			delete(b.conns, addr)
+		}
+	}
+	b.endpoints = endpoints
+	b.resolved = resolved
+	return nil
+}
+
+func (b *balancedConn) refresh() {
+	defer b.wg.Done()
+	ticker := time.NewTicker(b.cfg.dnsRefresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), b.cfg.dnsRefresh)
+			_ = b.resolve(ctx)
+			cancel()
+		}
+	}
+}
+
+// Close stops resolving endpoints and closes their connections.
+func (b *balancedConn) Close() error {
+	b.closeOnce.Do(func() { close(b.stop) })
+	b.wg.Wait()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var errs []error
+	for _, e := range b.conns {
+		errs = append(errs, e.conn.Close())
+	}
+	b.conns = nil
+	b.endpoints = nil
+	return errors.Join(errs...)
+}
+
+// idempotentMethods are the methods that can safely be sent again after a
+// call that may have reached Meterus failed.
+var idempotentMethods = map[string]bool{
+	meter.MeteringService_ListMeters_FullMethodName:            true,
+	meter.MeteringService_GetMeter_FullMethodName:              true,
+	meter.MeteringService_DeleteMeter_FullMethodName:           true,
+	meter.MeteringService_QueryMeter_FullMethodName:            true,
+	meter.MeteringService_ListMeterSubjects_FullMethodName:     true,
+	subject.SubjectService_ListSubjects_FullMethodName:         true,
+	subject.SubjectService_GetSubject_FullMethodName:           true,
+	subject.SubjectService_UpdateSubject_FullMethodName:        true,
+	subject.SubjectService_DeleteSubject_FullMethodName:        true,
+	validation.ValidationService_ValidateApiKey_FullMethodName: true,
+	validation.ValidationService_ListApiKeys_FullMethodName:    true,
+	validation.ValidationService_RevokeApiKey_FullMethodName:   true,
+}
+
+// Invoke sends the call to an endpoint picked by the policy, and retries calls
+// to idempotent methods on the next one while they fail with Unavailable.
+func (b *balancedConn) Invoke(ctx context.Context, method string, args, reply any, opts ...grpc.CallOption) error {
+	candidates := b.candidates(ctx, args)
+	if len(candidates) == 0 {
+		return status.Error(codes.Unavailable, "no endpoints")
+	}
+	if !idempotentMethods[method] {
+		candidates = candidates[:1]
+	}
+	var err error
+	for _, e := range candidates {
+		e.calls.Add(1)
+		err = e.conn.Invoke(ctx, method, args, reply, opts...)
+		b.observe(ctx, e, err)
+		if status.Code(err) != codes.Unavailable || ctx.Err() != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// NewStream opens the stream on the endpoint picked by the policy, without
+// failing over.
+func (b *balancedConn) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	candidates := b.candidates(ctx, nil)
+	if len(candidates) == 0 {
+		return nil, status.Error(codes.Unavailable, "no endpoints")
+	}
+	candidates[0].calls.Add(1)
+	return candidates[0].conn.NewStream(ctx, desc, method, opts...)
+}
+
+// candidates returns the endpoints to try for a call, in order: the healthy
+// ones ordered by the policy, then the ejected ones if all are ejected.
+func (b *balancedConn) candidates(ctx context.Context, req any) []*endpoint {
+	b.mu.RLock()
+	all := slices.Clone(b.endpoints)
+	b.mu.RUnlock()
+
+	now := b.cfg.now()
+	healthy := slices.DeleteFunc(slices.Clone(all), func(e *endpoint) bool {
+		return e.ejected(now)
+	})
+	if len(healthy) == 0 {
+		healthy = all
+	}
+	if len(healthy) == 0 {
+		return nil
+	}
+
+	if b.cfg.sticky {
+		if key := routingKey(ctx, req); key != "" {
+			return rendezvous(healthy, key)
+		}
+	}
+	if b.cfg.policy == RoundRobin {
+		start := int(b.next.Add(1)-1) % len(healthy)
+		rotated := make([]*endpoint, 0, len(healthy))
+		rotated = append(rotated, healthy[start:]...)
+		return append(rotated, healthy[:start]...)
+	}
+	return healthy
+}
+
+// observe updates the health of e after a call with ctx that returned err.
+// Calls ended by their own context, such as by the caller's deadline, say
+// nothing about the endpoint and are ignored.
+func (b *balancedConn) observe(ctx context.Context, e *endpoint, err error) {
+	if b.cfg.maxFailures <= 0 || ctx.Err() != nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Internal, codes.Unknown:
+	default:
+		e.failures = 0
+		e.ejections = 0
+		return
+	}
+	e.failures++
+	if e.failures < b.cfg.maxFailures {
+		return
+	}
+	d := b.cfg.baseEjection << e.ejections
+	if d > b.cfg.maxEjection || d <= 0 {
+		d = b.cfg.maxEjection
+	}
+	e.ejections++
+	e.failures = 0
+	e.ejectedUntil = b.cfg.now().Add(d)
+}
+
+func (e *endpoint) ejected(now time.Time) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return now.Before(e.ejectedUntil)
+}
+
+func (b *balancedConn) status() []EndpointStatus {
+	b.mu.RLock()
+	endpoints := slices.Clone(b.endpoints)
+	b.mu.RUnlock()
+	now := b.cfg.now()
+	statuses := make([]EndpointStatus, len(endpoints))
+	for i, e := range endpoints {
+		e.mu.Lock()
+		statuses[i] = EndpointStatus{
+			Address:             strings.TrimPrefix(e.addr, "passthrough:///"),
+			Ejected:             now.Before(e.ejectedUntil),
+			EjectedUntil:        e.ejectedUntil,
+			ConsecutiveFailures: e.failures,
+			Calls:               e.calls.Load(),
+		}
+		e.mu.Unlock()
+	}
+	return statuses
+}
+
+// routingKey returns the key a call is routed by with sticky subjects.
+func routingKey(ctx context.Context, req any) string {
+	if key, ok := ctx.Value(routingKeyContextKey{}).(string); ok {
+		return key
+	}
+	switch r := req.(type) {
+	case *meter.CloudEvent:
+		return r.GetSubject()
+	case *meter.QueryMeterRequest:
+		if len(r.GetSubject()) == 1 {
+			return r.GetSubject()[0]
+		}
+	case *validation.ValidateAndMeterRequest:
+		return r.GetEvent().GetSubject()
+	case *subject.Subject:
+		return r.GetId()
+	case *subject.SubjectId:
+		return r.GetSubjectId()
+	}
+	return ""
+}
+
+// rendezvous orders endpoints by their highest random weight for key, so that
+// a key keeps its endpoint while that endpoint is healthy.
+func rendezvous(endpoints []*endpoint, key string) []*endpoint {
+	weights := make(map[*endpoint]uint64, len(endpoints))
+	for _, e := range endpoints {
+		h := fnv.New64a()
+		h.Write([]byte(e.addr))
+		h.Write([]byte{0})
+		h.Write([]byte(key))
+		weights[e] = h.Sum64()
+	}
+	sorted := slices.Clone(endpoints)
+	sort.Slice(sorted, func(i, j int) bool {
+		return weights[sorted[i]] > weights[sorted[j]]
+	})
+	return sorted
+}
@@ -0,0 +1,236 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elliot14A/meterus-go/client"
+	"github.com/elliot14A/meterus-go/meterustest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func balancedClient(t *testing.T, endpoints []string, opts ...client.BalancerOption) *client.Client {
+	t.Helper()
+	c, err := client.NewBalancedMeterusClient(endpoints, "key", opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func ingest(t *testing.T, ctx context.Context, m *client.MeteringService, subject string) error {
+	t.Helper()
+	return m.Ingest(ctx, newEvent(t, "", subject, time.Now(), nil))
+}
+
+func TestBalancerRoundRobinSpreadsCalls(t *testing.T) {
+	servers := make([]*meterustest.Server, 3)
+	addrs := make([]string, len(servers))
+	for i := range servers {
+		servers[i], _ = newServer(t)
+		addrs[i] = servers[i].ServeLoopback()
+	}
+	c := balancedClient(t, addrs)
+	m := c.NewMeteringService()
+
+	for i := 0; i < 30; i++ {
+		require.NoError(t, ingest(t, context.Background(), m, "acme"))
+	}
+	for i, srv := range servers {
+		assert.Len(t, srv.Events(), 10, "server %d", i)
+	}
+	for _, e := range c.Endpoints() {
+		assert.Equal(t, uint64(10), e.Calls, e.Address)
+	}
+}
+
+func TestBalancerPickFirstFailsOver(t *testing.T) {
+	primary, faults := newServer(t)
+	backup, _ := newServer(t)
+	c := balancedClient(t, []string{primary.ServeLoopback(), backup.ServeLoopback()}, client.WithBalancingPolicy(client.PickFirst))
+	m := c.NewMeteringService()
+	calls := func() []uint64 {
+		var calls []uint64
+		for _, e := range c.Endpoints() {
+			calls = append(calls, e.Calls)
+		}
+		return calls
+	}
+
+	_, err := m.ListMeters(context.Background(), 10, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{1, 0}, calls())
+
+	faults.Add(meterustest.FaultRule{Method: "ListMeters", Code: codes.Unavailable})
+	_, err = m.ListMeters(context.Background(), 10, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{2, 1}, calls(), "calls failing with Unavailable must fail over")
+
+	faults.Reset()
+	_, err = m.ListMeters(context.Background(), 10, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{3, 1}, calls(), "the first endpoint must be used again once it recovers")
+}
+
+func TestBalancerDoesNotRetryNonIdempotentCalls(t *testing.T) {
+	primary, faults := newServer(t)
+	backup, _ := newServer(t)
+	c := balancedClient(t, []string{primary.ServeLoopback(), backup.ServeLoopback()}, client.WithBalancingPolicy(client.PickFirst))
+	m := c.NewMeteringService()
+
+	faults.Add(meterustest.FaultRule{Method: "Ingest", Code: codes.Unavailable})
+	err := ingest(t, context.Background(), m, "acme")
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Empty(t, backup.Events(), "events must not be sent twice")
+	assert.Zero(t, c.Endpoints()[1].Calls)
+}
+
+func TestBalancerEjectsWithBackoff(t *testing.T) {
+	const base = 100 * time.Millisecond
+	primary, faults := newServer(t)
+	backup, _ := newServer(t)
+	c := balancedClient(t, []string{primary.ServeLoopback(), backup.ServeLoopback()},
+		client.WithBalancingPolicy(client.PickFirst),
+		client.WithOutlierEjection(2, base))
+	m := c.NewMeteringService()
+	faults.Add(meterustest.FaultRule{Method: "ListMeters", Code: codes.Unavailable})
+	list := func() {
+		t.Helper()
+		_, err := m.ListMeters(context.Background(), 10, 1)
+		require.NoError(t, err)
+	}
+
+	// ejectionAfter fails over from the first endpoint until it is ejected,
+	// and returns how long the ejection lasts.
+	ejectionAfter := func() time.Duration {
+		t.Helper()
+		list()
+		assert.False(t, c.Endpoints()[0].Ejected)
+		start := time.Now()
+		list()
+		status := c.Endpoints()[0]
+		require.True(t, status.Ejected, "the endpoint must be ejected after two failures")
+		return status.EjectedUntil.Sub(start)
+	}
+
+	first := ejectionAfter()
+	assert.InDelta(t, base, first, float64(base)/2)
+	calls := c.Endpoints()[0].Calls
+	list()
+	assert.Equal(t, calls, c.Endpoints()[0].Calls, "ejected endpoints must receive no calls")
+
+	time.Sleep(first)
+	second := ejectionAfter()
+	assert.InDelta(t, 2*base, second, float64(base)/2, "each ejection must last twice as long as the previous one")
+	assert.Equal(t, uint64(5), c.Endpoints()[1].Calls)
+}
+
+func TestBalancerIgnoresCallerDeadlines(t *testing.T) {
+	srv, faults := newServer(t)
+	c := balancedClient(t, []string{srv.ServeLoopback()}, client.WithOutlierEjection(1, time.Minute))
+	m := c.NewMeteringService()
+	faults.Add(meterustest.FaultRule{Method: "Ingest", Latency: time.Second})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := ingest(t, ctx, m, "acme")
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	status := c.Endpoints()[0]
+	assert.False(t, status.Ejected, "a call timed out by its caller must not eject the endpoint")
+	assert.Zero(t, status.ConsecutiveFailures)
+}
+
+func TestBalancerRefreshesDNS(t *testing.T) {
+	srv, _ := newServer(t)
+	_, port, err := net.SplitHostPort(srv.ServeLoopback())
+	require.NoError(t, err)
+
+	var (
+		mu    sync.Mutex
+		hosts = []string{"127.0.0.1"}
+		fail  bool
+	)
+	setHosts := func(h []string, f bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		hosts, fail = h, f
+	}
+	lookup := func(_ context.Context, host string) ([]string, error) {
+		assert.Equal(t, "meterus.test", host)
+		mu.Lock()
+		defer mu.Unlock()
+		if fail {
+			return nil, errors.New("lookup failed")
+		}
+		return hosts, nil
+	}
+	c := balancedClient(t, []string{"dns:///meterus.test:" + port},
+		client.WithHostLookup(lookup),
+		client.WithDNSRefresh(10*time.Millisecond))
+	addresses := func() []string {
+		var addrs []string
+		for _, e := range c.Endpoints() {
+			addrs = append(addrs, e.Address)
+		}
+		return addrs
+	}
+	first, second := net.JoinHostPort("127.0.0.1", port), net.JoinHostPort("127.0.0.2", port)
+	assert.Equal(t, []string{first}, addresses())
+
+	setHosts([]string{"127.0.0.2", "127.0.0.1"}, false)
+	assert.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]string{first, second}, addresses())
+	}, time.Second, 5*time.Millisecond, "new addresses must be picked up")
+
+	setHosts(nil, true)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, []string{first, second}, addresses(), "a failed lookup must keep the last addresses")
+
+	setHosts([]string{"127.0.0.1"}, false)
+	assert.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]string{first}, addresses())
+	}, time.Second, 5*time.Millisecond, "removed addresses must be dropped")
+	require.NoError(t, ingest(t, context.Background(), c.NewMeteringService(), "acme"))
+}
+
+func TestBalancerStickySubjects(t *testing.T) {
+	servers := make([]*meterustest.Server, 3)
+	addrs := make([]string, len(servers))
+	for i := range servers {
+		servers[i], _ = newServer(t)
+		addrs[i] = servers[i].ServeLoopback()
+	}
+	c := balancedClient(t, addrs, client.WithStickySubjects())
+	m := c.NewMeteringService()
+
+	subjects := []string{"acme", "globex", "initech", "umbrella", "hooli", "soylent"}
+	for i := 0; i < 5; i++ {
+		for _, s := range subjects {
+			require.NoError(t, ingest(t, context.Background(), m, s))
+		}
+	}
+	home := make(map[string]int)
+	for i, srv := range servers {
+		for _, e := range srv.Events() {
+			if prev, ok := home[e.Subject]; ok {
+				assert.Equal(t, prev, i, "events of %s must go to one endpoint", e.Subject)
+			}
+			home[e.Subject] = i
+		}
+	}
+	assert.Len(t, home, len(subjects))
+
+	// A routing key overrides the subject of the event.
+	ctx := client.WithRoutingKey(context.Background(), "acme")
+	before := len(servers[home["acme"]].Events())
+	for _, s := range subjects {
+		require.NoError(t, ingest(t, ctx, m, s))
+	}
+	assert.Len(t, servers[home["acme"]].Events(), before+len(subjects))
+}
@@ -0,0 +1,346 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrCircuitOpen is reported for calls rejected by an open CircuitBreaker.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// BreakerState is the state of the circuit of a method.
+type BreakerState int
+
+const (
+	// BreakerClosed lets calls through.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen rejects calls until the cool-down has elapsed.
+	BreakerOpen
+	// BreakerHalfOpen lets a limited number of probe calls through to decide
+	// whether to close the circuit again.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// BreakerStats describes the circuit of a method.
+type BreakerStats struct {
+	State BreakerState
+	// Since is when the circuit entered its state.
+	Since time.Time
+	// ConsecutiveFailures counts the failed calls since the last success.
+	ConsecutiveFailures int
+	// Successes, Failures and Rejected count the calls that succeeded,
+	// failed and were rejected by the open circuit.
+	Successes uint64
+	Failures  uint64
+	Rejected  uint64
+}
+
+// Fallback handles a call that was rejected by an open circuit or failed. It
+// receives the call's request and reply and the error, which wraps
+// ErrCircuitOpen for rejected calls, and returns the error of the call: nil to
+// report success with reply as filled in by the fallback.
+type Fallback func(ctx context.Context, method string, req, reply any, err error) error
+
+// CircuitBreaker stops calling a method of Meterus while it keeps failing, so
+// that callers fail fast instead of piling up on timeouts. Each method has its
+// own circuit. A circuit opens after a number of consecutive failures, rejects
+// calls during a cool-down, then lets probe calls through while half-open and
+// closes once they succeed. It is safe for concurrent use; install it on a
+// client with its UnaryClientInterceptor:
+//
+//	breaker := client.NewCircuitBreaker(client.WithFailureThreshold(3))
+//	c, err := client.NewMeterusClient(addr, apiKey, grpc.WithChainUnaryInterceptor(breaker.UnaryClientInterceptor()))
+type CircuitBreaker struct {
+	now           func() time.Time
+	threshold     int
+	coolDown      time.Duration
+	probes        int
+	isFailure     func(error) bool
+	fallback      Fallback
+	onStateChange func(method string, from, to BreakerState)
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+// circuit is the state of the circuit of a method.
+type circuit struct {
+	BreakerStats
+	// inFlight and succeeded count the probe calls let through and
+	// succeeded while half-open.
+	inFlight  int
+	succeeded int
+	// generation counts the state changes, so that calls admitted before
+	// one do not act on the new state.
+	generation uint64
+}
+
+// admission is a call let through by the circuit of its method.
+type admission struct {
+	method string
+	// generation is the generation of the circuit when the call was let
+	// through.
+	generation uint64
+	// probe reports whether the call took a probe slot of the half-open
+	// circuit.
+	probe bool
+}
+
+// BreakerOption configures a CircuitBreaker.
+type BreakerOption func(*CircuitBreaker)
+
+// WithFailureThreshold sets how many consecutive failures open the circuit of
+// a method. It defaults to 5.
+func WithFailureThreshold(n int) BreakerOption {
+	return func(b *CircuitBreaker) {
+		if n > 0 {
+			b.threshold = n
+		}
+	}
+}
+
+// WithCoolDown sets how long an open circuit rejects calls before letting
+// probe calls through. It defaults to 30 seconds.
+func WithCoolDown(d time.Duration) BreakerOption {
+	return func(b *CircuitBreaker) {
+		b.coolDown = d
+	}
+}
+
+// WithHalfOpenProbes sets how many probe calls a half-open circuit lets
+// through, all of which must succeed to close it. It defaults to 1.
+func WithHalfOpenProbes(n int) BreakerOption {
+	return func(b *CircuitBreaker) {
+		if n > 0 {
+			b.probes = n
+		}
+	}
+}
+
+// WithFailurePredicate sets which errors count as failures. By default,
+// Unavailable, DeadlineExceeded, Internal and Unknown errors do; errors caused
+// by the request, such as InvalidArgument or NotFound, do not, and neither do
+// ResourceExhausted errors, which a RateLimiter also reports for calls it
+// throttles locally.
+func WithFailurePredicate(isFailure func(error) bool) BreakerOption {
+	return func(b *CircuitBreaker) {
+		b.isFailure = isFailure
+	}
+}
+
+// WithFallback sets a function handling the calls rejected by an open circuit
+// and the calls failing, such as one writing events to local storage to send
+// later.
+func WithFallback(fallback Fallback) BreakerOption {
+	return func(b *CircuitBreaker) {
+		b.fallback = fallback
+	}
+}
+
+// WithStateChangeHandler registers a function called with the full method
+// name whenever the circuit of a method changes state. It is called
+// synchronously, without the breaker locked.
+func WithStateChangeHandler(fn func(method string, from, to BreakerState)) BreakerOption {
+	return func(b *CircuitBreaker) {
+		b.onStateChange = fn
+	}
+}
+
+// NewCircuitBreaker returns a CircuitBreaker with all circuits closed.
+func NewCircuitBreaker(opts ...BreakerOption) *CircuitBreaker {
+	b := &CircuitBreaker{
+		now:       time.Now,
+		threshold: 5,
+		coolDown:  30 * time.Second,
+		probes:    1,
+		isFailure: isBreakerFailure,
+		circuits:  make(map[string]*circuit),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+func isBreakerFailure(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Internal, codes.Unknown:
+		return true
+	}
+	return false
+}
+
+// UnaryClientInterceptor returns an interceptor guarding unary calls with the
+// circuit of their method. Rejected calls fail with a *Error with code
+// Unavailable wrapping ErrCircuitOpen, unless a fallback handles them. Calls
+// canceled or timed out by their own context are not recorded.
+func (b *CircuitBreaker) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		a, ok := b.admit(method)
+		if !ok {
+			err := error(newError(bareMethod(method), codes.Unavailable, ErrCircuitOpen))
+			if b.fallback != nil {
+				return b.fallback(ctx, method, req, reply, err)
+			}
+			return err
+		}
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		if status.Code(err) == codes.Canceled || ctx.Err() != nil {
+			// The caller gave up, which says nothing about the method.
+			b.release(a)
+			return err
+		}
+		failed := err != nil && b.isFailure(err)
+		b.record(a, failed)
+		if failed && b.fallback != nil {
+			return b.fallback(ctx, method, req, reply, err)
+		}
+		return err
+	}
+}
+
+// State returns the state of the circuit of the full method name.
+func (b *CircuitBreaker) State(method string) BreakerState {
+	return b.Stats()[method].State
+}
+
+// Stats returns the circuits of the methods called so far, by full method
+// name.
+func (b *CircuitBreaker) Stats() map[string]BreakerStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	stats := make(map[string]BreakerStats, len(b.circuits))
+	for method, c := range b.circuits {
+		s := c.BreakerStats
+		if s.State == BreakerOpen && !now.Before(s.Since.Add(b.coolDown)) {
+			// The next call will probe the method.
+			s.State = BreakerHalfOpen
+			s.Since = s.Since.Add(b.coolDown)
+		}
+		stats[method] = s
+	}
+	return stats
+}
+
+// admit reports whether a call to method may go through, taking a probe slot
+// if the circuit is half-open, and returns the admission of the call.
+func (b *CircuitBreaker) admit(method string) (admission, bool) {
+	b.mu.Lock()
+	c := b.circuit(method)
+	now := b.now()
+	var change func()
+	if c.State == BreakerOpen && !now.Before(c.Since.Add(b.coolDown)) {
+		change = b.transition(method, c, BreakerHalfOpen, now)
+	}
+	a := admission{method: method, generation: c.generation}
+	allowed := true
+	switch c.State {
+	case BreakerOpen:
+		allowed = false
+	case BreakerHalfOpen:
+		allowed = c.inFlight < b.probes
+		if allowed {
+			c.inFlight++
+			a.probe = true
+		}
+	}
+	if !allowed {
+		c.Rejected++
+	}
+	b.mu.Unlock()
+	if change != nil {
+		change()
+	}
+	return a, allowed
+}
+
+// record updates the circuit of an admitted call with its outcome. Calls
+// admitted before the circuit last changed state are counted but do not
+// change it.
+func (b *CircuitBreaker) record(a admission, failed bool) {
+	b.mu.Lock()
+	c := b.circuit(a.method)
+	now := b.now()
+	current := a.generation == c.generation
+	var change func()
+	if failed {
+		c.Failures++
+		c.ConsecutiveFailures++
+		switch {
+		case !current:
+			// The circuit changed state since the call was admitted.
+		case a.probe:
+			change = b.transition(a.method, c, BreakerOpen, now)
+		case c.State == BreakerClosed && c.ConsecutiveFailures >= b.threshold:
+			change = b.transition(a.method, c, BreakerOpen, now)
+		}
+	} else {
+		c.Successes++
+		c.ConsecutiveFailures = 0
+		if current && a.probe {
+			c.succeeded++
+			if c.succeeded >= b.probes {
+				change = b.transition(a.method, c, BreakerClosed, now)
+			}
+		}
+	}
+	b.mu.Unlock()
+	if change != nil {
+		change()
+	}
+}
+
+// release frees the probe slot taken by an admitted call whose outcome is not
+// recorded, unless the circuit changed state since.
+func (b *CircuitBreaker) release(a admission) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if c := b.circuit(a.method); a.probe && a.generation == c.generation {
+		c.inFlight--
+	}
+}
+
+func (b *CircuitBreaker) circuit(method string) *circuit {
+	c, ok := b.circuits[method]
+	if !ok {
+		c = &circuit{BreakerStats: BreakerStats{State: BreakerClosed, Since: b.now()}}
+		b.circuits[method] = c
+	}
+	return c
+}
+
+// transition moves c to state and returns the call of the state change
+// handler, to be made once the breaker is unlocked.
+func (b *CircuitBreaker) transition(method string, c *circuit, state BreakerState, now time.Time) func() {
+	from := c.State
+	c.State = state
+	c.Since = now
+	c.inFlight = 0
+	c.succeeded = 0
+	c.generation++
+	if b.onStateChange == nil {
+		return nil
+	}
+	return func() {
+		b.onStateChange(method, from, state)
+	}
+}
@@ -0,0 +1,254 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elliot14A/meterus-go/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const breakerMethod = "/meterus.meter.v1.MeteringService/Ingest"
+
+// transitions records the state changes of a circuit breaker.
+type transitions struct {
+	mu      sync.Mutex
+	changes []string
+}
+
+func (tr *transitions) record(method string, from, to client.BreakerState) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.changes = append(tr.changes, method+": "+from.String()+" -> "+to.String())
+}
+
+func (tr *transitions) get() []string {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	return append([]string(nil), tr.changes...)
+}
+
+// failWith returns an invoker failing every call with err.
+func failWith(err error) grpc.UnaryInvoker {
+	return func(context.Context, string, any, any, *grpc.ClientConn, ...grpc.CallOption) error {
+		return err
+	}
+}
+
+func succeed(context.Context, string, any, any, *grpc.ClientConn, ...grpc.CallOption) error {
+	return nil
+}
+
+func call(b *client.CircuitBreaker, invoker grpc.UnaryInvoker) error {
+	return b.UnaryClientInterceptor()(context.Background(), breakerMethod, nil, nil, nil, invoker)
+}
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	var tr transitions
+	b := client.NewCircuitBreaker(
+		client.WithFailureThreshold(2),
+		client.WithCoolDown(50*time.Millisecond),
+		client.WithStateChangeHandler(tr.record))
+	unavailable := failWith(status.Error(codes.Unavailable, "down"))
+
+	assert.Error(t, call(b, unavailable))
+	assert.Equal(t, client.BreakerClosed, b.State(breakerMethod), "the circuit must stay closed below the threshold")
+	assert.Error(t, call(b, unavailable))
+	assert.Equal(t, client.BreakerOpen, b.State(breakerMethod))
+
+	err := call(b, succeed)
+	require.ErrorIs(t, err, client.ErrCircuitOpen, "an open circuit must reject calls")
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	var e *client.Error
+	require.True(t, errors.As(err, &e))
+	assert.Equal(t, "Ingest", e.Method)
+
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, client.BreakerHalfOpen, b.State(breakerMethod), "the circuit must half-open after the cool-down")
+	assert.Error(t, call(b, unavailable), "a failed probe must reopen the circuit")
+	assert.Equal(t, client.BreakerOpen, b.State(breakerMethod))
+
+	time.Sleep(60 * time.Millisecond)
+	require.NoError(t, call(b, succeed))
+	assert.Equal(t, client.BreakerClosed, b.State(breakerMethod), "a successful probe must close the circuit")
+
+	assert.Equal(t, []string{
+		breakerMethod + ": closed -> open",
+		breakerMethod + ": open -> half-open",
+		breakerMethod + ": half-open -> open",
+		breakerMethod + ": open -> half-open",
+		breakerMethod + ": half-open -> closed",
+	}, tr.get())
+
+	stats := b.Stats()[breakerMethod]
+	assert.Equal(t, uint64(1), stats.Successes)
+	assert.Equal(t, uint64(3), stats.Failures)
+	assert.Equal(t, uint64(1), stats.Rejected)
+	assert.Zero(t, stats.ConsecutiveFailures)
+}
+
+func TestCircuitBreakerLimitsHalfOpenProbes(t *testing.T) {
+	b := client.NewCircuitBreaker(
+		client.WithFailureThreshold(1),
+		client.WithCoolDown(10*time.Millisecond),
+		client.WithHalfOpenProbes(2))
+	assert.Error(t, call(b, failWith(status.Error(codes.Unavailable, "down"))))
+	time.Sleep(20 * time.Millisecond)
+
+	release := make(chan struct{})
+	started := make(chan struct{}, 2)
+	blocked := func(context.Context, string, any, any, *grpc.ClientConn, ...grpc.CallOption) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, call(b, blocked))
+		}()
+	}
+	<-started
+	<-started
+	assert.ErrorIs(t, call(b, succeed), client.ErrCircuitOpen, "calls beyond the probe limit must be rejected")
+	assert.Equal(t, client.BreakerHalfOpen, b.State(breakerMethod))
+
+	close(release)
+	wg.Wait()
+	assert.Equal(t, client.BreakerClosed, b.State(breakerMethod), "the circuit must close once all probes succeed")
+}
+
+func TestCircuitBreakerIgnoresCallsAdmittedBeforeStateChange(t *testing.T) {
+	b := client.NewCircuitBreaker(
+		client.WithFailureThreshold(1),
+		client.WithCoolDown(10*time.Millisecond))
+	interceptor := b.UnaryClientInterceptor()
+
+	// blocked returns an invoker blocking until release is closed, then
+	// returning err.
+	started := make(chan struct{}, 3)
+	blocked := func(release <-chan struct{}, err error) grpc.UnaryInvoker {
+		return func(ctx context.Context, _ string, _, _ any, _ *grpc.ClientConn, _ ...grpc.CallOption) error {
+			started <- struct{}{}
+			select {
+			case <-release:
+				return err
+			case <-ctx.Done():
+				return status.FromContextError(ctx.Err()).Err()
+			}
+		}
+	}
+	var wg sync.WaitGroup
+	slow, probe := make(chan struct{}), make(chan struct{})
+	canceledCtx, cancel := context.WithCancel(context.Background())
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		assert.NoError(t, call(b, blocked(slow, nil)))
+	}()
+	go func() {
+		defer wg.Done()
+		interceptor(canceledCtx, breakerMethod, nil, nil, nil, blocked(nil, nil))
+	}()
+	<-started
+	<-started
+
+	assert.Error(t, call(b, failWith(status.Error(codes.Unavailable, "down"))))
+	require.Equal(t, client.BreakerOpen, b.State(breakerMethod))
+	time.Sleep(20 * time.Millisecond)
+	go func() {
+		defer wg.Done()
+		assert.NoError(t, call(b, blocked(probe, nil)))
+	}()
+	<-started
+
+	close(slow)
+	cancel()
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, client.BreakerHalfOpen, b.State(breakerMethod), "calls admitted while closed must not close a half-open circuit")
+	assert.ErrorIs(t, call(b, succeed), client.ErrCircuitOpen, "calls admitted while closed must not free probe slots")
+
+	close(probe)
+	wg.Wait()
+	assert.Equal(t, client.BreakerClosed, b.State(breakerMethod), "the probe must close the circuit")
+}
+
+func TestCircuitBreakerFallback(t *testing.T) {
+	var handled []error
+	b := client.NewCircuitBreaker(
+		client.WithFailureThreshold(1),
+		client.WithCoolDown(time.Minute),
+		client.WithFallback(func(_ context.Context, method string, _, reply any, err error) error {
+			assert.Equal(t, breakerMethod, method)
+			handled = append(handled, err)
+			reply.(*wrapperspb.StringValue).Value = "fallback"
+			return nil
+		}))
+	interceptor := b.UnaryClientInterceptor()
+
+	err := interceptor(context.Background(), breakerMethod, nil, nil, nil, failWith(status.Error(codes.NotFound, "no meter")))
+	assert.Equal(t, codes.NotFound, status.Code(err), "errors that are not failures must not reach the fallback")
+
+	reply := &wrapperspb.StringValue{}
+	err = interceptor(context.Background(), breakerMethod, nil, reply, nil, failWith(status.Error(codes.Internal, "boom")))
+	require.NoError(t, err, "the fallback must handle failed calls")
+	assert.Equal(t, "fallback", reply.Value)
+
+	reply = &wrapperspb.StringValue{}
+	err = interceptor(context.Background(), breakerMethod, nil, reply, nil, succeed)
+	require.NoError(t, err, "the fallback must handle rejected calls")
+	assert.Equal(t, "fallback", reply.Value)
+
+	require.Len(t, handled, 2)
+	assert.Equal(t, codes.Internal, status.Code(handled[0]))
+	assert.ErrorIs(t, handled[1], client.ErrCircuitOpen)
+
+}
+
+func TestCircuitBreakerIgnoresCallsEndedByCaller(t *testing.T) {
+	b := client.NewCircuitBreaker(client.WithFailureThreshold(1))
+	interceptor := b.UnaryClientInterceptor()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := interceptor(ctx, breakerMethod, nil, nil, nil, failWith(status.Error(codes.Canceled, "canceled")))
+	assert.Equal(t, codes.Canceled, status.Code(err))
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+	err = interceptor(ctx, breakerMethod, nil, nil, nil, failWith(status.Error(codes.DeadlineExceeded, "deadline exceeded")))
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+
+	assert.Equal(t, client.BreakerClosed, b.State(breakerMethod), "calls ended by their caller must not open the circuit")
+	stats := b.Stats()[breakerMethod]
+	assert.Zero(t, stats.Failures)
+	assert.Zero(t, stats.ConsecutiveFailures)
+}
+
+func TestCircuitBreakerIgnoresLocalThrottling(t *testing.T) {
+	b := client.NewCircuitBreaker(client.WithFailureThreshold(1))
+	limiter := client.NewRateLimiter(client.WithMethodLimit("Ingest", client.RateLimit{Rate: 0.001, Burst: 1}), client.WithFailFast())
+	breaker, limit := b.UnaryClientInterceptor(), limiter.UnaryClientInterceptor()
+	invoke := func() error {
+		return breaker(context.Background(), breakerMethod, nil, nil, nil, func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			return limit(ctx, method, req, reply, cc, succeed, opts...)
+		})
+	}
+
+	require.NoError(t, invoke())
+	for i := 0; i < 3; i++ {
+		assert.ErrorIs(t, invoke(), client.ErrRateLimited)
+	}
+	assert.Equal(t, client.BreakerClosed, b.State(breakerMethod), "calls throttled by a rate limiter must not open the circuit")
+}
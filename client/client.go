@@ -4,9 +4,11 @@ import (
 	"context"
 	"crypto/tls"
 	"fmt"
+	"net/url"
 	"strings"
 	"time"
 
+	"github.com/elliot14A/meterus-go/connect"
 	meter "github.com/elliot14A/meterus-go/meters/v1"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
@@ -18,11 +20,20 @@ import (
 
 // Client represents a client for the Meterus service.
 type Client struct {
-	conn   *grpc.ClientConn
+	conn   clientConn
 	apiKey string
 }
 
+// clientConn is the connection of a Client: a gRPC connection or a
+// connect.Conn.
+type clientConn interface {
+	grpc.ClientConnInterface
+	Close() error
+}
+
 // NewMeterusClient creates a new MeterusClient with the given address and API key.
+// Calls made without a deadline get one from a TimeoutPolicy with the default
+// timeouts, unless opts install another policy with TimeoutPolicy.DialOption.
 func NewMeterusClient(addr, apiKey string, opts ...grpc.DialOption) (*Client, error) {
 	creds := insecure.NewCredentials()
 
@@ -31,7 +42,7 @@ func NewMeterusClient(addr, apiKey string, opts ...grpc.DialOption) (*Client, er
 			InsecureSkipVerify: false,
 		})
 	}
-	opts = append(opts,
+	opts = append(withDefaultTimeouts(opts),
 		grpc.WithTransportCredentials(creds),
 	)
 
@@ -46,6 +57,27 @@ func NewMeterusClient(addr, apiKey string, opts ...grpc.DialOption) (*Client, er
 	}, nil
 }
 
+// NewMeterusConnectClient creates a new MeterusClient that calls the server at
+// baseURL, such as https://meterus.example.com, over the Connect protocol
+// rather than gRPC. Connect works over HTTP/1.1, through proxies that do not
+// support gRPC's HTTP/2 trailers. A TimeoutPolicy with the default timeouts
+// is installed inside the interceptors given with connect.WithUnaryInterceptors,
+// so that a policy among them takes precedence.
+func NewMeterusConnectClient(baseURL, apiKey string, opts ...connect.Option) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse base URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("failed to parse base URL: unsupported scheme %q", u.Scheme)
+	}
+	opts = append(opts, connect.WithUnaryInterceptors(NewTimeoutPolicy().UnaryClientInterceptor()))
+	return &Client{
+		conn:   connect.NewConn(baseURL, opts...),
+		apiKey: apiKey,
+	}, nil
+}
+
 // Close closes all client connections.
 func (c *Client) Close() error {
 	err := c.conn.Close()
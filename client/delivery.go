@@ -0,0 +1,150 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/elliot14A/meterus-go/internal/uuid"
+	meter "github.com/elliot14A/meterus-go/meters/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// DeliveryResult describes the outcome of an event sent with IngestAsync.
+type DeliveryResult struct {
+	// EventID is the ID the event was sent with, assigned by the client if
+	// the event had none.
+	EventID string
+	// Attempts is the number of Ingest calls made for the event.
+	Attempts int
+	// Latency is the time from the first attempt until the final reply.
+	Latency time.Duration
+	// Err is the error of the final attempt, or nil if the event was stored.
+	Err error
+}
+
+// Delivery is a handle to an event being ingested in the background.
+type Delivery struct {
+	done   chan struct{}
+	result DeliveryResult
+}
+
+// Done returns a channel that is closed once the delivery has finished.
+func (d *Delivery) Done() <-chan struct{} {
+	return d.done
+}
+
+// Wait blocks until the delivery has finished or ctx is done. It returns the
+// delivery result together with the error Meterus replied with, if any.
+func (d *Delivery) Wait(ctx context.Context) (DeliveryResult, error) {
+	select {
+	case <-d.done:
+		return d.result, d.result.Err
+	case <-ctx.Done():
+		return DeliveryResult{}, ctx.Err()
+	}
+}
+
+// CompletedDelivery returns a Delivery that has already finished with result,
+// for fakes of MeteringClient.
+func CompletedDelivery(result DeliveryResult) *Delivery {
+	d := &Delivery{done: make(chan struct{}), result: result}
+	close(d.done)
+	return d
+}
+
+// IngestAsync sends a cloud event to the Meterus service in the background and
+// returns a handle to the delivery. Events without an ID are assigned one so
+// that the result carries the ID the event was sent with. Nil events and
+// events rejected by the event time policy finish immediately without being
+// sent. Unavailable,
+// aborted and throttled calls are retried as configured with WithIngestRetry,
+// waiting at least as long as the RetryInfo of a throttled call asks. The
+// context governs the whole delivery, including retries.
+func (m *MeteringService) IngestAsync(ctx context.Context, event *meter.CloudEvent) *Delivery {
+	d := &Delivery{done: make(chan struct{})}
+
+	event, err := m.prepareDelivery("IngestAsync", event)
+	if err != nil {
+		d.result.Err = err
+		close(d.done)
+		return d
+	}
+	d.result.EventID = event.Id
+
+	go func() {
+		defer close(d.done)
+		d.result = m.deliver(ctx, event)
+	}()
+	return d
+}
+
+// prepareDelivery applies the event time policy to event sent by the client
+// method named method and returns a copy of it that is guaranteed to carry an
+// ID.
+func (m *MeteringService) prepareDelivery(method string, event *meter.CloudEvent) (*meter.CloudEvent, error) {
+	if event == nil {
+		return nil, newError(method, codes.InvalidArgument, errors.New("event is required"))
+	}
+	event, err := m.checkEventTime(method, event)
+	if err != nil {
+		return nil, err
+	}
+	event = proto.Clone(event).(*meter.CloudEvent)
+	if event.Id == "" {
+		id, err := uuid.New()
+		if err != nil {
+			return nil, err
+		}
+		event.Id = id
+	}
+	return event, nil
+}
+
+// deliver sends a prepared event, retrying it as configured.
+func (m *MeteringService) deliver(ctx context.Context, event *meter.CloudEvent) DeliveryResult {
+	res := DeliveryResult{EventID: event.Id}
+	start := time.Now()
+	backoff := m.retryBackoff
+	for {
+		res.Attempts++
+		res.Err = m.ingest(ctx, event)
+		if res.Err == nil || res.Attempts >= m.maxAttempts || !isRetryable(res.Err) {
+			break
+		}
+		wait := backoff
+		if hint, ok := RetryDelay(res.Err); ok && hint > wait {
+			wait = hint
+		}
+		if err := sleep(ctx, wait); err != nil {
+			res.Err = err
+			break
+		}
+		backoff *= 2
+	}
+	res.Latency = time.Since(start)
+	return res
+}
+
+// isRetryable reports whether a failed call may succeed if sent again.
+func isRetryable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.Aborted, codes.ResourceExhausted:
+		return true
+	}
+	return false
+}
+
+// sleep waits for d to elapse or ctx to be done, whichever happens first.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,148 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/elliot14A/meterus-go/client"
+	"github.com/elliot14A/meterus-go/meterustest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestIngestAsyncRetries(t *testing.T) {
+	srv, faults := newServer(t)
+	metering := newClient(t, srv).NewMeteringService(client.WithIngestRetry(3, time.Millisecond))
+	ctx := context.Background()
+
+	faults.FailNext("Ingest", codes.Unavailable, 2)
+	event := newEvent(t, "", "acme", time.Now(), nil)
+	res, err := metering.IngestAsync(ctx, event).Wait(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, res.Attempts)
+	assert.NotEmpty(t, res.EventID, "events without an ID must be assigned one")
+	assert.Empty(t, event.Id, "the caller's event must not be modified")
+	events := srv.Events()
+	require.Len(t, events, 1)
+	assert.Equal(t, res.EventID, events[0].Id)
+
+	faults.FailNext("Ingest", codes.Unavailable, 3)
+	res, err = metering.IngestAsync(ctx, newEvent(t, "evt-2", "acme", time.Now(), nil)).Wait(ctx)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Equal(t, err, res.Err)
+	assert.Equal(t, 3, res.Attempts, "delivery must stop after the configured attempts")
+	assert.Equal(t, "evt-2", res.EventID)
+
+	faults.FailNext("Ingest", codes.InvalidArgument, 1)
+	res, err = metering.IngestAsync(ctx, newEvent(t, "evt-3", "acme", time.Now(), nil)).Wait(ctx)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, 1, res.Attempts, "rejected events must not be retried")
+}
+
+func TestIngestAsyncHonorsRetryInfo(t *testing.T) {
+	srv, faults := newServer(t)
+	metering := newClient(t, srv).NewMeteringService(client.WithIngestRetry(2, time.Millisecond))
+	ctx := context.Background()
+
+	faults.Add(meterustest.FaultRule{Method: "Ingest", Code: codes.ResourceExhausted, RetryDelay: 200 * time.Millisecond, Times: 1})
+	res, err := metering.IngestAsync(ctx, newEvent(t, "evt-1", "acme", time.Now(), nil)).Wait(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, res.Attempts)
+	assert.GreaterOrEqual(t, res.Latency, 200*time.Millisecond, "the retry must wait as long as the server asks")
+}
+
+func TestIngestAsyncContextGovernsRetries(t *testing.T) {
+	srv, faults := newServer(t)
+	metering := newClient(t, srv).NewMeteringService(client.WithIngestRetry(5, time.Hour))
+
+	faults.FailNext("Ingest", codes.Unavailable, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	d := metering.IngestAsync(ctx, newEvent(t, "evt-1", "acme", time.Now(), nil))
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	select {
+	case <-d.Done():
+	case <-time.After(time.Second):
+		t.Fatal("cancelling the context must end the delivery")
+	}
+	res, err := d.Wait(context.Background())
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, res.Attempts)
+}
+
+func TestDeliveryWait(t *testing.T) {
+	srv, faults := newServer(t)
+	metering := newClient(t, srv).NewMeteringService()
+
+	faults.Add(meterustest.FaultRule{Method: "Ingest", Latency: 200 * time.Millisecond})
+	d := metering.IngestAsync(context.Background(), newEvent(t, "evt-1", "acme", time.Now(), nil))
+	select {
+	case <-d.Done():
+		t.Fatal("Done must not be closed before the delivery finishes")
+	default:
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	res, err := d.Wait(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded, "Wait must return when its context is done")
+	assert.Zero(t, res)
+
+	<-d.Done()
+	res, err = d.Wait(context.Background())
+	require.NoError(t, err, "the delivery must continue after a Wait gives up")
+	assert.Equal(t, "evt-1", res.EventID)
+	assert.Equal(t, 1, res.Attempts)
+	assert.GreaterOrEqual(t, res.Latency, 200*time.Millisecond)
+	assert.Len(t, srv.Events(), 1)
+}
+
+func TestIngestAsyncRejectedByTimePolicy(t *testing.T) {
+	srv, _ := newServer(t)
+	metering := newClient(t, srv).NewMeteringService(client.WithEventTimePolicy(client.EventTimePolicy{MaxFuture: time.Minute}))
+
+	event := newEvent(t, "evt-1", "acme", time.Now().Add(time.Hour), nil)
+	d := metering.IngestAsync(context.Background(), event)
+	select {
+	case <-d.Done():
+	default:
+		t.Fatal("rejected events must finish immediately")
+	}
+	res, err := d.Wait(context.Background())
+	assert.ErrorIs(t, err, client.ErrEventInFuture)
+	var e *client.Error
+	require.True(t, errors.As(err, &e))
+	assert.Equal(t, "IngestAsync", e.Method)
+	assert.Zero(t, res.Attempts)
+	assert.Empty(t, srv.Events())
+}
+
+func TestIngestAsyncRejectsNilEvent(t *testing.T) {
+	srv, _ := newServer(t)
+	metering := newClient(t, srv).NewMeteringService()
+
+	res, err := metering.IngestAsync(context.Background(), nil).Wait(context.Background())
+	var e *client.Error
+	require.True(t, errors.As(err, &e))
+	assert.Equal(t, "IngestAsync", e.Method)
+	assert.Equal(t, codes.InvalidArgument, e.Code)
+	assert.Zero(t, res.Attempts)
+	assert.Empty(t, srv.Events())
+}
+
+func TestCompletedDelivery(t *testing.T) {
+	want := client.DeliveryResult{EventID: "evt-1", Attempts: 2, Err: status.Error(codes.Unavailable, "down")}
+	d := client.CompletedDelivery(want)
+	select {
+	case <-d.Done():
+	default:
+		t.Fatal("a completed delivery must be done")
+	}
+	res, err := d.Wait(context.Background())
+	assert.Equal(t, want, res)
+	assert.Equal(t, want.Err, err)
+}
@@ -0,0 +1,77 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// ErrEventInFuture is reported for events dated further ahead than the
+	// event time policy tolerates.
+	ErrEventInFuture = errors.New("event time is in the future")
+	// ErrEventTooOld is reported for events dated before the late-arrival
+	// cutoff of the event time policy.
+	ErrEventTooOld = errors.New("event time is older than the late-arrival cutoff")
+	// ErrMissingScopes is reported for valid API keys that do not grant all of
+	// the required scopes.
+	ErrMissingScopes = errors.New("api key is missing required scopes")
+	// ErrNoValidationResult is reported when Meterus answers ValidateAndMeter
+	// without a validation result, as servers predating it do. Whether the
+	// event was ingested is then unknown.
+	ErrNoValidationResult = errors.New("reply carries no validation result")
+)
+
+// Error is returned by client methods when a call is rejected, either by the
+// client itself or by the Meterus service. It carries the gRPC status code so
+// that status.Code and status.FromError keep working on it, and unwraps to the
+// underlying cause for use with errors.Is and errors.As.
+type Error struct {
+	// Method is the name of the client method that failed, such as "Ingest".
+	Method string
+	// Code is the gRPC status code describing the failure.
+	Code codes.Code
+	// Err is the underlying cause.
+	Err error
+}
+
+func newError(method string, code codes.Code, err error) *Error {
+	return &Error{Method: method, Code: code, Err: err}
+}
+
+// wrapError wraps an error returned by a Meterus call in an *Error, unless an
+// interceptor already did.
+func wrapError(method string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+	return newError(method, status.Code(err), err)
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("meterus: %s: %v", e.Method, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// GRPCStatus returns the error as a gRPC status. Errors caused by a status
+// return that status, so that its details, such as RetryInfo, are kept.
+func (e *Error) GRPCStatus() *status.Status {
+	if s, ok := status.FromError(e.Err); ok {
+		if s.Code() == e.Code {
+			return s
+		}
+		p := s.Proto()
+		p.Code = int32(e.Code)
+		return status.FromProto(p)
+	}
+	return status.New(e.Code, e.Error())
+}
@@ -0,0 +1,16 @@
+package client
+
+import "time"
+
+// SetClock makes the cache read the time from now.
+func (c *CachingValidator) SetClock(now func() time.Time) {
+	c.now = now
+}
+
+// Idle reports whether the cache has no lookups in flight, including
+// background refreshes.
+func (c *CachingValidator) Idle() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.running == 0
+}
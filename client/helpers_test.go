@@ -0,0 +1,47 @@
+package client_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/elliot14A/meterus-go/client"
+	meter "github.com/elliot14A/meterus-go/meters/v1"
+	"github.com/elliot14A/meterus-go/meterustest"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// newServer starts a test server closed with the test, and returns it with
+// the faults it injects.
+func newServer(t *testing.T, opts ...meterustest.Option) (*meterustest.Server, *meterustest.Faults) {
+	t.Helper()
+	faults := meterustest.NewFaults(1)
+	srv := meterustest.NewServer(append([]meterustest.Option{meterustest.WithFaults(faults)}, opts...)...)
+	t.Cleanup(srv.Close)
+	return srv, faults
+}
+
+// newClient returns a client of srv closed with the test.
+func newClient(t *testing.T, srv *meterustest.Server, opts ...grpc.DialOption) *client.Client {
+	t.Helper()
+	c := srv.Client("key", opts...)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// newEvent returns a request event of subject with the given data.
+func newEvent(t *testing.T, id, subject string, at time.Time, data map[string]any) *meter.CloudEvent {
+	t.Helper()
+	event, err := client.NewCloudEvent(id, "client-test", "1.0", "request", at, subject, data)
+	require.NoError(t, err)
+	return event
+}
+
+// reply returns a StubConn InvokeFunc answering every call with res or err.
+func reply(res proto.Message, err error) func(context.Context, string, proto.Message) (proto.Message, error) {
+	return func(context.Context, string, proto.Message) (proto.Message, error) {
+		return res, err
+	}
+}
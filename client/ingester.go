@@ -0,0 +1,162 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	meter "github.com/elliot14A/meterus-go/meters/v1"
+)
+
+// ErrIngesterClosed is returned by Ingester.Close when it is called twice.
+var ErrIngesterClosed = errors.New("ingester is closed")
+
+// Ingester sends events to the Meterus service from a bounded in-memory queue
+// served by background workers, so that callers never wait on the network.
+// Events that do not fit in the queue are dropped and counted.
+type Ingester struct {
+	service   *MeteringService
+	queue     chan *meter.CloudEvent
+	workers   int
+	onResult  func(*meter.CloudEvent, DeliveryResult)
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+	mu        sync.RWMutex
+	closed    bool
+	dropped   atomic.Uint64
+	delivered atomic.Uint64
+	failed    atomic.Uint64
+}
+
+// IngesterOption configures an Ingester.
+type IngesterOption func(*Ingester)
+
+// WithQueueSize sets how many events may wait for delivery. It defaults to 1024.
+func WithQueueSize(n int) IngesterOption {
+	return func(i *Ingester) {
+		if n > 0 {
+			i.queue = make(chan *meter.CloudEvent, n)
+		}
+	}
+}
+
+// WithWorkers sets how many events are delivered concurrently. It defaults to 4.
+func WithWorkers(n int) IngesterOption {
+	return func(i *Ingester) {
+		if n > 0 {
+			i.workers = n
+		}
+	}
+}
+
+// WithDeliveryHandler registers a function called with the result of every
+// delivery, successful or not. It is called from the worker goroutines.
+func WithDeliveryHandler(fn func(*meter.CloudEvent, DeliveryResult)) IngesterOption {
+	return func(i *Ingester) {
+		i.onResult = fn
+	}
+}
+
+// NewIngester starts an Ingester delivering events through m. It must be
+// closed to stop its workers.
+func (m *MeteringService) NewIngester(opts ...IngesterOption) *Ingester {
+	i := &Ingester{
+		service: m,
+		queue:   make(chan *meter.CloudEvent, 1024),
+		workers: 4,
+	}
+	for _, opt := range opts {
+		opt(i)
+	}
+	i.ctx, i.cancel = context.WithCancel(context.Background())
+	for n := 0; n < i.workers; n++ {
+		i.wg.Add(1)
+		go i.work()
+	}
+	return i
+}
+
+// Enqueue queues event for delivery without blocking. It reports false if the
+// event was dropped because it was rejected by the event time policy, the
+// queue is full or the ingester is closed.
+func (i *Ingester) Enqueue(event *meter.CloudEvent) bool {
+	event, err := i.service.prepareDelivery("Enqueue", event)
+	if err != nil {
+		i.dropped.Add(1)
+		return false
+	}
+	return i.enqueue(event)
+}
+
+// enqueue queues an event already prepared for delivery without blocking.
+func (i *Ingester) enqueue(event *meter.CloudEvent) bool {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	if i.closed {
+		i.dropped.Add(1)
+		return false
+	}
+	select {
+	case i.queue <- event:
+		return true
+	default:
+		i.dropped.Add(1)
+		return false
+	}
+}
+
+// Stats returns how many events were delivered, failed after all attempts and
+// dropped before being sent.
+func (i *Ingester) Stats() (delivered, failed, dropped uint64) {
+	return i.delivered.Load(), i.failed.Load(), i.dropped.Load()
+}
+
+// Close stops accepting events and waits for the queued ones to be delivered.
+// If ctx is done first, in-flight deliveries are cancelled and the remaining
+// events are dropped.
+func (i *Ingester) Close(ctx context.Context) error {
+	i.mu.Lock()
+	if i.closed {
+		i.mu.Unlock()
+		return ErrIngesterClosed
+	}
+	i.closed = true
+	close(i.queue)
+	i.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		i.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		i.cancel()
+		return nil
+	case <-ctx.Done():
+		i.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (i *Ingester) work() {
+	defer i.wg.Done()
+	for event := range i.queue {
+		if i.ctx.Err() != nil {
+			i.dropped.Add(1)
+			continue
+		}
+		res := i.service.deliver(i.ctx, event)
+		if res.Err != nil {
+			i.failed.Add(1)
+		} else {
+			i.delivered.Add(1)
+		}
+		if i.onResult != nil {
+			i.onResult(event, res)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package client
+
+import (
+	"context"
+
+	meter "github.com/elliot14A/meterus-go/meters/v1"
+	subject "github.com/elliot14A/meterus-go/subject/v1"
+	validation "github.com/elliot14A/meterus-go/validation/v1"
+)
+
+// MeteringClient is the interface of MeteringService, for code that needs to
+// substitute it in tests. The meterustest package provides a fake.
+type MeteringClient interface {
+	Ingest(ctx context.Context, event *meter.CloudEvent) error
+	IngestAsync(ctx context.Context, event *meter.CloudEvent) *Delivery
+	ListMeters(ctx context.Context, limit, page int32) (*meter.ListMetersResponse, error)
+	GetMeter(ctx context.Context, meterIDOrSlug string) (*meter.Meter, error)
+	CreateMeter(ctx context.Context, req *meter.CreateMeterRequest) (*meter.Meter, error)
+	DeleteMeter(ctx context.Context, meterIDOrSlug string) error
+	QueryMeter(ctx context.Context, req *meter.QueryMeterRequest) (*meter.QueryMeterResponse, error)
+	ListMeterSubjects(ctx context.Context, meterIDOrSlug string) (*meter.ListMeterSubjectsResponse, error)
+}
+
+// SubjectClient is the interface of SubjectService.
+type SubjectClient interface {
+	Create(ctx context.Context, id string, displayName *string) (*subject.Subject, error)
+	GetById(ctx context.Context, id string) (*subject.Subject, error)
+	ListById(ctx context.Context, page, limit int32) ([]*subject.Subject, error)
+	Update(ctx context.Context, id string, displayName *string) (*subject.Subject, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// ValidationClient is the interface of ValidationService.
+type ValidationClient interface {
+	ValidateApiKey(ctx context.Context, apiKey string, scopes []string) (*ValidationResult, error)
+	ValidateApiKeyExpr(ctx context.Context, apiKey string, expr ScopeExpr) (*ValidationResult, error)
+	ValidateAndMeter(ctx context.Context, apiKey string, scopes []string, event *meter.CloudEvent) (*ValidationResult, error)
+	CreateApiKey(ctx context.Context, req *validation.CreateApiKeyRequest) (*validation.ApiKey, string, error)
+	ListApiKeys(ctx context.Context, req *validation.ListApiKeysRequest) (*validation.ListApiKeysResponse, error)
+	RevokeApiKey(ctx context.Context, id string) error
+	RotateApiKey(ctx context.Context, req *validation.RotateApiKeyRequest) (*validation.ApiKey, string, error)
+}
+
+var (
+	_ MeteringClient   = (*MeteringService)(nil)
+	_ SubjectClient    = (*SubjectService)(nil)
+	_ ValidationClient = (*ValidationService)(nil)
+)
@@ -2,29 +2,79 @@ package client
 
 import (
 	"context"
+	"time"
 
 	meter "github.com/elliot14A/meterus-go/meters/v1"
+	"google.golang.org/grpc"
 )
 
 type MeteringService struct {
 	client meter.MeteringServiceClient
 	apiKey string
+
+	maxAttempts  int
+	retryBackoff time.Duration
+	timePolicy   *EventTimePolicy
+}
+
+// MeteringOption configures a MeteringService.
+type MeteringOption func(*MeteringService)
+
+// WithIngestRetry sets how many times IngestAsync attempts to deliver an event
+// and the initial backoff between attempts, which doubles after each failure.
+func WithIngestRetry(maxAttempts int, backoff time.Duration) MeteringOption {
+	return func(m *MeteringService) {
+		if maxAttempts < 1 {
+			maxAttempts = 1
+		}
+		m.maxAttempts = maxAttempts
+		m.retryBackoff = backoff
+	}
+}
+
+func (c *Client) NewMeteringService(opts ...MeteringOption) *MeteringService {
+	return NewMeteringServiceFromConn(c.conn, c.apiKey, opts...)
 }
 
-func (c *Client) NewMeteringService() *MeteringService {
-	return &MeteringService{
-		client: meter.NewMeteringServiceClient(c.conn),
-		apiKey: c.apiKey,
+// NewMeteringServiceFromConn creates a MeteringService calling Meterus over
+// conn, such as a connection not managed by a Client.
+func NewMeteringServiceFromConn(conn grpc.ClientConnInterface, apiKey string, opts ...MeteringOption) *MeteringService {
+	m := &MeteringService{
+		client:       meter.NewMeteringServiceClient(conn),
+		apiKey:       apiKey,
+		maxAttempts:  3,
+		retryBackoff: 100 * time.Millisecond,
 	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
 }
 
 // Ingest sends a cloud event to the Meterus service for ingestion.
 func (m *MeteringService) Ingest(ctx context.Context, event *meter.CloudEvent) error {
+	event, err := m.checkEventTime("Ingest", event)
+	if err != nil {
+		return err
+	}
+	return m.ingest(ctx, event)
+}
+
+func (m *MeteringService) ingest(ctx context.Context, event *meter.CloudEvent) error {
 	ctx = AddApiKeyAuthorizationHeader(ctx, m.apiKey)
 	_, err := m.client.Ingest(ctx, event)
 	return err
 }
 
+// checkEventTime applies the event time policy, if any, to event sent by the
+// client method named method.
+func (m *MeteringService) checkEventTime(method string, event *meter.CloudEvent) (*meter.CloudEvent, error) {
+	if m.timePolicy == nil {
+		return event, nil
+	}
+	return m.timePolicy.apply(method, event)
+}
+
 // ListMeters retrieves a list of meters from the Meterus service.
 func (m *MeteringService) ListMeters(ctx context.Context, limit, page int32) (*meter.ListMetersResponse, error) {
 	ctx = AddApiKeyAuthorizationHeader(ctx, m.apiKey)
@@ -0,0 +1,306 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	meter "github.com/elliot14A/meterus-go/meters/v1"
+)
+
+// MirroringIngester ingests every event into a primary and a secondary Meterus
+// deployment, for migrating between them. Only primary failures are returned
+// to callers. Events are mirrored to the secondary through an Ingester, so the
+// shadow traffic never blocks the primary path; secondary failures are logged
+// and counted.
+type MirroringIngester struct {
+	primary   *MeteringService
+	secondary *MeteringService
+	shadow    *Ingester
+	logger    *slog.Logger
+	tolerance float64
+
+	primaryDelivered atomic.Uint64
+	primaryFailed    atomic.Uint64
+
+	// unloggedDrops counts the events dropped from the secondary since the
+	// last warning about drops, logged at lastDropLog in Unix nanoseconds.
+	unloggedDrops atomic.Uint64
+	lastDropLog   atomic.Int64
+}
+
+// dropLogInterval is the minimum time between two warnings about events
+// dropped from the secondary.
+const dropLogInterval = 10 * time.Second
+
+// MirrorOption configures a MirroringIngester.
+type MirrorOption func(*mirrorConfig)
+
+type mirrorConfig struct {
+	logger        *slog.Logger
+	tolerance     float64
+	queueSize     int
+	workers       int
+	meteringOpts  []MeteringOption
+	secondaryOpts []MeteringOption
+}
+
+// WithMirrorLogger sets the logger secondary failures are reported to. It
+// defaults to slog.Default().
+func WithMirrorLogger(logger *slog.Logger) MirrorOption {
+	return func(c *mirrorConfig) {
+		c.logger = logger
+	}
+}
+
+// WithMirrorQueue sets how many events may wait to be mirrored and how many
+// are mirrored concurrently. It defaults to 1024 events and 4 workers. Events
+// that do not fit in the queue are dropped from the secondary.
+func WithMirrorQueue(size, workers int) MirrorOption {
+	return func(c *mirrorConfig) {
+		c.queueSize = size
+		c.workers = workers
+	}
+}
+
+// WithMirrorMeteringOptions configures the metering services of both
+// deployments, such as with WithIngestRetry. An event time policy only applies
+// once, before the primary call; the secondary receives the event the primary
+// stored.
+func WithMirrorMeteringOptions(opts ...MeteringOption) MirrorOption {
+	return func(c *mirrorConfig) {
+		c.meteringOpts = append(c.meteringOpts, opts...)
+	}
+}
+
+// WithSecondaryMeteringOptions configures the metering service of the
+// secondary deployment only, such as with WithIngestRetry.
+func WithSecondaryMeteringOptions(opts ...MeteringOption) MirrorOption {
+	return func(c *mirrorConfig) {
+		c.secondaryOpts = append(c.secondaryOpts, opts...)
+	}
+}
+
+// WithDivergenceTolerance sets how far apart the values of a row may be in a
+// DivergenceReport before the row is reported. It defaults to 1e-9.
+func WithDivergenceTolerance(tolerance float64) MirrorOption {
+	return func(c *mirrorConfig) {
+		c.tolerance = tolerance
+	}
+}
+
+// NewMirroringIngester returns a MirroringIngester ingesting into primary and
+// secondary. It must be closed to stop mirroring.
+func NewMirroringIngester(primary, secondary *Client, opts ...MirrorOption) *MirroringIngester {
+	cfg := mirrorConfig{
+		logger:    slog.Default(),
+		tolerance: 1e-9,
+		queueSize: 1024,
+		workers:   4,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	m := &MirroringIngester{
+		primary:   primary.NewMeteringService(cfg.meteringOpts...),
+		secondary: secondary.NewMeteringService(append(cfg.meteringOpts, cfg.secondaryOpts...)...),
+		logger:    cfg.logger,
+		tolerance: cfg.tolerance,
+	}
+	m.shadow = m.secondary.NewIngester(
+		WithQueueSize(cfg.queueSize),
+		WithWorkers(cfg.workers),
+		WithDeliveryHandler(m.onSecondaryResult),
+	)
+	return m
+}
+
+// Ingest sends event to the primary deployment and returns its error, if any.
+// The primary call is retried as configured with WithIngestRetry. Once the
+// primary has stored the event, it is queued for the secondary under the same
+// ID. Events without an ID are assigned one.
+func (m *MirroringIngester) Ingest(ctx context.Context, event *meter.CloudEvent) error {
+	event, err := m.primary.prepareDelivery("Ingest", event)
+	if err != nil {
+		m.primaryFailed.Add(1)
+		return err
+	}
+	if err := m.primary.deliver(ctx, event).Err; err != nil {
+		m.primaryFailed.Add(1)
+		return err
+	}
+	m.primaryDelivered.Add(1)
+	// The event is mirrored as the primary stored it, without applying the
+	// event time policy again.
+	if !m.shadow.enqueue(event) {
+		m.logDrop(event)
+	}
+	return nil
+}
+
+// logDrop warns about an event dropped from the secondary, at most once per
+// dropLogInterval, with the number of events dropped since the last warning.
+// Stats counts every drop.
+func (m *MirroringIngester) logDrop(event *meter.CloudEvent) {
+	m.unloggedDrops.Add(1)
+	now := time.Now().UnixNano()
+	last := m.lastDropLog.Load()
+	if now-last < int64(dropLogInterval) || !m.lastDropLog.CompareAndSwap(last, now) {
+		return
+	}
+	m.logger.Warn("meterus: dropped mirrored events",
+		"dropped", m.unloggedDrops.Swap(0), "last_event_id", event.Id)
+}
+
+func (m *MirroringIngester) onSecondaryResult(event *meter.CloudEvent, res DeliveryResult) {
+	if res.Err != nil {
+		m.logger.Warn("meterus: failed to mirror event",
+			"event_id", event.Id, "attempts", res.Attempts, "error", res.Err)
+	}
+}
+
+// MirrorStats counts the events handled by a MirroringIngester.
+type MirrorStats struct {
+	// PrimaryDelivered and PrimaryFailed count the events stored and
+	// rejected by the primary.
+	PrimaryDelivered uint64
+	PrimaryFailed    uint64
+	// SecondaryDelivered and SecondaryFailed count the mirrored events
+	// stored and rejected by the secondary after all attempts.
+	SecondaryDelivered uint64
+	SecondaryFailed    uint64
+	// SecondaryDropped counts the events that were not mirrored because the
+	// queue was full or the ingester was closed.
+	SecondaryDropped uint64
+}
+
+// Stats returns the counts of events handled so far.
+func (m *MirroringIngester) Stats() MirrorStats {
+	delivered, failed, dropped := m.shadow.Stats()
+	return MirrorStats{
+		PrimaryDelivered:   m.primaryDelivered.Load(),
+		PrimaryFailed:      m.primaryFailed.Load(),
+		SecondaryDelivered: delivered,
+		SecondaryFailed:    failed,
+		SecondaryDropped:   dropped,
+	}
+}
+
+// Close stops mirroring and waits for the queued events to reach the
+// secondary, as Ingester.Close does.
+func (m *MirroringIngester) Close(ctx context.Context) error {
+	return m.shadow.Close(ctx)
+}
+
+// DivergenceReport compares the results of a QueryMeter call on the primary
+// and the secondary deployment.
+type DivergenceReport struct {
+	// Meter is the meter ID or slug that was queried.
+	Meter string
+	// PrimaryRows and SecondaryRows are the numbers of rows returned by
+	// each deployment.
+	PrimaryRows   int
+	SecondaryRows int
+	// Rows are the rows whose values differ or that only one deployment
+	// returned, ordered by window start.
+	Rows []RowDivergence
+}
+
+// Diverged reports whether any row differs.
+func (r *DivergenceReport) Diverged() bool {
+	return len(r.Rows) > 0
+}
+
+// RowDivergence is a row of a QueryMeter result that differs between the two
+// deployments.
+type RowDivergence struct {
+	From    time.Time
+	To      time.Time
+	GroupBy map[string]any
+	// Primary and Secondary are the values of the row, or nil if the
+	// deployment did not return it.
+	Primary   *float64
+	Secondary *float64
+}
+
+// Compare runs req against both deployments and reports the rows that
+// differ. It fails if either query fails.
+func (m *MirroringIngester) Compare(ctx context.Context, req *meter.QueryMeterRequest) (*DivergenceReport, error) {
+	var (
+		wg                    sync.WaitGroup
+		primary, secondary    *meter.QueryMeterResponse
+		primaryErr, shadowErr error
+	)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		primary, primaryErr = m.primary.QueryMeter(ctx, req)
+	}()
+	go func() {
+		defer wg.Done()
+		secondary, shadowErr = m.secondary.QueryMeter(ctx, req)
+	}()
+	wg.Wait()
+	if primaryErr != nil {
+		return nil, fmt.Errorf("failed to query primary: %w", primaryErr)
+	}
+	if shadowErr != nil {
+		return nil, fmt.Errorf("failed to query secondary: %w", shadowErr)
+	}
+
+	report := &DivergenceReport{
+		Meter:         req.GetMeterIdOrSlug(),
+		PrimaryRows:   len(primary.Data),
+		SecondaryRows: len(secondary.Data),
+	}
+	rows := make(map[string]*RowDivergence)
+	var keys []string
+	add := func(row *meter.QueryMeterRow, primary bool) {
+		key := rowKey(row)
+		d, ok := rows[key]
+		if !ok {
+			d = &RowDivergence{
+				From:    row.From.AsTime(),
+				To:      row.To.AsTime(),
+				GroupBy: row.GroupBy.AsMap(),
+			}
+			rows[key] = d
+			keys = append(keys, key)
+		}
+		value := row.Value
+		if primary {
+			d.Primary = &value
+		} else {
+			d.Secondary = &value
+		}
+	}
+	for _, row := range primary.Data {
+		add(row, true)
+	}
+	for _, row := range secondary.Data {
+		add(row, false)
+	}
+	for _, key := range keys {
+		d := rows[key]
+		if d.Primary != nil && d.Secondary != nil && math.Abs(*d.Primary-*d.Secondary) <= m.tolerance {
+			continue
+		}
+		report.Rows = append(report.Rows, *d)
+	}
+	sort.SliceStable(report.Rows, func(i, j int) bool {
+		return report.Rows[i].From.Before(report.Rows[j].From)
+	})
+	return report, nil
+}
+
+// rowKey identifies a row by its window and group.
+func rowKey(row *meter.QueryMeterRow) string {
+	groupBy, _ := json.Marshal(row.GroupBy.AsMap())
+	return fmt.Sprintf("%d/%d/%s", row.From.AsTime().UnixNano(), row.To.AsTime().UnixNano(), groupBy)
+}
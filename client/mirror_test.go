@@ -0,0 +1,137 @@
+package client_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/elliot14A/meterus-go/client"
+	meter "github.com/elliot14A/meterus-go/meters/v1"
+	"github.com/elliot14A/meterus-go/meterustest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// discardLogs keeps the secondary failures a mirror reports out of the test
+// output.
+var discardLogs = client.WithMirrorLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+func TestMirroringIngesterReturnsOnlyPrimaryErrors(t *testing.T) {
+	primary, primaryFaults := newServer(t)
+	secondary, secondaryFaults := newServer(t)
+	mirror := client.NewMirroringIngester(newClient(t, primary), newClient(t, secondary), discardLogs,
+		client.WithMirrorMeteringOptions(client.WithIngestRetry(1, 0)))
+	ctx := context.Background()
+
+	secondaryFaults.Add(meterustest.FaultRule{Method: "Ingest", Code: codes.Unavailable})
+	require.NoError(t, mirror.Ingest(ctx, newEvent(t, "evt-1", "acme", time.Now(), nil)),
+		"secondary failures must not reach the caller")
+
+	primaryFaults.FailNext("Ingest", codes.InvalidArgument, 1)
+	err := mirror.Ingest(ctx, newEvent(t, "evt-2", "acme", time.Now(), nil))
+	assert.Equal(t, codes.InvalidArgument, status.Code(err), "primary failures must reach the caller")
+
+	require.NoError(t, mirror.Close(ctx))
+	assert.Len(t, primary.Events(), 1)
+	assert.Empty(t, secondary.Events(), "events the primary rejected must not be mirrored")
+	assert.Equal(t, client.MirrorStats{
+		PrimaryDelivered: 1,
+		PrimaryFailed:    1,
+		SecondaryFailed:  1,
+	}, mirror.Stats())
+}
+
+func TestMirroringIngesterAppliesTimePolicyOnce(t *testing.T) {
+	var calls int
+	base := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time {
+		calls++
+		return base.Add(time.Duration(calls) * time.Second)
+	}
+	primary, _ := newServer(t)
+	secondary, _ := newServer(t)
+	mirror := client.NewMirroringIngester(newClient(t, primary), newClient(t, secondary), discardLogs,
+		client.WithMirrorMeteringOptions(client.WithEventTimePolicy(client.EventTimePolicy{
+			StampTime: true,
+			Clock:     clock,
+		})))
+	ctx := context.Background()
+
+	event := newEvent(t, "", "acme", base.Add(-time.Hour), nil)
+	require.NoError(t, mirror.Ingest(ctx, event))
+	require.NoError(t, mirror.Close(ctx))
+
+	primaryEvents, secondaryEvents := primary.Events(), secondary.Events()
+	require.Len(t, primaryEvents, 1)
+	require.Len(t, secondaryEvents, 1)
+	assert.NotEmpty(t, primaryEvents[0].Id)
+	assert.Equal(t, primaryEvents[0].Id, secondaryEvents[0].Id, "events must be mirrored under the same ID")
+	assert.Equal(t, primaryEvents[0].Time.AsTime(), secondaryEvents[0].Time.AsTime(), "events must be mirrored with the time the primary stored")
+	assert.Equal(t, 1, calls, "the event time policy must be applied once")
+}
+
+func TestMirroringIngesterCompare(t *testing.T) {
+	primary, _ := newServer(t)
+	secondary, _ := newServer(t)
+	mirror := client.NewMirroringIngester(newClient(t, primary), newClient(t, secondary), discardLogs)
+	ctx := context.Background()
+	defer mirror.Close(ctx)
+	base := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, srv := range []*meterustest.Server{primary, secondary} {
+		_, err := newClient(t, srv).NewMeteringService().CreateMeter(ctx, &meter.CreateMeterRequest{
+			Slug:          "tokens",
+			EventType:     "request",
+			Aggregation:   meter.Aggregation_AGGREGATION_SUM,
+			ValueProperty: proto.String("$.tokens"),
+		})
+		require.NoError(t, err)
+	}
+	req := &meter.QueryMeterRequest{
+		MeterIdOrSlug: "tokens",
+		From:          timestamppb.New(base),
+		To:            timestamppb.New(base.Add(3 * 24 * time.Hour)),
+		WindowSize:    "DAY",
+	}
+
+	require.NoError(t, mirror.Ingest(ctx, newEvent(t, "evt-1", "acme", base.Add(time.Hour), map[string]any{"tokens": 5})))
+	require.NoError(t, mirror.Ingest(ctx, newEvent(t, "evt-2", "acme", base.Add(25*time.Hour), map[string]any{"tokens": 7})))
+	require.Eventually(t, func() bool { return len(secondary.Events()) == 2 }, time.Second, time.Millisecond)
+
+	report, err := mirror.Compare(ctx, req)
+	require.NoError(t, err)
+	assert.False(t, report.Diverged(), "%+v", report.Rows)
+	assert.Equal(t, "tokens", report.Meter)
+	assert.Equal(t, 2, report.PrimaryRows)
+	assert.Equal(t, 2, report.SecondaryRows)
+
+	// Events reaching only one deployment make it diverge.
+	require.NoError(t, newClient(t, secondary).NewMeteringService().Ingest(ctx, newEvent(t, "evt-3", "acme", base.Add(26*time.Hour), map[string]any{"tokens": 1})))
+	require.NoError(t, newClient(t, primary).NewMeteringService().Ingest(ctx, newEvent(t, "evt-4", "acme", base.Add(49*time.Hour), map[string]any{"tokens": 2})))
+
+	report, err = mirror.Compare(ctx, req)
+	require.NoError(t, err)
+	require.True(t, report.Diverged())
+	require.Len(t, report.Rows, 2)
+
+	day2, day3 := report.Rows[0], report.Rows[1]
+	assert.Equal(t, base.Add(24*time.Hour), day2.From)
+	require.NotNil(t, day2.Primary)
+	require.NotNil(t, day2.Secondary)
+	assert.Equal(t, 7.0, *day2.Primary)
+	assert.Equal(t, 8.0, *day2.Secondary)
+
+	assert.Equal(t, base.Add(48*time.Hour), day3.From)
+	require.NotNil(t, day3.Primary)
+	assert.Equal(t, 2.0, *day3.Primary)
+	assert.Nil(t, day3.Secondary, "rows missing from a deployment must have no value")
+
+	_, err = mirror.Compare(ctx, &meter.QueryMeterRequest{MeterIdOrSlug: "unknown"})
+	assert.Error(t, err, "Compare must fail if a query fails")
+}
@@ -0,0 +1,259 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrRateLimited is reported for calls rejected by a RateLimiter, either in
+// fail-fast mode or because the wait would outlast the call's deadline.
+var ErrRateLimited = errors.New("client rate limit exceeded")
+
+// RateLimit is a token bucket: calls are allowed at Rate per second on
+// average, with bursts of up to Burst calls. Rate must be positive; the options
+// taking a RateLimit panic otherwise. A Burst below 1 allows single calls.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// RateLimiter limits the rate of calls made by a client with token buckets at
+// client, service and method level. A call must take a token from every bucket
+// that applies to it. It also holds back calls to a method for as long as
+// Meterus asked with the RetryInfo of a ResourceExhausted error. It is safe for
+// concurrent use; install it on a client with its UnaryClientInterceptor:
+//
+//	limiter := client.NewRateLimiter(client.WithMethodLimit("Ingest", client.RateLimit{Rate: 100, Burst: 20}))
+//	c, err := client.NewMeterusClient(addr, apiKey, grpc.WithChainUnaryInterceptor(limiter.UnaryClientInterceptor()))
+type RateLimiter struct {
+	now      func() time.Time
+	failFast bool
+
+	mu       sync.Mutex
+	client   *bucket
+	services map[string]*bucket
+	methods  map[string]*bucket
+	// pausedUntil holds the end of the pause requested by Meterus for each
+	// method, by full name, so that methods of different services sharing a
+	// name are paused independently.
+	pausedUntil map[string]time.Time
+}
+
+// RateLimitOption configures a RateLimiter.
+type RateLimitOption func(*RateLimiter)
+
+// WithClientLimit limits all calls.
+func WithClientLimit(limit RateLimit) RateLimitOption {
+	return func(l *RateLimiter) {
+		l.client = newBucket(limit, l.now())
+	}
+}
+
+// WithServiceLimit limits the calls to a service, given by its full name, such
+// as "meterus.meter.v1.MeteringService", or its bare name, such as
+// "MeteringService".
+func WithServiceLimit(service string, limit RateLimit) RateLimitOption {
+	return func(l *RateLimiter) {
+		l.services[service] = newBucket(limit, l.now())
+	}
+}
+
+// WithMethodLimit limits the calls to a method, given by its full name, such
+// as "/meterus.meter.v1.MeteringService/Ingest", or its bare name, such as
+// "Ingest".
+func WithMethodLimit(method string, limit RateLimit) RateLimitOption {
+	return func(l *RateLimiter) {
+		l.methods[method] = newBucket(limit, l.now())
+	}
+}
+
+// WithFailFast rejects calls that cannot be made right away with
+// ErrRateLimited. By default, calls wait for their turn.
+func WithFailFast() RateLimitOption {
+	return func(l *RateLimiter) {
+		l.failFast = true
+	}
+}
+
+// NewRateLimiter returns a RateLimiter with the given limits. Without limits,
+// it only honors the retry hints of Meterus.
+func NewRateLimiter(opts ...RateLimitOption) *RateLimiter {
+	l := &RateLimiter{
+		now:         time.Now,
+		services:    make(map[string]*bucket),
+		methods:     make(map[string]*bucket),
+		pausedUntil: make(map[string]time.Time),
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// UnaryClientInterceptor returns an interceptor applying the limits to unary
+// calls. In wait mode, a call whose turn comes after its deadline fails right
+// away with ErrRateLimited.
+func (l *RateLimiter) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if err := l.Wait(ctx, method); err != nil {
+			return err
+		}
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		l.observe(method, err)
+		return err
+	}
+}
+
+// Wait takes a token for a call to the method, given by its full or bare name,
+// waiting for it unless the limiter fails fast. Pauses requested by Meterus
+// only apply to calls given by full name.
+func (l *RateLimiter) Wait(ctx context.Context, method string) error {
+	r := l.reserve(method)
+	if r.delay <= 0 {
+		return nil
+	}
+	name := bareMethod(method)
+	if l.failFast {
+		l.cancel(r)
+		return newError(name, codes.ResourceExhausted, ErrRateLimited)
+	}
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(l.now().Add(r.delay)) {
+		l.cancel(r)
+		return newError(name, codes.ResourceExhausted, fmt.Errorf("%w: wait of %s exceeds deadline", ErrRateLimited, r.delay))
+	}
+	if err := sleep(ctx, r.delay); err != nil {
+		l.cancel(r)
+		return newError(name, status.FromContextError(err).Code(), err)
+	}
+	return nil
+}
+
+// reservation is a token taken from each bucket of a call, and how long the
+// call must wait before using them.
+type reservation struct {
+	buckets []*bucket
+	delay   time.Duration
+}
+
+func (l *RateLimiter) reserve(method string) reservation {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	r := reservation{}
+	if until, ok := l.pausedUntil[method]; ok {
+		if now.Before(until) {
+			r.delay = until.Sub(now)
+		} else {
+			delete(l.pausedUntil, method)
+		}
+	}
+	for _, b := range l.bucketsFor(method) {
+		r.buckets = append(r.buckets, b)
+		r.delay = max(r.delay, b.take(now))
+	}
+	return r
+}
+
+// cancel returns the tokens of a reservation that was not used.
+func (l *RateLimiter) cancel(r reservation) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, b := range r.buckets {
+		b.tokens = math.Min(b.tokens+1, float64(b.limit.Burst))
+	}
+}
+
+// bucketsFor returns the buckets that apply to the full method name.
+func (l *RateLimiter) bucketsFor(method string) []*bucket {
+	var buckets []*bucket
+	if l.client != nil {
+		buckets = append(buckets, l.client)
+	}
+	service, name, _ := strings.Cut(strings.TrimPrefix(method, "/"), "/")
+	if b, ok := l.services[service]; ok {
+		buckets = append(buckets, b)
+	} else if b, ok := l.services[service[strings.LastIndex(service, ".")+1:]]; ok {
+		buckets = append(buckets, b)
+	}
+	if b, ok := l.methods[method]; ok {
+		buckets = append(buckets, b)
+	} else if b, ok := l.methods[name]; ok {
+		buckets = append(buckets, b)
+	}
+	return buckets
+}
+
+// observe pauses calls to method when err asks to retry after a delay.
+func (l *RateLimiter) observe(method string, err error) {
+	delay, ok := RetryDelay(err)
+	if !ok {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	until := l.now().Add(delay)
+	if until.After(l.pausedUntil[method]) {
+		l.pausedUntil[method] = until
+	}
+}
+
+// RetryDelay returns the delay Meterus asked for in the RetryInfo of a
+// ResourceExhausted error.
+func RetryDelay(err error) (time.Duration, bool) {
+	s, ok := status.FromError(err)
+	if !ok || s.Code() != codes.ResourceExhausted {
+		return 0, false
+	}
+	for _, d := range s.Details() {
+		if info, ok := d.(*errdetails.RetryInfo); ok && info.GetRetryDelay() != nil {
+			return info.GetRetryDelay().AsDuration(), true
+		}
+	}
+	return 0, false
+}
+
+// bareMethod returns the method name of a full method name.
+func bareMethod(method string) string {
+	return method[strings.LastIndex(method, "/")+1:]
+}
+
+// bucket is a token bucket.
+type bucket struct {
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(limit RateLimit, now time.Time) *bucket {
+	if !(limit.Rate > 0) {
+		panic(fmt.Sprintf("client: rate limit must be positive, got %v", limit.Rate))
+	}
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+	return &bucket{limit: limit, tokens: float64(limit.Burst), last: now}
+}
+
+// take removes a token, possibly going into debt, and returns how long until
+// the bucket is out of debt.
+func (b *bucket) take(now time.Time) time.Duration {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(b.tokens+elapsed.Seconds()*b.limit.Rate, float64(b.limit.Burst))
+		b.last = now
+	}
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.limit.Rate * float64(time.Second))
+}
@@ -0,0 +1,143 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/elliot14A/meterus-go/client"
+	"github.com/elliot14A/meterus-go/meterustest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func assertRateLimited(t *testing.T, err error, method string) {
+	t.Helper()
+	require.ErrorIs(t, err, client.ErrRateLimited)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	var e *client.Error
+	require.True(t, errors.As(err, &e))
+	assert.Equal(t, method, e.Method)
+}
+
+func TestRateLimiterMethodBuckets(t *testing.T) {
+	limiter := client.NewRateLimiter(
+		client.WithMethodLimit("ListMeters", client.RateLimit{Rate: 0.001, Burst: 2}),
+		client.WithServiceLimit("SubjectService", client.RateLimit{Rate: 0.001, Burst: 1}),
+		client.WithFailFast())
+	srv, _ := newServer(t)
+	c := newClient(t, srv, grpc.WithChainUnaryInterceptor(limiter.UnaryClientInterceptor()))
+	ctx := context.Background()
+	m := c.NewMeteringService()
+
+	for i := 0; i < 2; i++ {
+		_, err := m.ListMeters(ctx, 10, 1)
+		require.NoError(t, err, "calls within the burst must go through")
+	}
+	_, err := m.ListMeters(ctx, 10, 1)
+	assertRateLimited(t, err, "ListMeters")
+
+	_, err = m.ListMeterSubjects(ctx, "requests")
+	assert.NotErrorIs(t, err, client.ErrRateLimited, "other methods have buckets of their own")
+
+	s := c.NewSubjectService()
+	_, err = s.ListById(ctx, 1, 10)
+	require.NoError(t, err)
+	_, err = s.GetById(ctx, "acme")
+	assertRateLimited(t, err, "GetSubject")
+}
+
+func TestRateLimitMustBePositive(t *testing.T) {
+	for _, rate := range []float64{0, -1} {
+		limit := client.RateLimit{Rate: rate, Burst: 1}
+		assert.Panics(t, func() { client.NewRateLimiter(client.WithClientLimit(limit)) }, "rate %v", rate)
+		assert.Panics(t, func() { client.NewRateLimiter(client.WithServiceLimit("MeteringService", limit)) }, "rate %v", rate)
+		assert.Panics(t, func() { client.NewRateLimiter(client.WithMethodLimit("Ingest", limit)) }, "rate %v", rate)
+	}
+	assert.NotPanics(t, func() { client.NewRateLimiter(client.WithClientLimit(client.RateLimit{Rate: 0.001})) })
+}
+
+func TestRateLimiterWaitMode(t *testing.T) {
+	limiter := client.NewRateLimiter(client.WithMethodLimit("ListMeters", client.RateLimit{Rate: 10, Burst: 1}))
+	srv, _ := newServer(t)
+	c := newClient(t, srv, grpc.WithChainUnaryInterceptor(limiter.UnaryClientInterceptor()))
+	m := c.NewMeteringService()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		_, err := m.ListMeters(context.Background(), 10, 1)
+		require.NoError(t, err)
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond, "calls beyond the burst must wait for a token")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := m.ListMeters(ctx, 10, 1)
+	assertRateLimited(t, err, "ListMeters")
+	assert.NoError(t, ctx.Err(), "calls whose turn comes after their deadline must fail right away")
+}
+
+func TestRateLimiterHonorsRetryInfo(t *testing.T) {
+	for _, failFast := range []bool{true, false} {
+		t.Run(map[bool]string{true: "fail fast", false: "wait"}[failFast], func(t *testing.T) {
+			var opts []client.RateLimitOption
+			if failFast {
+				opts = append(opts, client.WithFailFast())
+			}
+			limiter := client.NewRateLimiter(opts...)
+			srv, faults := newServer(t)
+			c := newClient(t, srv, grpc.WithChainUnaryInterceptor(limiter.UnaryClientInterceptor()))
+			m := c.NewMeteringService()
+			ctx := context.Background()
+
+			faults.Add(meterustest.FaultRule{Method: "ListMeters", Code: codes.ResourceExhausted, RetryDelay: 200 * time.Millisecond, Times: 1})
+			_, err := m.ListMeters(ctx, 10, 1)
+			require.Equal(t, codes.ResourceExhausted, status.Code(err))
+			delay, ok := client.RetryDelay(err)
+			require.True(t, ok)
+			assert.Equal(t, 200*time.Millisecond, delay)
+
+			_, err = m.ListMeterSubjects(ctx, "requests")
+			assert.NotErrorIs(t, err, client.ErrRateLimited, "a pause must only hold back its method")
+
+			start := time.Now()
+			_, err = m.ListMeters(ctx, 10, 1)
+			if failFast {
+				assertRateLimited(t, err, "ListMeters")
+				return
+			}
+			require.NoError(t, err)
+			assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond, "calls must wait for the requested delay")
+		})
+	}
+}
+
+func TestRateLimiterPausesByFullMethodName(t *testing.T) {
+	limiter := client.NewRateLimiter(client.WithFailFast())
+	interceptor := limiter.UnaryClientInterceptor()
+	throttled, err := status.New(codes.ResourceExhausted, "slow down").WithDetails(retryInfo(time.Minute))
+	require.NoError(t, err)
+	invoker := func(_ context.Context, method string, _, _ any, _ *grpc.ClientConn, _ ...grpc.CallOption) error {
+		if method == "/meterus.a.v1.ServiceA/Get" {
+			return throttled.Err()
+		}
+		return nil
+	}
+	ctx := context.Background()
+
+	err = interceptor(ctx, "/meterus.a.v1.ServiceA/Get", nil, nil, nil, invoker)
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assertRateLimited(t, interceptor(ctx, "/meterus.a.v1.ServiceA/Get", nil, nil, nil, invoker), "Get")
+	assert.NoError(t, interceptor(ctx, "/meterus.b.v1.ServiceB/Get", nil, nil, nil, invoker),
+		"a pause of one service's method must not hold back another service's method of the same name")
+}
+
+func retryInfo(delay time.Duration) *errdetails.RetryInfo {
+	return &errdetails.RetryInfo{RetryDelay: durationpb.New(delay)}
+}
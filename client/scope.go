@@ -0,0 +1,297 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+)
+
+// ScopeExpr is a boolean expression over API key scopes, such as
+// "meters:read OR admin" or "meters:* AND NOT meters:delete".
+//
+// Scopes are hierarchical with ":" as separator: a granted scope covers all of
+// its descendants, so "meters" grants "meters:read". A "*" segment in a
+// granted scope covers everything at and below its level, and a trailing "*"
+// in a required scope is satisfied by any scope at or below its level.
+type ScopeExpr interface {
+	// Allows reports whether the granted scopes satisfy the expression.
+	Allows(granted []string) bool
+	// String returns the expression in canonical form.
+	String() string
+}
+
+// ParseScopeExpr parses a scope expression. Terms are combined with AND, OR
+// and NOT, or their symbolic forms &&, || and !, in decreasing order of
+// precedence NOT, AND, OR. Parentheses group terms. Operators are upper case,
+// so scopes named "and", "or" or "not" are terms.
+func ParseScopeExpr(s string) (ScopeExpr, error) {
+	p := &scopeParser{tokens: tokenizeScopes(s)}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, fmt.Errorf("invalid scope expression %q: %w", s, err)
+	}
+	if tok, ok := p.peek(); ok {
+		return nil, fmt.Errorf("invalid scope expression %q: unexpected %q", s, tok)
+	}
+	return expr, nil
+}
+
+// MustParseScopeExpr is like ParseScopeExpr but panics if s is invalid. It
+// simplifies initializing variables holding scope expressions.
+func MustParseScopeExpr(s string) ScopeExpr {
+	expr, err := ParseScopeExpr(s)
+	if err != nil {
+		panic(err)
+	}
+	return expr
+}
+
+// RequiredScopes returns the expression as a flat list of required scopes, as
+// sent in ValidateApiKey requests. It reports false if the expression is not
+// a conjunction of plain scopes and therefore has to be checked locally.
+func RequiredScopes(expr ScopeExpr) ([]string, bool) {
+	switch e := expr.(type) {
+	case scopeTerm:
+		if strings.Contains(string(e), "*") {
+			return nil, false
+		}
+		return []string{string(e)}, true
+	case scopeAnd:
+		left, ok := RequiredScopes(e.left)
+		if !ok {
+			return nil, false
+		}
+		right, ok := RequiredScopes(e.right)
+		if !ok {
+			return nil, false
+		}
+		return append(left, right...), true
+	}
+	return nil, false
+}
+
+// ValidateApiKeyExpr validates apiKey and checks that its scopes satisfy expr.
+// Expressions that can be expressed as required scopes are checked by Meterus,
+// others are evaluated against the scopes Meterus reports as granted and are
+// denied if it reports none.
+func (v *ValidationService) ValidateApiKeyExpr(ctx context.Context, apiKey string, expr ScopeExpr) (*ValidationResult, error) {
+	return ValidateScopeExpr(ctx, v.ValidateApiKey, apiKey, expr)
+}
+
+// ValidateApiKeyExpr behaves like ValidationService.ValidateApiKeyExpr.
+// Expressions that have to be checked locally are evaluated against the
+// cached scope grants of the key, so one cached result serves all of them.
+func (c *CachingValidator) ValidateApiKeyExpr(ctx context.Context, apiKey string, expr ScopeExpr) (*ValidationResult, error) {
+	return ValidateScopeExpr(ctx, c.ValidateApiKey, apiKey, expr)
+}
+
+// ValidateScopeExpr validates apiKey through validate and checks that its
+// scopes satisfy expr, as ValidationService.ValidateApiKeyExpr does, for other
+// implementations of ValidationClient such as fakes.
+func ValidateScopeExpr(ctx context.Context, validate func(ctx context.Context, apiKey string, scopes []string) (*ValidationResult, error), apiKey string, expr ScopeExpr) (*ValidationResult, error) {
+	const method = "ValidateApiKey"
+	required, flat := RequiredScopes(expr)
+	res, err := validate(ctx, apiKey, required)
+	if err != nil || !res.Valid {
+		return res, err
+	}
+	if len(res.Scopes) == 0 {
+		if flat {
+			// Meterus checked the required scopes itself.
+			return res, nil
+		}
+		// Without the granted scopes the expression cannot be checked, and
+		// expressions such as "NOT admin" must not pass by default.
+		res.Valid = false
+		return res, newError(method, codes.PermissionDenied, fmt.Errorf("%w: %s: granted scopes unknown", ErrMissingScopes, expr))
+	}
+	if !expr.Allows(res.Scopes) {
+		res.Valid = false
+		return res, newError(method, codes.PermissionDenied, fmt.Errorf("%w: %s", ErrMissingScopes, expr))
+	}
+	return res, nil
+}
+
+type (
+	scopeTerm string
+	scopeNot  struct{ expr ScopeExpr }
+	scopeAnd  struct{ left, right ScopeExpr }
+	scopeOr   struct{ left, right ScopeExpr }
+)
+
+func (t scopeTerm) Allows(granted []string) bool {
+	for _, g := range granted {
+		if scopeCovers(g, string(t)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e scopeNot) Allows(granted []string) bool { return !e.expr.Allows(granted) }
+func (e scopeAnd) Allows(granted []string) bool {
+	return e.left.Allows(granted) && e.right.Allows(granted)
+}
+func (e scopeOr) Allows(granted []string) bool {
+	return e.left.Allows(granted) || e.right.Allows(granted)
+}
+
+func (t scopeTerm) String() string { return string(t) }
+func (e scopeNot) String() string  { return "NOT " + wrapScope(e.expr, false) }
+func (e scopeAnd) String() string {
+	return wrapScope(e.left, true) + " AND " + wrapScope(e.right, true)
+}
+func (e scopeOr) String() string { return e.left.String() + " OR " + e.right.String() }
+
+// wrapScope parenthesizes operands that bind less tightly than their operator.
+func wrapScope(expr ScopeExpr, inAnd bool) string {
+	switch expr.(type) {
+	case scopeOr:
+		return "(" + expr.String() + ")"
+	case scopeAnd:
+		if !inAnd {
+			return "(" + expr.String() + ")"
+		}
+	}
+	return expr.String()
+}
+
+// scopeCovers reports whether the granted scope satisfies the required one.
+func scopeCovers(granted, required string) bool {
+	g := strings.Split(granted, ":")
+	r := strings.Split(required, ":")
+	for i := range r {
+		switch {
+		case i >= len(g), g[i] == "*":
+			return true
+		case r[i] == "*":
+			if i == len(r)-1 {
+				return true
+			}
+		case g[i] != r[i]:
+			return false
+		}
+	}
+	return len(g) == len(r)
+}
+
+func tokenizeScopes(s string) []string {
+	var tokens []string
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '(' || c == ')' || c == '!':
+			tokens = append(tokens, s[i:i+1])
+			i++
+		case strings.HasPrefix(s[i:], "&&") || strings.HasPrefix(s[i:], "||"):
+			tokens = append(tokens, s[i:i+2])
+			i += 2
+		default:
+			j := i
+			for j < len(s) && !strings.ContainsRune(" \t\n()!&|", rune(s[j])) {
+				j++
+			}
+			if j == i {
+				// A lone & or |.
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		}
+	}
+	return tokens
+}
+
+type scopeParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *scopeParser) peek() (string, bool) {
+	if p.pos >= len(p.tokens) {
+		return "", false
+	}
+	return p.tokens[p.pos], true
+}
+
+// accept consumes the next token if it is one of the given operators.
+func (p *scopeParser) accept(ops ...string) bool {
+	tok, ok := p.peek()
+	if !ok {
+		return false
+	}
+	for _, op := range ops {
+		if tok == op {
+			p.pos++
+			return true
+		}
+	}
+	return false
+}
+
+func (p *scopeParser) parseOr() (ScopeExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("OR", "||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = scopeOr{left, right}
+	}
+	return left, nil
+}
+
+func (p *scopeParser) parseAnd() (ScopeExpr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("AND", "&&") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = scopeAnd{left, right}
+	}
+	return left, nil
+}
+
+func (p *scopeParser) parseNot() (ScopeExpr, error) {
+	if p.accept("NOT", "!") {
+		expr, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return scopeNot{expr}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *scopeParser) parsePrimary() (ScopeExpr, error) {
+	tok, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	if p.accept("(") {
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		return expr, nil
+	}
+	switch tok {
+	case ")", "AND", "OR", "NOT", "&&", "||", "&", "|":
+		return nil, fmt.Errorf("unexpected %q", tok)
+	}
+	p.pos++
+	return scopeTerm(tok), nil
+}
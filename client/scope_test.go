@@ -0,0 +1,185 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testScopes = []string{"meters", "meters:read", "meters:write", "meters:*", "subjects:read", "admin", "*"}
+
+// randomScopeExpr returns a random expression string of at most depth levels,
+// using both the word and the symbolic operators.
+func randomScopeExpr(r *rand.Rand, depth int) string {
+	if depth == 0 || r.Intn(3) == 0 {
+		return testScopes[r.Intn(len(testScopes))]
+	}
+	x, y := randomScopeExpr(r, depth-1), randomScopeExpr(r, depth-1)
+	switch r.Intn(6) {
+	case 0:
+		return "NOT " + x
+	case 1:
+		return "!(" + x + ")"
+	case 2:
+		return x + " AND " + y
+	case 3:
+		return "(" + x + ") && (" + y + ")"
+	case 4:
+		return x + " OR " + y
+	default:
+		return "(" + x + " || " + y + ")"
+	}
+}
+
+// randomGrants returns a random subset of the test scopes.
+func randomGrants(r *rand.Rand) []string {
+	var granted []string
+	for _, s := range testScopes {
+		if r.Intn(3) == 0 {
+			granted = append(granted, s)
+		}
+	}
+	return granted
+}
+
+// assertEquivalent checks that a and b agree on random grants.
+func assertEquivalent(t *testing.T, r *rand.Rand, a, b ScopeExpr) {
+	t.Helper()
+	for i := 0; i < 50; i++ {
+		granted := randomGrants(r)
+		if !assert.Equal(t, a.Allows(granted), b.Allows(granted), "%s vs %s with %v", a, b, granted) {
+			return
+		}
+	}
+}
+
+func TestScopeExprRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		s := randomScopeExpr(r, 4)
+		expr, err := ParseScopeExpr(s)
+		require.NoError(t, err, s)
+
+		printed := expr.String()
+		reparsed, err := ParseScopeExpr(printed)
+		require.NoError(t, err, printed)
+		assert.Equal(t, printed, reparsed.String(), "canonical form of %q is not stable", s)
+		assertEquivalent(t, r, expr, reparsed)
+	}
+}
+
+func TestScopeExprDeMorgan(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	for i := 0; i < 300; i++ {
+		x, y := randomScopeExpr(r, 3), randomScopeExpr(r, 3)
+		laws := [][2]string{
+			{"NOT ((" + x + ") AND (" + y + "))", "(NOT (" + x + ")) OR (NOT (" + y + "))"},
+			{"NOT ((" + x + ") OR (" + y + "))", "(NOT (" + x + ")) AND (NOT (" + y + "))"},
+			{"NOT NOT (" + x + ")", x},
+		}
+		for _, law := range laws {
+			assertEquivalent(t, r, MustParseScopeExpr(law[0]), MustParseScopeExpr(law[1]))
+		}
+	}
+}
+
+func TestScopeExprPrecedence(t *testing.T) {
+	for s, want := range map[string]string{
+		"a OR b AND c":               "a OR b AND c",
+		"(a OR b) AND c":             "(a OR b) AND c",
+		"NOT a AND b":                "NOT a AND b",
+		"NOT (a AND b)":              "NOT (a AND b)",
+		"!a && (b || c)":             "NOT a AND (b OR c)",
+		"((meters:read))":            "meters:read",
+		"meters:* && !meters:delete": "meters:* AND NOT meters:delete",
+	} {
+		expr, err := ParseScopeExpr(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, want, expr.String(), s)
+	}
+}
+
+func TestScopeExprOperatorsAreUpperCase(t *testing.T) {
+	for s, want := range map[string]string{
+		"and AND or":       "and AND or",
+		"NOT not":          "NOT not",
+		"a and b":          "",
+		"Or":               "Or",
+		"reports:and OR x": "reports:and OR x",
+	} {
+		expr, err := ParseScopeExpr(s)
+		if want == "" {
+			assert.Error(t, err, "%q", s)
+			continue
+		}
+		require.NoError(t, err, s)
+		assert.Equal(t, want, expr.String(), s)
+	}
+
+	expr := MustParseScopeExpr("and AND NOT not")
+	assert.True(t, expr.Allows([]string{"and"}))
+	assert.False(t, expr.Allows([]string{"and", "not"}))
+	assert.False(t, expr.Allows([]string{"or"}))
+}
+
+func TestParseScopeExprErrors(t *testing.T) {
+	for _, s := range []string{"", "a AND", "(a", "a)", "AND a", "a & b", "NOT", "a OR OR b"} {
+		_, err := ParseScopeExpr(s)
+		assert.Error(t, err, "%q", s)
+	}
+}
+
+func TestScopeCovers(t *testing.T) {
+	for _, tc := range []struct {
+		granted, required string
+		want              bool
+	}{
+		{"meters", "meters:read", true},
+		{"meters:read", "meters", false},
+		{"meters:*", "meters:read:all", true},
+		{"*", "admin", true},
+		{"meters:read", "meters:*", true},
+		{"subjects:read", "meters:*", false},
+		{"meters:read", "meters:write", false},
+	} {
+		assert.Equal(t, tc.want, scopeCovers(tc.granted, tc.required), "%s covers %s", tc.granted, tc.required)
+	}
+}
+
+func TestValidateScopeExprDeniesWithoutGrantedScopes(t *testing.T) {
+	noScopes := func(context.Context, string, []string) (*ValidationResult, error) {
+		return &ValidationResult{Valid: true, Subject: "acme"}, nil
+	}
+
+	res, err := ValidateScopeExpr(context.Background(), noScopes, "key", MustParseScopeExpr("NOT admin"))
+	assert.False(t, res.Valid)
+	assert.True(t, errors.Is(err, ErrMissingScopes), "%v", err)
+
+	// Flat expressions are checked by Meterus.
+	res, err = ValidateScopeExpr(context.Background(), noScopes, "key", MustParseScopeExpr("meters:read AND subjects:read"))
+	assert.True(t, res.Valid)
+	assert.NoError(t, err)
+}
+
+func TestValidateScopeExprEvaluatesGrantedScopes(t *testing.T) {
+	granted := func(_ context.Context, _ string, required []string) (*ValidationResult, error) {
+		assert.Empty(t, required)
+		return &ValidationResult{Valid: true, Scopes: []string{"meters:read"}}, nil
+	}
+
+	res, err := ValidateScopeExpr(context.Background(), granted, "key", MustParseScopeExpr("meters:* AND NOT admin"))
+	assert.True(t, res.Valid)
+	assert.NoError(t, err)
+
+	res, err = ValidateScopeExpr(context.Background(), granted, "key", MustParseScopeExpr("admin OR meters:write"))
+	assert.False(t, res.Valid)
+	var e *Error
+	require.True(t, errors.As(err, &e))
+	assert.Equal(t, "ValidateApiKey", e.Method)
+	assert.True(t, strings.Contains(err.Error(), "admin OR meters:write"))
+}
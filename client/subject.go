@@ -4,6 +4,7 @@ import (
 	"context"
 
 	subject "github.com/elliot14A/meterus-go/subject/v1"
+	"google.golang.org/grpc"
 )
 
 type SubjectService struct {
@@ -12,9 +13,15 @@ type SubjectService struct {
 }
 
 func (c *Client) NewSubjectService() *SubjectService {
+	return NewSubjectServiceFromConn(c.conn, c.apiKey)
+}
+
+// NewSubjectServiceFromConn creates a SubjectService calling Meterus over
+// conn, such as a connection not managed by a Client.
+func NewSubjectServiceFromConn(conn grpc.ClientConnInterface, apiKey string) *SubjectService {
 	return &SubjectService{
-		client: subject.NewSubjectServiceClient(c.conn),
-		apiKey: c.apiKey,
+		client: subject.NewSubjectServiceClient(conn),
+		apiKey: apiKey,
 	}
 }
 
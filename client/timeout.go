@@ -0,0 +1,193 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	meter "github.com/elliot14A/meterus-go/meters/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// TimeoutPolicy gives calls made without a deadline a default one, so that
+// callers passing context.Background() do not wait forever on a degraded
+// Meterus. Calls whose context already has a deadline keep it. It also reports
+// every exceeded deadline as a *Error with code DeadlineExceeded naming the
+// method. NewMeterusClient and the endpoints of NewBalancedMeterusClient
+// install a policy with the default timeouts unless given one with DialOption,
+// and NewMeterusConnectClient installs one inside the interceptors it is given.
+// A call only gets the timeouts of the outermost policy:
+//
+//	timeouts := client.NewTimeoutPolicy(client.WithDefaultTimeout(5 * time.Second))
+//	c, err := client.NewMeterusClient(addr, apiKey, timeouts.DialOption())
+type TimeoutPolicy struct {
+	now      func() time.Time
+	fallback time.Duration
+	methods  map[string]time.Duration
+	// longQuery and longQuerySpan are the timeout of the QueryMeter calls
+	// spanning more than longQuerySpan.
+	longQuery     time.Duration
+	longQuerySpan time.Duration
+}
+
+// Default timeouts of a TimeoutPolicy.
+const (
+	// DefaultTimeout is the timeout of the calls to methods without a
+	// timeout of their own.
+	DefaultTimeout = 10 * time.Second
+	// DefaultQueryTimeout is the timeout of QueryMeter calls.
+	DefaultQueryTimeout = 30 * time.Second
+	// DefaultLongQueryTimeout is the timeout of QueryMeter calls spanning
+	// more than DefaultLongQuerySpan.
+	DefaultLongQueryTimeout = 2 * time.Minute
+	DefaultLongQuerySpan    = 31 * 24 * time.Hour
+)
+
+// TimeoutOption configures a TimeoutPolicy.
+type TimeoutOption func(*TimeoutPolicy)
+
+// WithDefaultTimeout sets the timeout of the calls to methods without a timeout
+// of their own. It defaults to DefaultTimeout; zero leaves such calls without
+// a deadline.
+func WithDefaultTimeout(d time.Duration) TimeoutOption {
+	return func(p *TimeoutPolicy) {
+		p.fallback = d
+	}
+}
+
+// WithMethodTimeout sets the timeout of the calls to a method, given by its
+// full name, such as "/meterus.meter.v1.MeteringService/ListMeters", or its
+// bare name, such as "ListMeters". Zero leaves the calls without a deadline.
+func WithMethodTimeout(method string, d time.Duration) TimeoutOption {
+	return func(p *TimeoutPolicy) {
+		p.methods[method] = d
+	}
+}
+
+// WithLongQueryTimeout sets the timeout of the QueryMeter calls whose time range
+// spans more than span, or has no start. Other QueryMeter calls get the
+// timeout of QueryMeter. It defaults to DefaultLongQueryTimeout for queries
+// spanning more than DefaultLongQuerySpan; zero gives all QueryMeter calls the
+// timeout of QueryMeter.
+func WithLongQueryTimeout(span, d time.Duration) TimeoutOption {
+	return func(p *TimeoutPolicy) {
+		p.longQuerySpan = span
+		p.longQuery = d
+	}
+}
+
+// NewTimeoutPolicy returns a TimeoutPolicy with the default timeouts, changed
+// by the given options.
+func NewTimeoutPolicy(opts ...TimeoutOption) *TimeoutPolicy {
+	p := &TimeoutPolicy{
+		now:      time.Now,
+		fallback: DefaultTimeout,
+		methods: map[string]time.Duration{
+			"QueryMeter": DefaultQueryTimeout,
+		},
+		longQuery:     DefaultLongQueryTimeout,
+		longQuerySpan: DefaultLongQuerySpan,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Timeout returns the timeout the policy gives a call to the full method name
+// with req, or 0 if it has none.
+func (p *TimeoutPolicy) Timeout(method string, req any) time.Duration {
+	if p.longQuery > 0 {
+		if q, ok := req.(*meter.QueryMeterRequest); ok && p.isLongQuery(q) {
+			return p.longQuery
+		}
+	}
+	if d, ok := p.methods[method]; ok {
+		return d
+	}
+	if d, ok := p.methods[bareMethod(method)]; ok {
+		return d
+	}
+	return p.fallback
+}
+
+// isLongQuery reports whether q spans more than the long query span. Queries
+// without an end run until now.
+func (p *TimeoutPolicy) isLongQuery(q *meter.QueryMeterRequest) bool {
+	if q.GetFrom() == nil {
+		return true
+	}
+	to := p.now()
+	if q.GetTo() != nil {
+		to = q.GetTo().AsTime()
+	}
+	return to.Sub(q.GetFrom().AsTime()) > p.longQuerySpan
+}
+
+// DialOption returns an option installing the policy on a client created with
+// NewMeterusClient, in place of the default one.
+func (p *TimeoutPolicy) DialOption() grpc.DialOption {
+	return timeoutDialOption{grpc.WithChainUnaryInterceptor(p.UnaryClientInterceptor())}
+}
+
+// timeoutDialOption installs a TimeoutPolicy and marks the options of a
+// client as having one.
+type timeoutDialOption struct {
+	grpc.DialOption
+}
+
+// withDefaultTimeouts appends a policy with the default timeouts to opts,
+// unless they install one already.
+func withDefaultTimeouts(opts []grpc.DialOption) []grpc.DialOption {
+	for _, opt := range opts {
+		if _, ok := opt.(timeoutDialOption); ok {
+			return opts
+		}
+	}
+	return append(opts, NewTimeoutPolicy().DialOption())
+}
+
+// timeoutPolicyKey marks the context of a call a TimeoutPolicy applies to, so
+// that policies further in leave the call be.
+type timeoutPolicyKey struct{}
+
+// UnaryClientInterceptor returns an interceptor applying the timeouts to unary
+// calls, for clients that do not take a DialOption, such as one created with
+// NewMeterusConnectClient and connect.WithUnaryInterceptors.
+func (p *TimeoutPolicy) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if ctx.Value(timeoutPolicyKey{}) != nil {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		ctx = context.WithValue(ctx, timeoutPolicyKey{}, p)
+		callCtx := ctx
+		timeout := time.Duration(0)
+		if _, ok := ctx.Deadline(); !ok {
+			timeout = p.Timeout(method, req)
+		}
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			callCtx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		err := invoker(callCtx, method, req, reply, cc, opts...)
+		if status.Code(err) != codes.DeadlineExceeded {
+			return err
+		}
+		var e *Error
+		if errors.As(err, &e) {
+			return err
+		}
+		name := bareMethod(method)
+		if timeout > 0 && ctx.Err() == nil && callCtx.Err() == context.DeadlineExceeded {
+			return newError(name, codes.DeadlineExceeded, fmt.Errorf("%w: no reply within the default timeout of %s", context.DeadlineExceeded, timeout))
+		}
+		if ctx.Err() == context.DeadlineExceeded {
+			return newError(name, codes.DeadlineExceeded, ctx.Err())
+		}
+		return newError(name, codes.DeadlineExceeded, err)
+	}
+}
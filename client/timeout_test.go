@@ -0,0 +1,163 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/elliot14A/meterus-go/client"
+	"github.com/elliot14A/meterus-go/connect"
+	meter "github.com/elliot14A/meterus-go/meters/v1"
+	"github.com/elliot14A/meterus-go/meterustest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// deadlineRecorder records the time left before the deadline of the last call
+// a server received, or zero if it had none.
+type deadlineRecorder struct {
+	left chan time.Duration
+}
+
+func newDeadlineRecorder() *deadlineRecorder {
+	return &deadlineRecorder{left: make(chan time.Duration, 16)}
+}
+
+func (r *deadlineRecorder) interceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		var left time.Duration
+		if deadline, ok := ctx.Deadline(); ok {
+			left = time.Until(deadline)
+		}
+		r.left <- left
+		return handler(ctx, req)
+	}
+}
+
+func TestTimeoutPolicyDefaults(t *testing.T) {
+	p := client.NewTimeoutPolicy()
+	assert.Equal(t, client.DefaultTimeout, p.Timeout(meter.MeteringService_ListMeters_FullMethodName, &meter.ListMetersRequest{}))
+	assert.Equal(t, client.DefaultQueryTimeout, p.Timeout(meter.MeteringService_QueryMeter_FullMethodName, &meter.QueryMeterRequest{
+		From: timestamppb.New(time.Now().Add(-time.Hour)),
+	}))
+	assert.Equal(t, client.DefaultLongQueryTimeout, p.Timeout(meter.MeteringService_QueryMeter_FullMethodName, &meter.QueryMeterRequest{
+		From: timestamppb.New(time.Now().Add(-90 * 24 * time.Hour)),
+	}))
+	assert.Equal(t, client.DefaultLongQueryTimeout, p.Timeout(meter.MeteringService_QueryMeter_FullMethodName, &meter.QueryMeterRequest{}),
+		"queries without a start are long")
+
+	p = client.NewTimeoutPolicy(client.WithDefaultTimeout(0), client.WithMethodTimeout("QueryMeter", 0), client.WithLongQueryTimeout(0, 0))
+	assert.Zero(t, p.Timeout(meter.MeteringService_ListMeters_FullMethodName, nil))
+	assert.Zero(t, p.Timeout(meter.MeteringService_QueryMeter_FullMethodName, &meter.QueryMeterRequest{}))
+}
+
+func TestNewMeterusClientInstallsDefaultTimeouts(t *testing.T) {
+	deadlines := newDeadlineRecorder()
+	srv, _ := newServer(t, meterustest.WithServerOptions(grpc.ChainUnaryInterceptor(deadlines.interceptor())))
+	c := newClient(t, srv)
+
+	_, err := c.NewMeteringService().ListMeters(context.Background(), 10, 1)
+	require.NoError(t, err)
+	left := <-deadlines.left
+	assert.Greater(t, left, client.DefaultTimeout-time.Second, "calls without a deadline must get the default timeout")
+	assert.LessOrEqual(t, left, client.DefaultTimeout)
+
+	_, err = c.NewMeteringService().QueryMeter(context.Background(), &meter.QueryMeterRequest{MeterIdOrSlug: "requests"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	left = <-deadlines.left
+	assert.Greater(t, left, client.DefaultLongQueryTimeout-time.Second, "open-ended queries must get the long query timeout")
+}
+
+func TestNewBalancedMeterusClientInstallsDefaultTimeouts(t *testing.T) {
+	deadlines := newDeadlineRecorder()
+	srv, _ := newServer(t, meterustest.WithServerOptions(grpc.ChainUnaryInterceptor(deadlines.interceptor())))
+	addr := srv.ServeLoopback()
+
+	c := balancedClient(t, []string{addr})
+	_, err := c.NewMeteringService().ListMeters(context.Background(), 10, 1)
+	require.NoError(t, err)
+	left := <-deadlines.left
+	assert.Greater(t, left, client.DefaultTimeout-time.Second, "calls without a deadline must get the default timeout")
+	assert.LessOrEqual(t, left, client.DefaultTimeout)
+
+	timeouts := client.NewTimeoutPolicy(client.WithDefaultTimeout(time.Second))
+	c = balancedClient(t, []string{addr}, client.WithEndpointDialOptions(timeouts.DialOption()))
+	_, err = c.NewMeteringService().ListMeters(context.Background(), 10, 1)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, <-deadlines.left, time.Second, "a policy given by the caller must replace the defaults")
+}
+
+func TestNewMeterusConnectClientInstallsDefaultTimeouts(t *testing.T) {
+	srv, _ := newServer(t)
+	handler := srv.ConnectHandler()
+	timeouts := make(chan string, 16)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timeouts <- r.Header.Get("Connect-Timeout-Ms")
+		handler.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	c, err := client.NewMeterusConnectClient(ts.URL, "key")
+	require.NoError(t, err)
+	defer c.Close()
+	_, err = c.NewMeteringService().ListMeters(context.Background(), 10, 1)
+	require.NoError(t, err)
+	ms, err := strconv.Atoi(<-timeouts)
+	require.NoError(t, err, "calls without a deadline must get the default timeout")
+	assert.InDelta(t, client.DefaultTimeout.Milliseconds(), ms, 1000)
+
+	policy := client.NewTimeoutPolicy(client.WithDefaultTimeout(0))
+	c, err = client.NewMeterusConnectClient(ts.URL, "key", connect.WithUnaryInterceptors(policy.UnaryClientInterceptor()))
+	require.NoError(t, err)
+	defer c.Close()
+	_, err = c.NewMeteringService().ListMeters(context.Background(), 10, 1)
+	require.NoError(t, err)
+	assert.Empty(t, <-timeouts, "a policy given by the caller must replace the defaults")
+}
+
+func TestTimeoutPolicyFailsCallsWithoutDeadline(t *testing.T) {
+	srv, faults := newServer(t)
+	faults.Add(meterustest.FaultRule{Method: "ListMeters", Latency: time.Second})
+	timeouts := client.NewTimeoutPolicy(client.WithMethodTimeout("ListMeters", 50*time.Millisecond))
+	c := newClient(t, srv, timeouts.DialOption())
+
+	start := time.Now()
+	_, err := c.NewMeteringService().ListMeters(context.Background(), 10, 1)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	var e *client.Error
+	require.True(t, errors.As(err, &e), "got %v", err)
+	assert.Equal(t, "ListMeters", e.Method)
+	assert.Equal(t, codes.DeadlineExceeded, e.Code)
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestTimeoutPolicyKeepsCallerDeadline(t *testing.T) {
+	deadlines := newDeadlineRecorder()
+	srv, faults := newServer(t, meterustest.WithServerOptions(grpc.ChainUnaryInterceptor(deadlines.interceptor())))
+	faults.Add(meterustest.FaultRule{Method: "ListMeters", Latency: 200 * time.Millisecond})
+	timeouts := client.NewTimeoutPolicy(client.WithDefaultTimeout(50 * time.Millisecond))
+	c := newClient(t, srv, timeouts.DialOption())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := c.NewMeteringService().ListMeters(ctx, 10, 1)
+	require.NoError(t, err, "a deadline set by the caller must not be shortened")
+	assert.Greater(t, <-deadlines.left, 4*time.Second)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = c.NewMeteringService().ListMeters(ctx, 10, 1)
+	var e *client.Error
+	require.True(t, errors.As(err, &e), "got %v", err)
+	assert.Equal(t, "ListMeters", e.Method)
+	assert.Equal(t, codes.DeadlineExceeded, e.Code)
+}
@@ -0,0 +1,87 @@
+package client
+
+import (
+	"fmt"
+	"time"
+
+	meter "github.com/elliot14A/meterus-go/meters/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/proto"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// EventTimePolicy guards the ingest path against events dated by a host with
+// a bad clock. The zero value accepts every event unchanged.
+type EventTimePolicy struct {
+	// MaxFuture is how far ahead of the current time an event may be dated.
+	// Zero disables the check.
+	MaxFuture time.Duration
+	// ClampFuture moves events dated beyond MaxFuture to the current time
+	// instead of rejecting them.
+	ClampFuture bool
+	// LateCutoff is the age after which an event is flagged as a late
+	// arrival. Zero disables the check.
+	LateCutoff time.Duration
+	// RejectLate rejects late arrivals instead of only flagging them.
+	RejectLate bool
+	// StampTime replaces the time of every event with the current time.
+	StampTime bool
+	// Clock returns the current time. It defaults to time.Now and may be set
+	// to a clock synchronized with the Meterus server.
+	Clock func() time.Time
+	// OnViolation, if set, is called for every event that breaks the policy,
+	// whether it is rejected, clamped or only flagged.
+	OnViolation func(event *meter.CloudEvent, err error)
+}
+
+// WithEventTimePolicy applies policy to every event sent through Ingest and
+// IngestAsync.
+func WithEventTimePolicy(policy EventTimePolicy) MeteringOption {
+	return func(m *MeteringService) {
+		m.timePolicy = &policy
+	}
+}
+
+// apply checks the event against the policy for the client method named
+// method. It returns the event to send, which is a copy if its time had to
+// change, or an *Error naming method if it is rejected.
+func (p *EventTimePolicy) apply(method string, event *meter.CloudEvent) (*meter.CloudEvent, error) {
+	now := time.Now()
+	if p.Clock != nil {
+		now = p.Clock()
+	}
+
+	if p.StampTime {
+		event = proto.Clone(event).(*meter.CloudEvent)
+		event.Time = timestamppb.New(now)
+		return event, nil
+	}
+	if event.Time == nil {
+		return event, nil
+	}
+
+	t := event.Time.AsTime()
+	switch {
+	case p.MaxFuture > 0 && t.Sub(now) > p.MaxFuture:
+		err := newError(method, codes.InvalidArgument, fmt.Errorf("%w: %s is %s ahead", ErrEventInFuture, t.Format(time.RFC3339), t.Sub(now).Round(time.Second)))
+		p.report(event, err)
+		if !p.ClampFuture {
+			return nil, err
+		}
+		event = proto.Clone(event).(*meter.CloudEvent)
+		event.Time = timestamppb.New(now)
+	case p.LateCutoff > 0 && now.Sub(t) > p.LateCutoff:
+		err := newError(method, codes.InvalidArgument, fmt.Errorf("%w: %s is %s old", ErrEventTooOld, t.Format(time.RFC3339), now.Sub(t).Round(time.Second)))
+		p.report(event, err)
+		if p.RejectLate {
+			return nil, err
+		}
+	}
+	return event, nil
+}
+
+func (p *EventTimePolicy) report(event *meter.CloudEvent, err error) {
+	if p.OnViolation != nil {
+		p.OnViolation(event, err)
+	}
+}
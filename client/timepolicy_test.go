@@ -0,0 +1,146 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/elliot14A/meterus-go/client"
+	meter "github.com/elliot14A/meterus-go/meters/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+// violation is an event reported to EventTimePolicy.OnViolation.
+type violation struct {
+	id  string
+	err error
+}
+
+func TestEventTimePolicy(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		policy client.EventTimePolicy
+		at     time.Time
+		// err is the error the event is rejected with, if any.
+		err error
+		// sent is the time the event is sent with if it is accepted.
+		sent time.Time
+		// violation is the error reported to OnViolation, if any.
+		violation error
+	}{
+		{
+			name:   "within limits",
+			policy: client.EventTimePolicy{MaxFuture: time.Minute, LateCutoff: time.Hour},
+			at:     now.Add(-30 * time.Minute),
+			sent:   now.Add(-30 * time.Minute),
+		},
+		{
+			name:      "future rejected",
+			policy:    client.EventTimePolicy{MaxFuture: time.Minute},
+			at:        now.Add(2 * time.Minute),
+			err:       client.ErrEventInFuture,
+			violation: client.ErrEventInFuture,
+		},
+		{
+			name:      "future clamped",
+			policy:    client.EventTimePolicy{MaxFuture: time.Minute, ClampFuture: true},
+			at:        now.Add(2 * time.Minute),
+			sent:      now,
+			violation: client.ErrEventInFuture,
+		},
+		{
+			name:      "late flagged",
+			policy:    client.EventTimePolicy{LateCutoff: time.Hour},
+			at:        now.Add(-2 * time.Hour),
+			sent:      now.Add(-2 * time.Hour),
+			violation: client.ErrEventTooOld,
+		},
+		{
+			name:      "late rejected",
+			policy:    client.EventTimePolicy{LateCutoff: time.Hour, RejectLate: true},
+			at:        now.Add(-2 * time.Hour),
+			err:       client.ErrEventTooOld,
+			violation: client.ErrEventTooOld,
+		},
+		{
+			name:   "stamped",
+			policy: client.EventTimePolicy{StampTime: true, MaxFuture: time.Minute},
+			at:     now.Add(48 * time.Hour),
+			sent:   now,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var violations []violation
+			policy := tt.policy
+			policy.Clock = func() time.Time { return now }
+			policy.OnViolation = func(event *meter.CloudEvent, err error) {
+				violations = append(violations, violation{id: event.Id, err: err})
+			}
+			srv, _ := newServer(t)
+			metering := newClient(t, srv).NewMeteringService(client.WithEventTimePolicy(policy))
+
+			event := newEvent(t, "evt-1", "acme", tt.at, nil)
+			err := metering.Ingest(context.Background(), event)
+			assert.True(t, event.Time.AsTime().Equal(tt.at), "the caller's event must not be modified")
+
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				var e *client.Error
+				require.True(t, errors.As(err, &e))
+				assert.Equal(t, "Ingest", e.Method)
+				assert.Equal(t, codes.InvalidArgument, e.Code)
+				assert.Empty(t, srv.Events(), "rejected events must not be sent")
+			} else {
+				require.NoError(t, err)
+				events := srv.Events()
+				require.Len(t, events, 1)
+				assert.True(t, events[0].Time.AsTime().Equal(tt.sent), "sent with %s, want %s", events[0].Time.AsTime(), tt.sent)
+			}
+
+			if tt.violation == nil {
+				assert.Empty(t, violations)
+				return
+			}
+			require.Len(t, violations, 1)
+			assert.Equal(t, "evt-1", violations[0].id)
+			assert.ErrorIs(t, violations[0].err, tt.violation)
+		})
+	}
+}
+
+func TestEventTimePolicyStampsEventsWithoutTime(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	srv, _ := newServer(t)
+	metering := newClient(t, srv).NewMeteringService(client.WithEventTimePolicy(client.EventTimePolicy{
+		StampTime: true,
+		Clock:     func() time.Time { return now },
+	}))
+
+	event := &meter.CloudEvent{Id: "evt-1", Source: "policy-test", SpecVersion: "1.0", Type: "request", Subject: "acme"}
+	require.NoError(t, metering.Ingest(context.Background(), event))
+	assert.Nil(t, event.Time)
+	events := srv.Events()
+	require.Len(t, events, 1)
+	assert.True(t, events[0].Time.AsTime().Equal(now))
+}
+
+func TestEventTimePolicyIgnoresEventsWithoutTime(t *testing.T) {
+	called := false
+	srv, _ := newServer(t)
+	metering := newClient(t, srv).NewMeteringService(client.WithEventTimePolicy(client.EventTimePolicy{
+		MaxFuture:   time.Minute,
+		LateCutoff:  time.Hour,
+		RejectLate:  true,
+		OnViolation: func(*meter.CloudEvent, error) { called = true },
+	}))
+
+	event := &meter.CloudEvent{Id: "evt-1", Source: "policy-test", SpecVersion: "1.0", Type: "request", Subject: "acme"}
+	require.NoError(t, metering.Ingest(context.Background(), event))
+	assert.Len(t, srv.Events(), 1)
+	assert.False(t, called)
+}
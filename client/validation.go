@@ -2,27 +2,156 @@ package client
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
 
+	meter "github.com/elliot14A/meterus-go/meters/v1"
 	validation "github.com/elliot14A/meterus-go/validation/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	structpb "google.golang.org/protobuf/types/known/structpb"
 )
 
 type ValidationService struct {
 	client validation.ValidationServiceClient
+	apiKey string
 }
 
 func (c *Client) NewValidationService() *ValidationService {
+	return NewValidationServiceFromConn(c.conn, c.apiKey)
+}
+
+// NewValidationServiceFromConn creates a ValidationService calling Meterus
+// over conn, such as a connection not managed by a Client. apiKey
+// authenticates the API key management calls.
+func NewValidationServiceFromConn(conn grpc.ClientConnInterface, apiKey string) *ValidationService {
 	return &ValidationService{
-		client: validation.NewValidationServiceClient(c.conn),
+		client: validation.NewValidationServiceClient(conn),
+		apiKey: apiKey,
+	}
+}
+
+// ValidationResult is the outcome of validating an API key.
+type ValidationResult struct {
+	// Valid reports whether the key is valid and grants the required scopes.
+	Valid bool
+	// Subject is the subject the key belongs to.
+	Subject string
+	// Scopes are the scopes granted to the key.
+	Scopes []string
+	// MissingScopes are the required scopes the key does not grant.
+	MissingScopes []string
+	// Attributes are the additional attributes stored with the key.
+	Attributes *structpb.Struct
+}
+
+// DecodeAttributes decodes the additional attributes of the key into v, which
+// must be a pointer, following the rules of encoding/json.
+func (r *ValidationResult) DecodeAttributes(v any) error {
+	if r.Attributes == nil {
+		return nil
 	}
+	b, err := protojson.Marshal(r.Attributes)
+	if err != nil {
+		return fmt.Errorf("failed to encode additional attributes: %w", err)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("failed to decode additional attributes: %w", err)
+	}
+	return nil
 }
 
-func (v *ValidationService) ValidateApiKey(ctx context.Context, apiKey string, scopes []string) (bool, string, any, error) {
+// ValidateApiKey validates apiKey and checks that it grants the required
+// scopes. An unknown or expired key yields a result with Valid set to false
+// and a nil error. A known key lacking some of the scopes yields its result
+// together with an *Error wrapping ErrMissingScopes, as does a validation
+// Meterus denies with PermissionDenied listing the missing scopes. Other
+// failures yield a nil result and an *Error.
+func (v *ValidationService) ValidateApiKey(ctx context.Context, apiKey string, scopes []string) (*ValidationResult, error) {
 	ctx = AddApiKeyAuthorizationHeader(ctx, apiKey)
 	res, err := v.client.ValidateApiKey(ctx, &validation.ValidateApiKeyRequest{
 		RequiredScopes: scopes,
 	})
+	return validationResult("ValidateApiKey", res, err)
+}
+
+// ValidateAndMeter validates apiKey like ValidateApiKey and, if it is valid,
+// ingests event on behalf of its subject in a single round trip. Events
+// without a subject are billed to the subject of the key; Meterus denies
+// events for another subject with PermissionDenied. The event is not recorded
+// if the key is invalid or lacks some of the scopes. A reply
+// without a validation result yields an *Error wrapping ErrNoValidationResult.
+func (v *ValidationService) ValidateAndMeter(ctx context.Context, apiKey string, scopes []string, event *meter.CloudEvent) (*ValidationResult, error) {
+	if event == nil {
+		return nil, newError("ValidateAndMeter", codes.InvalidArgument, errors.New("event is required"))
+	}
+	ctx = AddApiKeyAuthorizationHeader(ctx, apiKey)
+	res, err := v.client.ValidateAndMeter(ctx, &validation.ValidateAndMeterRequest{
+		RequiredScopes: scopes,
+		Event:          event,
+	})
+	if err == nil && isEmptyResponse(res) {
+		return nil, newError("ValidateAndMeter", codes.Unimplemented, ErrNoValidationResult)
+	}
+	return validationResult("ValidateAndMeter", res, err)
+}
+
+// missingScopes returns the missing scopes listed in the "missing_scopes"
+// metadata of an ErrorInfo with reason MISSING_SCOPES attached to a status,
+// if any.
+func missingScopes(s *status.Status) []string {
+	for _, d := range s.Details() {
+		if info, ok := d.(*errdetails.ErrorInfo); ok && info.GetReason() == "MISSING_SCOPES" {
+			if list := info.GetMetadata()["missing_scopes"]; list != "" {
+				return strings.Split(list, ",")
+			}
+		}
+	}
+	return nil
+}
+
+// isEmptyResponse reports whether res says nothing about the key. Meterus
+// fails ValidateAndMeter calls with unknown keys, so an empty reply comes
+// from a server that does not return validation results.
+func isEmptyResponse(res *validation.ValidateApiKeyResponse) bool {
+	return !res.GetIsValid() && res.GetMetadata() == nil && len(res.GetMissingScopes()) == 0
+}
+
+func validationResult(method string, res *validation.ValidateApiKeyResponse, err error) (*ValidationResult, error) {
 	if err != nil {
-		return false, "", nil, err
+		switch status.Code(err) {
+		case codes.Unauthenticated:
+			return &ValidationResult{}, nil
+		case codes.PermissionDenied:
+			// Meterus denies validations of keys lacking required scopes
+			// with the list of missing scopes attached. Other denials, such
+			// as those of a proxy, say nothing about the key.
+			s := status.Convert(err)
+			if missing := missingScopes(s); len(missing) > 0 {
+				result := &ValidationResult{MissingScopes: missing}
+				return result, newError(method, codes.PermissionDenied, fmt.Errorf("%w: %s", ErrMissingScopes, s.Message()))
+			}
+		}
+		return nil, wrapError(method, err)
+	}
+	if res == nil {
+		return nil, newError(method, codes.Internal, errors.New("no response"))
+	}
+
+	result := &ValidationResult{
+		Valid:         res.IsValid,
+		Subject:       res.GetMetadata().GetSubject(),
+		Scopes:        res.GrantedScopes,
+		MissingScopes: res.MissingScopes,
+		Attributes:    res.GetMetadata().GetAdditionalAttributes(),
+	}
+	if !result.Valid && len(result.MissingScopes) > 0 {
+		return result, newError(method, codes.PermissionDenied, fmt.Errorf("%w: %v", ErrMissingScopes, result.MissingScopes))
 	}
-	return true, res.Metadata.Subject, res.Metadata.AdditionalAttributes, nil
+	return result, nil
 }
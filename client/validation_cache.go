@@ -0,0 +1,321 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+// CachingValidator validates API keys through a ValidationService and caches
+// the results in memory, so that repeated validations of the same key do not
+// cost a round trip each. Keys are only stored as SHA-256 hashes. Concurrent
+// validations of the same key and scopes share a single call.
+type CachingValidator struct {
+	service     *ValidationService
+	ttl         time.Duration
+	negativeTTL time.Duration
+	staleTTL    time.Duration
+	timeout     time.Duration
+	now         func() time.Time
+
+	mu        sync.Mutex
+	entries   map[[sha256.Size]byte]map[string]*cacheEntry
+	calls     map[string]*flight
+	lastSweep time.Time
+	// purges counts the calls to Purge and keyGens the calls to Invalidate
+	// for each key, so that lookups started before them are not cached.
+	// running counts the lookups in flight.
+	purges  uint64
+	keyGens map[[sha256.Size]byte]uint64
+	running int
+}
+
+// generation identifies the invalidations of a key a lookup started after.
+type generation struct {
+	purges, key uint64
+}
+
+type cacheEntry struct {
+	result  *ValidationResult
+	err     error
+	expires time.Time
+	// refreshing is set while a stale entry is revalidated in the background.
+	refreshing bool
+}
+
+type flight struct {
+	done   chan struct{}
+	gen    generation
+	result *ValidationResult
+	err    error
+}
+
+// CacheOption configures a CachingValidator.
+type CacheOption func(*CachingValidator)
+
+// WithCacheTTL sets how long valid keys are cached. It defaults to one minute.
+func WithCacheTTL(ttl time.Duration) CacheOption {
+	return func(c *CachingValidator) {
+		c.ttl = ttl
+	}
+}
+
+// WithNegativeCacheTTL sets how long invalid keys and keys missing scopes are
+// cached. It defaults to ten seconds.
+func WithNegativeCacheTTL(ttl time.Duration) CacheOption {
+	return func(c *CachingValidator) {
+		c.negativeTTL = ttl
+	}
+}
+
+// WithStaleWhileRevalidate keeps valid keys for window after they expire.
+// Within that window the stale result is returned immediately while it is
+// revalidated in the background, and it keeps being served if the Meterus
+// service cannot be reached. It is disabled by default.
+func WithStaleWhileRevalidate(window time.Duration) CacheOption {
+	return func(c *CachingValidator) {
+		c.staleTTL = window
+	}
+}
+
+// WithLookupTimeout bounds the calls to Meterus shared by concurrent
+// validations of a key. Each validation still returns as soon as its own
+// context is done. It defaults to ten seconds.
+func WithLookupTimeout(d time.Duration) CacheOption {
+	return func(c *CachingValidator) {
+		if d > 0 {
+			c.timeout = d
+		}
+	}
+}
+
+// NewCachingValidator returns a CachingValidator backed by v.
+func (v *ValidationService) NewCachingValidator(opts ...CacheOption) *CachingValidator {
+	c := &CachingValidator{
+		service:     v,
+		ttl:         time.Minute,
+		negativeTTL: 10 * time.Second,
+		timeout:     10 * time.Second,
+		now:         time.Now,
+		entries:     make(map[[sha256.Size]byte]map[string]*cacheEntry),
+		calls:       make(map[string]*flight),
+		keyGens:     make(map[[sha256.Size]byte]uint64),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// ValidateApiKey behaves like ValidationService.ValidateApiKey but answers
+// from the cache when it can.
+func (c *CachingValidator) ValidateApiKey(ctx context.Context, apiKey string, scopes []string) (*ValidationResult, error) {
+	keyHash := sha256.Sum256([]byte(apiKey))
+	scopeKey := scopesKey(scopes)
+	now := c.now()
+
+	c.mu.Lock()
+	entry := c.entries[keyHash][scopeKey]
+	switch {
+	case entry == nil:
+	case now.Before(entry.expires):
+		c.mu.Unlock()
+		return entry.cached()
+	case c.isStale(entry, now):
+		if !entry.refreshing {
+			entry.refreshing = true
+			if _, ok := c.calls[callKeyOf(keyHash, scopeKey)]; !ok {
+				c.start(ctx, apiKey, scopes, keyHash, scopeKey)
+			}
+		}
+		c.mu.Unlock()
+		return entry.cached()
+	}
+	c.mu.Unlock()
+
+	res, err := c.lookup(ctx, apiKey, scopes, keyHash, scopeKey)
+	if err != nil && !isCacheable(err) {
+		// Serve a stale result rather than failing while Meterus is down.
+		c.mu.Lock()
+		entry := c.entries[keyHash][scopeKey]
+		c.mu.Unlock()
+		if entry != nil && c.isStale(entry, c.now()) {
+			return entry.cached()
+		}
+	}
+	return res, err
+}
+
+// Invalidate removes every cached result for apiKey. Lookups of the key in
+// flight, including background refreshes, are not cached when they complete,
+// and later validations start a new lookup.
+func (c *CachingValidator) Invalidate(apiKey string) {
+	keyHash := sha256.Sum256([]byte(apiKey))
+	c.mu.Lock()
+	delete(c.entries, keyHash)
+	c.keyGens[keyHash]++
+	prefix := callKeyOf(keyHash, "")
+	for callKey := range c.calls {
+		if strings.HasPrefix(callKey, prefix) {
+			delete(c.calls, callKey)
+		}
+	}
+	c.mu.Unlock()
+}
+
+// Purge removes all cached results. Like Invalidate, it keeps lookups in
+// flight from being cached.
+func (c *CachingValidator) Purge() {
+	c.mu.Lock()
+	clear(c.entries)
+	clear(c.calls)
+	c.purges++
+	c.mu.Unlock()
+}
+
+// generation returns the current generation of a key. It must be called with
+// c.mu held.
+func (c *CachingValidator) generation(keyHash [sha256.Size]byte) generation {
+	return generation{purges: c.purges, key: c.keyGens[keyHash]}
+}
+
+// lookup validates the key with the Meterus service, sharing the call with
+// concurrent lookups of the same key and scopes, and caches the result. The
+// shared call is detached from the cancellation of the caller that started
+// it; every caller only waits for as long as its own ctx allows.
+func (c *CachingValidator) lookup(ctx context.Context, apiKey string, scopes []string, keyHash [sha256.Size]byte, scopeKey string) (*ValidationResult, error) {
+	c.mu.Lock()
+	f, ok := c.calls[callKeyOf(keyHash, scopeKey)]
+	if !ok {
+		f = c.start(ctx, apiKey, scopes, keyHash, scopeKey)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.result.clone(), f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// start starts the shared call validating the key, detached from the
+// cancellation of ctx. It must be called with c.mu held.
+func (c *CachingValidator) start(ctx context.Context, apiKey string, scopes []string, keyHash [sha256.Size]byte, scopeKey string) *flight {
+	f := &flight{done: make(chan struct{}), gen: c.generation(keyHash)}
+	c.calls[callKeyOf(keyHash, scopeKey)] = f
+	c.running++
+	go c.call(context.WithoutCancel(ctx), f, apiKey, scopes, keyHash, scopeKey)
+	return f
+}
+
+// call makes the shared call of flight f and caches its result.
+func (c *CachingValidator) call(ctx context.Context, f *flight, apiKey string, scopes []string, keyHash [sha256.Size]byte, scopeKey string) {
+	callKey := callKeyOf(keyHash, scopeKey)
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	f.result, f.err = c.service.ValidateApiKey(ctx, apiKey, scopes)
+
+	c.mu.Lock()
+	c.running--
+	if c.calls[callKey] == f {
+		delete(c.calls, callKey)
+	}
+	// Results of keys invalidated during the lookup are not cached.
+	current := f.gen == c.generation(keyHash)
+	if ttl, ok := c.ttlFor(f.result, f.err); ok && current {
+		c.sweep()
+		if c.entries[keyHash] == nil {
+			c.entries[keyHash] = make(map[string]*cacheEntry)
+		}
+		c.entries[keyHash][scopeKey] = &cacheEntry{result: f.result.clone(), err: f.err, expires: c.now().Add(ttl)}
+	} else if entry := c.entries[keyHash][scopeKey]; entry != nil {
+		entry.refreshing = false
+	}
+	c.mu.Unlock()
+	close(f.done)
+}
+
+// ttlFor returns how long a validation outcome may be cached, if at all.
+func (c *CachingValidator) ttlFor(res *ValidationResult, err error) (time.Duration, bool) {
+	switch {
+	case err == nil && res.Valid:
+		return c.ttl, c.ttl > 0
+	case err == nil || isCacheable(err):
+		return c.negativeTTL, c.negativeTTL > 0
+	}
+	return 0, false
+}
+
+// isStale reports whether an expired entry may still be served.
+func (c *CachingValidator) isStale(entry *cacheEntry, now time.Time) bool {
+	return entry.err == nil && entry.result.Valid && now.Before(entry.expires.Add(c.staleTTL))
+}
+
+// sweep drops entries that can no longer be served, at most once per TTL. It
+// must be called with c.mu held.
+func (c *CachingValidator) sweep() {
+	now := c.now()
+	if now.Sub(c.lastSweep) < c.ttl {
+		return
+	}
+	c.lastSweep = now
+	if c.running == 0 {
+		// Generations only matter to lookups in flight.
+		clear(c.keyGens)
+	}
+	for keyHash, byScopes := range c.entries {
+		for scopeKey, entry := range byScopes {
+			if !now.Before(entry.expires) && !c.isStale(entry, now) {
+				delete(byScopes, scopeKey)
+			}
+		}
+		if len(byScopes) == 0 {
+			delete(c.entries, keyHash)
+		}
+	}
+}
+
+// cached returns a copy of the cached outcome so callers cannot modify it.
+func (e *cacheEntry) cached() (*ValidationResult, error) {
+	return e.result.clone(), e.err
+}
+
+// clone returns a deep copy of r, so that the cache and each caller sharing a
+// lookup own their result.
+func (r *ValidationResult) clone() *ValidationResult {
+	if r == nil {
+		return nil
+	}
+	res := *r
+	res.Scopes = slices.Clone(r.Scopes)
+	res.MissingScopes = slices.Clone(r.MissingScopes)
+	if r.Attributes != nil {
+		res.Attributes = proto.Clone(r.Attributes).(*structpb.Struct)
+	}
+	return &res
+}
+
+// isCacheable reports whether a validation error describes the key itself
+// rather than a failure to reach the Meterus service.
+func isCacheable(err error) bool {
+	return errors.Is(err, ErrMissingScopes)
+}
+
+// callKeyOf returns the key of the shared call validating a key with scopes.
+func callKeyOf(keyHash [sha256.Size]byte, scopeKey string) string {
+	return string(keyHash[:]) + "\x00" + scopeKey
+}
+
+func scopesKey(scopes []string) string {
+	sorted := slices.Clone(scopes)
+	slices.Sort(sorted)
+	return strings.Join(slices.Compact(sorted), " ")
+}
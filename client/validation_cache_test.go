@@ -0,0 +1,244 @@
+package client_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elliot14A/meterus-go/client"
+	"github.com/elliot14A/meterus-go/meterustest"
+	validation "github.com/elliot14A/meterus-go/validation/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// validKeys answers ValidateApiKey calls, taking the key "valid" as a key of
+// acme and any other key as invalid.
+func validKeys(ctx context.Context, _ string, _ proto.Message) (proto.Message, error) {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	if strings.Join(md.Get("authorization"), "") == "Bearer valid" {
+		return &validation.ValidateApiKeyResponse{IsValid: true, Metadata: &validation.Metadata{Subject: "acme"}}, nil
+	}
+	return &validation.ValidateApiKeyResponse{}, nil
+}
+
+// blockingValidKeys returns a StubConn InvokeFunc sending the context of each
+// call to started, and answering it with validKeys once release is closed.
+func blockingValidKeys(started chan<- context.Context, release <-chan struct{}) func(context.Context, string, proto.Message) (proto.Message, error) {
+	return func(ctx context.Context, method string, req proto.Message) (proto.Message, error) {
+		started <- ctx
+		select {
+		case <-release:
+			return validKeys(ctx, method, req)
+		case <-ctx.Done():
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
+	}
+}
+
+func newTestCache(conn *meterustest.StubConn, opts ...client.CacheOption) (*client.CachingValidator, *meterustest.Clock) {
+	clock := meterustest.NewClock(time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC))
+	c := client.NewValidationServiceFromConn(conn, "").NewCachingValidator(opts...)
+	c.SetClock(clock.Now)
+	return c, clock
+}
+
+// waitIdle waits for the lookups in flight, including background refreshes,
+// to complete.
+func waitIdle(t *testing.T, c *client.CachingValidator) {
+	t.Helper()
+	require.Eventually(t, c.Idle, time.Second, time.Millisecond)
+}
+
+func TestCachingValidatorTTLs(t *testing.T) {
+	conn := &meterustest.StubConn{InvokeFunc: validKeys}
+	c, clock := newTestCache(conn, client.WithCacheTTL(time.Minute), client.WithNegativeCacheTTL(10*time.Second))
+	ctx := context.Background()
+
+	res, err := c.ValidateApiKey(ctx, "valid", nil)
+	require.NoError(t, err)
+	assert.True(t, res.Valid)
+	res, err = c.ValidateApiKey(ctx, "invalid", nil)
+	require.NoError(t, err)
+	assert.False(t, res.Valid)
+	assert.Len(t, conn.Calls(), 2)
+
+	clock.Advance(30 * time.Second)
+	res, err = c.ValidateApiKey(ctx, "valid", nil)
+	require.NoError(t, err)
+	assert.True(t, res.Valid)
+	assert.Len(t, conn.Calls(), 2, "valid keys must be cached for the TTL")
+	res, err = c.ValidateApiKey(ctx, "invalid", nil)
+	require.NoError(t, err)
+	assert.False(t, res.Valid)
+	assert.Len(t, conn.Calls(), 3, "invalid keys must expire after the negative TTL")
+
+	clock.Advance(31 * time.Second)
+	_, err = c.ValidateApiKey(ctx, "valid", nil)
+	require.NoError(t, err)
+	assert.Len(t, conn.Calls(), 4, "valid keys must expire after the TTL")
+
+	_, err = c.ValidateApiKey(ctx, "valid", []string{"meters:read"})
+	require.NoError(t, err)
+	assert.Len(t, conn.Calls(), 5, "results are cached per set of scopes")
+}
+
+func TestCachingValidatorCollapsesConcurrentLookups(t *testing.T) {
+	started, release := make(chan context.Context, 16), make(chan struct{})
+	conn := &meterustest.StubConn{InvokeFunc: blockingValidKeys(started, release)}
+	c, _ := newTestCache(conn)
+
+	var wg sync.WaitGroup
+	results := make([]*client.ValidationResult, 10)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := c.ValidateApiKey(context.Background(), "valid", []string{"b", "a"})
+			assert.NoError(t, err)
+			results[i] = res
+		}()
+	}
+	<-started
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Len(t, conn.Calls(), 1)
+	for _, res := range results {
+		require.NotNil(t, res)
+		assert.True(t, res.Valid)
+	}
+	results[0].Scopes = append(results[0].Scopes, "tampered")
+	assert.Empty(t, results[1].Scopes, "callers sharing a lookup must get their own result")
+}
+
+func TestCachingValidatorDropsLookupsRacingInvalidation(t *testing.T) {
+	for name, invalidate := range map[string]func(*client.CachingValidator){
+		"Invalidate": func(c *client.CachingValidator) { c.Invalidate("valid") },
+		"Purge":      func(c *client.CachingValidator) { c.Purge() },
+	} {
+		t.Run(name, func(t *testing.T) {
+			started, release := make(chan context.Context, 16), make(chan struct{})
+			conn := &meterustest.StubConn{InvokeFunc: blockingValidKeys(started, release)}
+			c, _ := newTestCache(conn)
+
+			done := make(chan *client.ValidationResult)
+			go func() {
+				res, _ := c.ValidateApiKey(context.Background(), "valid", nil)
+				done <- res
+			}()
+			<-started
+			// The key is revoked while the lookup is in flight, which
+			// still reads it as valid.
+			invalidate(c)
+			close(release)
+			res := <-done
+			assert.True(t, res.Valid)
+
+			conn.InvokeFunc = reply(&validation.ValidateApiKeyResponse{}, nil)
+
+			res, err := c.ValidateApiKey(context.Background(), "valid", nil)
+			require.NoError(t, err)
+			assert.False(t, res.Valid, "the result of a lookup started before %s must not be cached", name)
+			assert.Len(t, conn.Calls(), 2)
+		})
+	}
+}
+
+func TestCachingValidatorServesStaleWhileUnavailable(t *testing.T) {
+	conn := &meterustest.StubConn{InvokeFunc: validKeys}
+	c, clock := newTestCache(conn, client.WithCacheTTL(time.Minute), client.WithStaleWhileRevalidate(5*time.Minute))
+	ctx := context.Background()
+
+	_, err := c.ValidateApiKey(ctx, "valid", nil)
+	require.NoError(t, err)
+
+	conn.InvokeFunc = reply(nil, status.Error(codes.Unavailable, "meterus is down"))
+	clock.Advance(2 * time.Minute)
+	res, err := c.ValidateApiKey(ctx, "valid", nil)
+	require.NoError(t, err)
+	assert.True(t, res.Valid, "stale results must be served while they are revalidated")
+	waitIdle(t, c)
+	assert.Len(t, conn.Calls(), 2, "stale results must be revalidated in the background")
+
+	res, err = c.ValidateApiKey(ctx, "valid", nil)
+	require.NoError(t, err)
+	assert.True(t, res.Valid, "stale results must be served while Meterus is unavailable")
+	waitIdle(t, c)
+
+	clock.Advance(5 * time.Minute)
+	_, err = c.ValidateApiKey(ctx, "valid", nil)
+	assert.Equal(t, codes.Unavailable, status.Code(err), "results must not be served past the stale window")
+
+	conn.InvokeFunc = reply(&validation.ValidateApiKeyResponse{}, nil)
+	_, err = c.ValidateApiKey(ctx, "invalid", nil)
+	require.NoError(t, err)
+	clock.Advance(15 * time.Second)
+	conn.InvokeFunc = reply(nil, status.Error(codes.Unavailable, "meterus is down"))
+	_, err = c.ValidateApiKey(ctx, "invalid", nil)
+	assert.Equal(t, codes.Unavailable, status.Code(err), "invalid keys must not be served stale")
+}
+
+func TestCachingValidatorCallerCancelsSharedLookup(t *testing.T) {
+	started, release := make(chan context.Context, 16), make(chan struct{})
+	conn := &meterustest.StubConn{InvokeFunc: blockingValidKeys(started, release)}
+	c, _ := newTestCache(conn)
+
+	first, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error)
+	go func() {
+		_, err := c.ValidateApiKey(first, "valid", nil)
+		firstErr <- err
+	}()
+	callCtx := <-started
+
+	second := make(chan *client.ValidationResult)
+	go func() {
+		res, err := c.ValidateApiKey(context.Background(), "valid", nil)
+		assert.NoError(t, err)
+		second <- res
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	cancel()
+	select {
+	case err := <-firstErr:
+		assert.ErrorIs(t, err, context.Canceled)
+	case <-time.After(time.Second):
+		t.Fatal("a cancelled caller must return without waiting for the shared lookup")
+	}
+	assert.NoError(t, callCtx.Err(), "the shared lookup must not be cancelled with its first caller")
+
+	close(release)
+	res := <-second
+	assert.True(t, res.Valid)
+	assert.Len(t, conn.Calls(), 1)
+}
+
+func TestCachingValidatorCachesMissingScopesOnly(t *testing.T) {
+	conn := &meterustest.StubConn{InvokeFunc: validKeys}
+	conn.InvokeFunc = reply(&validation.ValidateApiKeyResponse{MissingScopes: []string{"meters:write"}}, nil)
+	c, _ := newTestCache(conn)
+	ctx := context.Background()
+
+	for range 2 {
+		_, err := c.ValidateApiKey(ctx, "valid", []string{"meters:write"})
+		assert.ErrorIs(t, err, client.ErrMissingScopes)
+	}
+	assert.Len(t, conn.Calls(), 1, "missing scopes describe the key and must be cached")
+
+	conn.InvokeFunc = reply(nil, status.Error(codes.PermissionDenied, "access denied"))
+	for range 2 {
+		_, err := c.ValidateApiKey(ctx, "other", []string{"meters:write"})
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+		assert.NotErrorIs(t, err, client.ErrMissingScopes)
+	}
+	assert.Len(t, conn.Calls(), 3, "denials without missing scopes must not be cached")
+}
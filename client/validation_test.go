@@ -0,0 +1,223 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elliot14A/meterus-go/client"
+	"github.com/elliot14A/meterus-go/meterustest"
+	validation "github.com/elliot14A/meterus-go/validation/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+)
+
+// callCounter counts the calls a server receives, by full method name.
+type callCounter struct {
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (c *callCounter) interceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		c.mu.Lock()
+		if c.calls == nil {
+			c.calls = make(map[string]int)
+		}
+		c.calls[info.FullMethod]++
+		c.mu.Unlock()
+		return handler(ctx, req)
+	}
+}
+
+func (c *callCounter) total() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, calls := range c.calls {
+		n += calls
+	}
+	return n
+}
+
+func TestValidateAndMeterMakesOneCall(t *testing.T) {
+	var counter callCounter
+	srv, _ := newServer(t, meterustest.WithServerOptions(grpc.ChainUnaryInterceptor(counter.interceptor())))
+	srv.AddApiKey("user-key", "acme", "meters:write")
+	c := newClient(t, srv)
+	v := c.NewValidationService()
+
+	event, err := client.NewCloudEvent("evt-1", "gateway", "1.0", "request", time.Now(), "", nil)
+	require.NoError(t, err)
+	res, err := v.ValidateAndMeter(context.Background(), "user-key", []string{"meters:write"}, event)
+	require.NoError(t, err)
+	assert.True(t, res.Valid)
+	assert.Equal(t, "acme", res.Subject)
+	assert.Equal(t, 1, counter.total(), "validating and metering must take a single call")
+	assert.Empty(t, event.Subject, "the caller's event must not be modified")
+
+	events := srv.Events()
+	require.Len(t, events, 1)
+	assert.Equal(t, "evt-1", events[0].Id)
+	assert.Equal(t, "acme", events[0].Subject, "events without a subject are billed to the key's subject")
+}
+
+func TestValidateAndMeterSkipsRejectedKeys(t *testing.T) {
+	srv, _ := newServer(t)
+	srv.AddApiKey("user-key", "acme", "meters:read")
+	c := newClient(t, srv)
+	v := c.NewValidationService()
+
+	event, err := client.NewCloudEvent("", "gateway", "1.0", "request", time.Now(), "", nil)
+	require.NoError(t, err)
+
+	res, err := v.ValidateAndMeter(context.Background(), "unknown-key", nil, event)
+	require.NoError(t, err, "unknown keys must be reported by the server, not with an empty reply")
+	assert.False(t, res.Valid)
+
+	res, err = v.ValidateAndMeter(context.Background(), "user-key", []string{"meters:write"}, event)
+	assert.ErrorIs(t, err, client.ErrMissingScopes)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	require.NotNil(t, res)
+	assert.Equal(t, []string{"meters:write"}, res.MissingScopes)
+
+	assert.Empty(t, srv.Events(), "events of rejected keys must not be recorded")
+}
+
+func TestValidateAndMeterRejectsOtherSubjects(t *testing.T) {
+	srv, _ := newServer(t)
+	srv.AddApiKey("user-key", "acme", "meters:write")
+	c := newClient(t, srv)
+	v := c.NewValidationService()
+
+	event, err := client.NewCloudEvent("evt-1", "gateway", "1.0", "request", time.Now(), "globex", nil)
+	require.NoError(t, err)
+	_, err = v.ValidateAndMeter(context.Background(), "user-key", []string{"meters:write"}, event)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.NotErrorIs(t, err, client.ErrMissingScopes)
+	assert.Empty(t, srv.Events(), "keys must not bill other subjects")
+
+	event.Subject = "acme"
+	res, err := v.ValidateAndMeter(context.Background(), "user-key", []string{"meters:write"}, event)
+	require.NoError(t, err)
+	assert.True(t, res.Valid)
+	assert.Len(t, srv.Events(), 1)
+}
+
+func TestValidateAndMeterEmptyReply(t *testing.T) {
+	v := client.NewValidationServiceFromConn(&meterustest.StubConn{InvokeFunc: reply(&validation.ValidateApiKeyResponse{}, nil)}, "")
+	event, err := client.NewCloudEvent("evt-1", "gateway", "1.0", "request", time.Now(), "", nil)
+	require.NoError(t, err)
+
+	res, err := v.ValidateAndMeter(context.Background(), "key", nil, event)
+	assert.ErrorIs(t, err, client.ErrNoValidationResult, "a reply without a result must not read as an invalid key")
+	var e *client.Error
+	require.True(t, errors.As(err, &e))
+	assert.Equal(t, "ValidateAndMeter", e.Method)
+	assert.Equal(t, codes.Unimplemented, e.Code)
+	assert.Nil(t, res)
+}
+
+func TestValidateAndMeterRejectsNilEvent(t *testing.T) {
+	srv, _ := newServer(t)
+	c := newClient(t, srv)
+
+	_, err := c.NewValidationService().ValidateAndMeter(context.Background(), "user-key", nil, nil)
+	var e *client.Error
+	require.True(t, errors.As(err, &e))
+	assert.Equal(t, "ValidateAndMeter", e.Method)
+	assert.Equal(t, codes.InvalidArgument, e.Code)
+}
+
+func TestValidateApiKeyInvalidKey(t *testing.T) {
+	v := client.NewValidationServiceFromConn(&meterustest.StubConn{InvokeFunc: reply(&validation.ValidateApiKeyResponse{IsValid: false}, nil)}, "")
+
+	res, err := v.ValidateApiKey(context.Background(), "key", nil)
+	require.NoError(t, err)
+	assert.False(t, res.Valid)
+	assert.Empty(t, res.Subject)
+	assert.Nil(t, res.Attributes)
+
+	v = client.NewValidationServiceFromConn(&meterustest.StubConn{InvokeFunc: reply(nil, status.Error(codes.Unauthenticated, "unknown key"))}, "")
+	res, err = v.ValidateApiKey(context.Background(), "key", nil)
+	require.NoError(t, err, "unknown keys are reported in the result")
+	assert.False(t, res.Valid)
+}
+
+func TestValidateApiKeyWithoutMetadata(t *testing.T) {
+	v := client.NewValidationServiceFromConn(&meterustest.StubConn{InvokeFunc: reply(&validation.ValidateApiKeyResponse{
+		IsValid:       true,
+		GrantedScopes: []string{"meters:read"},
+	}, nil)}, "")
+
+	res, err := v.ValidateApiKey(context.Background(), "key", []string{"meters:read"})
+	require.NoError(t, err)
+	assert.True(t, res.Valid)
+	assert.Empty(t, res.Subject)
+	assert.Nil(t, res.Attributes)
+	assert.Equal(t, []string{"meters:read"}, res.Scopes)
+
+	var attrs map[string]any
+	require.NoError(t, res.DecodeAttributes(&attrs))
+	assert.Nil(t, attrs)
+}
+
+func TestValidateApiKeyMissingScopes(t *testing.T) {
+	withInfo := func(t *testing.T, msg string, details ...protoadapt.MessageV1) error {
+		t.Helper()
+		s, err := status.New(codes.PermissionDenied, msg).WithDetails(details...)
+		require.NoError(t, err)
+		return s.Err()
+	}
+	tests := []struct {
+		name    string
+		conn    *meterustest.StubConn
+		missing []string
+	}{
+		{
+			name: "result",
+			conn: &meterustest.StubConn{InvokeFunc: reply(&validation.ValidateApiKeyResponse{
+				Metadata:      &validation.Metadata{Subject: "acme"},
+				MissingScopes: []string{"meters:write"},
+			}, nil)},
+			missing: []string{"meters:write"},
+		},
+		{
+			name: "error info",
+			conn: &meterustest.StubConn{InvokeFunc: reply(nil, withInfo(t, "denied", &errdetails.ErrorInfo{
+				Reason:   "MISSING_SCOPES",
+				Metadata: map[string]string{"missing_scopes": "meters:write,admin"},
+			}))},
+			missing: []string{"meters:write", "admin"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := client.NewValidationServiceFromConn(tt.conn, "")
+			res, err := v.ValidateApiKey(context.Background(), "key", []string{"meters:write"})
+			require.ErrorIs(t, err, client.ErrMissingScopes)
+			assert.Equal(t, codes.PermissionDenied, status.Code(err))
+			var e *client.Error
+			require.True(t, errors.As(err, &e))
+			assert.Equal(t, "ValidateApiKey", e.Method)
+			require.NotNil(t, res)
+			assert.False(t, res.Valid)
+			assert.Equal(t, tt.missing, res.MissingScopes)
+		})
+	}
+
+	v := client.NewValidationServiceFromConn(&meterustest.StubConn{InvokeFunc: reply(nil, status.Error(codes.PermissionDenied, "access denied"))}, "")
+	res, err := v.ValidateApiKey(context.Background(), "key", []string{"meters:write"})
+	assert.NotErrorIs(t, err, client.ErrMissingScopes, "denials without missing scopes say nothing about the key")
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	var e *client.Error
+	assert.True(t, errors.As(err, &e))
+	assert.Nil(t, res)
+}
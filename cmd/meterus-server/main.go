@@ -0,0 +1,257 @@
+// Command meterus-server runs a standalone Meterus-compatible server for local
+// development and end-to-end tests. It implements the metering, subject and
+// validation services and persists their data in a local bbolt database.
+//
+// Usage:
+//
+//	meterus-server [flags]
+//
+// The flags are:
+//
+//	-addr address
+//		Listen address. Defaults to localhost:50051.
+//	-data path
+//		Database file, created if missing. Defaults to meterus.db.
+//	-connect-addr address
+//		Also serve the services over the Connect protocol, which works over
+//		HTTP/1.1, on the given address. Disabled by default.
+//	-tls-cert file, -tls-key file
+//		Serve TLS with the given PEM certificate and key.
+//	-api-key SECRET:SUBJECT[:SCOPE,...]
+//		Seed an API key with the given secret, subject and scopes, unless a
+//		key with the secret exists. May be repeated.
+//	-insecure-no-auth
+//		Serve calls without authenticating them. By default every call but
+//		health checks and key validation needs a valid API key, and managing
+//		meters, subjects and API keys needs the scopes meters:manage,
+//		subjects:manage and api_keys:manage respectively.
+//	-shutdown-timeout duration
+//		How long to wait for calls in flight on SIGINT or SIGTERM before
+//		closing connections. Defaults to 10s.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/elliot14A/meterus-go/connect"
+	"github.com/elliot14A/meterus-go/internal/server"
+	meter "github.com/elliot14A/meterus-go/meters/v1"
+	"github.com/elliot14A/meterus-go/middleware"
+	subject "github.com/elliot14A/meterus-go/subject/v1"
+	validation "github.com/elliot14A/meterus-go/validation/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// seedKey is an API key given on the command line.
+type seedKey struct {
+	secret  string
+	subject string
+	scopes  []string
+}
+
+// seedKeys collects repeated -api-key flags.
+type seedKeys []seedKey
+
+func (k *seedKeys) String() string {
+	return fmt.Sprintf("%d keys", len(*k))
+}
+
+func (k *seedKeys) Set(v string) error {
+	secret, rest, ok := strings.Cut(v, ":")
+	if !ok || secret == "" {
+		return errors.New("want SECRET:SUBJECT[:SCOPE,...]")
+	}
+	subject, scopes, _ := strings.Cut(rest, ":")
+	if subject == "" {
+		return errors.New("api key subject is required")
+	}
+	key := seedKey{secret: secret, subject: subject}
+	if scopes != "" {
+		key.scopes = strings.Split(scopes, ",")
+	}
+	*k = append(*k, key)
+	return nil
+}
+
+// managementScopes are the scopes required for the methods managing meters,
+// subjects and API keys.
+var managementScopes = map[string][]string{
+	meter.MeteringService_CreateMeter_FullMethodName:         {"meters:manage"},
+	meter.MeteringService_DeleteMeter_FullMethodName:         {"meters:manage"},
+	subject.SubjectService_CreateSubject_FullMethodName:      {"subjects:manage"},
+	subject.SubjectService_UpdateSubject_FullMethodName:      {"subjects:manage"},
+	subject.SubjectService_DeleteSubject_FullMethodName:      {"subjects:manage"},
+	validation.ValidationService_CreateApiKey_FullMethodName: {"api_keys:manage"},
+	validation.ValidationService_ListApiKeys_FullMethodName:  {"api_keys:manage"},
+	validation.ValidationService_RevokeApiKey_FullMethodName: {"api_keys:manage"},
+	validation.ValidationService_RotateApiKey_FullMethodName: {"api_keys:manage"},
+}
+
+// skipAuth reports the methods served without an API key: health checks, and
+// key validation, which reports invalid keys itself.
+func skipAuth(fullMethod string) bool {
+	switch fullMethod {
+	case validation.ValidationService_ValidateApiKey_FullMethodName,
+		validation.ValidationService_ValidateAndMeter_FullMethodName:
+		return true
+	}
+	return strings.HasPrefix(fullMethod, "/grpc.health.v1.Health/")
+}
+
+// authConfig returns the authentication of the calls served by backend.
+func authConfig(backend *server.Backend) middleware.GRPCAuthConfig {
+	return middleware.GRPCAuthConfig{
+		Validator:    backend,
+		MethodScopes: managementScopes,
+		Skip:         skipAuth,
+	}
+}
+
+// checkTLSFlags checks that the TLS certificate and key are set together.
+func checkTLSFlags(cert, key string) error {
+	if (cert == "") != (key == "") {
+		return errors.New("-tls-cert and -tls-key must be set together")
+	}
+	return nil
+}
+
+func main() {
+	log.SetPrefix("meterus-server: ")
+	log.SetFlags(log.LstdFlags)
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run() error {
+	var (
+		addr            = flag.String("addr", "localhost:50051", "listen `address`")
+		data            = flag.String("data", "meterus.db", "database `file`")
+		connectAddr     = flag.String("connect-addr", "", "also serve the Connect protocol on `address`")
+		tlsCert         = flag.String("tls-cert", "", "TLS certificate `file`")
+		tlsKey          = flag.String("tls-key", "", "TLS key `file`")
+		shutdownTimeout = flag.Duration("shutdown-timeout", 10*time.Second, "how long to wait for calls in flight on shutdown")
+		noAuth          = flag.Bool("insecure-no-auth", false, "serve calls without authenticating them")
+		keys            seedKeys
+	)
+	flag.Var(&keys, "api-key", "seed API key as `SECRET:SUBJECT[:SCOPE,...]`; may be repeated")
+	flag.Parse()
+	if err := checkTLSFlags(*tlsCert, *tlsKey); err != nil {
+		return err
+	}
+
+	store, err := openBoltStore(*data)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	backend, err := server.New(server.Options{Store: store})
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err := backend.AddApiKey(k.secret, k.subject, k.scopes...); err != nil {
+			return err
+		}
+	}
+
+	var (
+		opts        []grpc.ServerOption
+		connectOpts []connect.HandlerOption
+	)
+	if *noAuth {
+		log.Print("serving without authentication")
+	} else {
+		auth := authConfig(backend)
+		opts = append(opts,
+			grpc.ChainUnaryInterceptor(middleware.UnaryServerAuth(auth)),
+			grpc.ChainStreamInterceptor(middleware.StreamServerAuth(auth)))
+		connectOpts = append(connectOpts, connect.WithInterceptors(middleware.UnaryServerAuth(auth)))
+	}
+	if *tlsCert != "" {
+		creds, err := credentials.NewServerTLSFromFile(*tlsCert, *tlsKey)
+		if err != nil {
+			return fmt.Errorf("failed to load TLS credentials: %w", err)
+		}
+		opts = append(opts, grpc.Creds(creds))
+	}
+	srv := grpc.NewServer(opts...)
+	backend.Register(srv)
+	healthSrv := health.NewServer()
+	healthpb.RegisterHealthServer(srv, healthSrv)
+
+	lis, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errc := make(chan error, 2)
+	go func() {
+		errc <- srv.Serve(lis)
+	}()
+	log.Printf("listening on %s, storing data in %s", lis.Addr(), *data)
+
+	var httpSrv *http.Server
+	if *connectAddr != "" {
+		handler := connect.NewHandler(connectOpts...)
+		backend.Register(handler)
+		httpSrv = &http.Server{Handler: handler}
+		connectLis, err := net.Listen("tcp", *connectAddr)
+		if err != nil {
+			srv.Stop()
+			return fmt.Errorf("failed to listen: %w", err)
+		}
+		go func() {
+			if *tlsCert != "" {
+				errc <- httpSrv.ServeTLS(connectLis, *tlsCert, *tlsKey)
+			} else {
+				errc <- httpSrv.Serve(connectLis)
+			}
+		}()
+		log.Printf("serving Connect on %s", connectLis.Addr())
+	}
+
+	select {
+	case err := <-errc:
+		return fmt.Errorf("failed to serve: %w", err)
+	case <-ctx.Done():
+	}
+	log.Print("shutting down")
+	healthSrv.Shutdown()
+	stopped := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(stopped)
+	}()
+	timeout := time.After(*shutdownTimeout)
+	if httpSrv != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+		defer cancel()
+		if err := httpSrv.Shutdown(shutdownCtx); err != nil {
+			httpSrv.Close()
+		}
+	}
+	select {
+	case <-stopped:
+	case <-timeout:
+		log.Print("shutdown timed out, closing connections")
+		srv.Stop()
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/elliot14A/meterus-go/client"
+	"github.com/elliot14A/meterus-go/connect"
+	"github.com/elliot14A/meterus-go/internal/server"
+	meter "github.com/elliot14A/meterus-go/meters/v1"
+	"github.com/elliot14A/meterus-go/middleware"
+	validation "github.com/elliot14A/meterus-go/validation/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestSeedKeys(t *testing.T) {
+	var keys seedKeys
+	require.NoError(t, keys.Set("s1:acme:meters:read,meters:write"))
+	require.NoError(t, keys.Set("s2:globex"))
+	require.NoError(t, keys.Set("s3:initech:"))
+	assert.Equal(t, seedKeys{
+		{secret: "s1", subject: "acme", scopes: []string{"meters:read", "meters:write"}},
+		{secret: "s2", subject: "globex"},
+		{secret: "s3", subject: "initech"},
+	}, keys)
+	assert.Equal(t, "3 keys", keys.String())
+
+	for _, v := range []string{"", "secret", ":acme", "secret:", "secret::meters:read"} {
+		assert.Error(t, keys.Set(v), "%q", v)
+	}
+	assert.Len(t, keys, 3, "invalid keys must not be added")
+}
+
+func TestCheckTLSFlags(t *testing.T) {
+	assert.NoError(t, checkTLSFlags("", ""))
+	assert.NoError(t, checkTLSFlags("cert.pem", "key.pem"))
+	assert.Error(t, checkTLSFlags("cert.pem", ""))
+	assert.Error(t, checkTLSFlags("", "key.pem"))
+}
+
+// authBackend returns a backend with a reader key and a manager key.
+func authBackend(t *testing.T) *server.Backend {
+	t.Helper()
+	backend, err := server.New(server.Options{})
+	require.NoError(t, err)
+	require.NoError(t, backend.AddApiKey("reader", "acme", "meters:read"))
+	require.NoError(t, backend.AddApiKey("manager", "acme", "meters:manage"))
+	return backend
+}
+
+func TestAuth(t *testing.T) {
+	backend := authBackend(t)
+	auth := authConfig(backend)
+	srv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(middleware.UnaryServerAuth(auth)),
+		grpc.ChainStreamInterceptor(middleware.StreamServerAuth(auth)))
+	backend.Register(srv)
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	lis := bufconn.Listen(1 << 20)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	metering := meter.NewMeteringServiceClient(conn)
+	ctx := context.Background()
+	newMeter := &meter.CreateMeterRequest{Slug: "tokens", EventType: "request", Aggregation: meter.Aggregation_AGGREGATION_COUNT}
+
+	_, err = metering.ListMeters(ctx, &meter.ListMetersRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err), "calls need an API key")
+	_, err = metering.ListMeters(client.AddApiKeyAuthorizationHeader(ctx, "reader"), &meter.ListMetersRequest{})
+	assert.NoError(t, err)
+	_, err = metering.CreateMeter(client.AddApiKeyAuthorizationHeader(ctx, "reader"), newMeter)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err), "managing meters needs meters:manage")
+	_, err = metering.CreateMeter(client.AddApiKeyAuthorizationHeader(ctx, "manager"), newMeter)
+	assert.NoError(t, err)
+
+	res, err := validation.NewValidationServiceClient(conn).ValidateApiKey(ctx, &validation.ValidateApiKeyRequest{})
+	require.NoError(t, err, "key validation reports invalid keys itself")
+	assert.False(t, res.IsValid)
+	_, err = healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	assert.NoError(t, err, "health checks need no API key")
+}
+
+func TestConnectAuth(t *testing.T) {
+	backend := authBackend(t)
+	handler := connect.NewHandler(connect.WithInterceptors(middleware.UnaryServerAuth(authConfig(backend))))
+	backend.Register(handler)
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	metering := meter.NewMeteringServiceClient(connect.NewConn(srv.URL))
+	ctx := context.Background()
+
+	_, err := metering.ListMeters(ctx, &meter.ListMetersRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = metering.ListMeters(client.AddApiKeyAuthorizationHeader(ctx, "reader"), &meter.ListMetersRequest{})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"cmp"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/elliot14A/meterus-go/internal/server"
+	meter "github.com/elliot14A/meterus-go/meters/v1"
+	subject "github.com/elliot14A/meterus-go/subject/v1"
+	validation "github.com/elliot14A/meterus-go/validation/v1"
+	bolt "go.etcd.io/bbolt"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	eventsBucket   = []byte("events")
+	metersBucket   = []byte("meters")
+	subjectsBucket = []byte("subjects")
+	apiKeysBucket  = []byte("api_keys")
+)
+
+// boltStore persists a backend in a bbolt database. Events are keyed by
+// sequence number. Other records are keyed by ID, and their values start with
+// the sequence number they were first stored with, which orders them on load.
+type boltStore struct {
+	db *bolt.DB
+}
+
+func openBoltStore(path string) (*boltStore, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{eventsBucket, metersBucket, subjectsBucket, apiKeysBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize database %s: %w", path, err)
+	}
+	return &boltStore{db: db}, nil
+}
+
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *boltStore) Load() (*server.Snapshot, error) {
+	snap := &server.Snapshot{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		err := tx.Bucket(eventsBucket).ForEach(func(_, v []byte) error {
+			e := &meter.CloudEvent{}
+			if err := proto.Unmarshal(v, e); err != nil {
+				return fmt.Errorf("failed to decode event: %w", err)
+			}
+			snap.Events = append(snap.Events, e)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if snap.Meters, err = loadOrdered(tx.Bucket(metersBucket), func(v []byte) (*meter.Meter, error) {
+			m := &meter.Meter{}
+			return m, proto.Unmarshal(v, m)
+		}); err != nil {
+			return fmt.Errorf("failed to decode meter: %w", err)
+		}
+		if snap.Subjects, err = loadOrdered(tx.Bucket(subjectsBucket), func(v []byte) (*subject.Subject, error) {
+			sub := &subject.Subject{}
+			return sub, proto.Unmarshal(v, sub)
+		}); err != nil {
+			return fmt.Errorf("failed to decode subject: %w", err)
+		}
+		if snap.APIKeys, err = loadOrdered(tx.Bucket(apiKeysBucket), decodeKey); err != nil {
+			return fmt.Errorf("failed to decode api key: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+func (s *boltStore) PutEvent(event *meter.CloudEvent) error {
+	v, err := proto.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(eventsBucket)
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		return b.Put(binary.BigEndian.AppendUint64(nil, seq), v)
+	})
+}
+
+func (s *boltStore) PutMeter(m *meter.Meter) error {
+	v, err := proto.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return s.putOrdered(metersBucket, m.Id, v)
+}
+
+func (s *boltStore) DeleteMeter(id string) error {
+	return s.delete(metersBucket, id)
+}
+
+func (s *boltStore) PutSubject(sub *subject.Subject) error {
+	v, err := proto.Marshal(sub)
+	if err != nil {
+		return err
+	}
+	return s.putOrdered(subjectsBucket, sub.Id, v)
+}
+
+func (s *boltStore) DeleteSubject(id string) error {
+	return s.delete(subjectsBucket, id)
+}
+
+func (s *boltStore) PutAPIKey(key *server.StoredKey) error {
+	v, err := encodeKey(key)
+	if err != nil {
+		return err
+	}
+	return s.putOrdered(apiKeysBucket, key.Meta.Id, v)
+}
+
+// putOrdered stores v under id, keeping the sequence number of a record
+// already stored under it.
+func (s *boltStore) putOrdered(bucket []byte, id string, v []byte) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		var seq uint64
+		if old := b.Get([]byte(id)); len(old) >= 8 {
+			seq = binary.BigEndian.Uint64(old)
+		} else {
+			var err error
+			if seq, err = b.NextSequence(); err != nil {
+				return err
+			}
+		}
+		return b.Put([]byte(id), append(binary.BigEndian.AppendUint64(nil, seq), v...))
+	})
+}
+
+func (s *boltStore) delete(bucket []byte, id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Delete([]byte(id))
+	})
+}
+
+// loadOrdered decodes the records of a bucket written by putOrdered, in the
+// order they were first stored.
+func loadOrdered[T any](b *bolt.Bucket, decode func([]byte) (T, error)) ([]T, error) {
+	type record struct {
+		seq   uint64
+		value T
+	}
+	var records []record
+	err := b.ForEach(func(_, v []byte) error {
+		if len(v) < 8 {
+			return fmt.Errorf("truncated record")
+		}
+		value, err := decode(v[8:])
+		if err != nil {
+			return err
+		}
+		records = append(records, record{seq: binary.BigEndian.Uint64(v), value: value})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(records, func(a, b record) int {
+		return cmp.Compare(a.seq, b.seq)
+	})
+	values := make([]T, len(records))
+	for i, r := range records {
+		values[i] = r.value
+	}
+	return values, nil
+}
+
+// storedKey is the encoding of a server.StoredKey.
+type storedKey struct {
+	Meta    []byte          `json:"meta"`
+	Secret  []byte          `json:"secret"`
+	Rotated []rotatedSecret `json:"rotated,omitempty"`
+}
+
+type rotatedSecret struct {
+	Secret []byte    `json:"secret"`
+	Until  time.Time `json:"until"`
+}
+
+func encodeKey(key *server.StoredKey) ([]byte, error) {
+	meta, err := proto.Marshal(key.Meta)
+	if err != nil {
+		return nil, err
+	}
+	k := storedKey{Meta: meta, Secret: key.Secret[:]}
+	for _, r := range key.Rotated {
+		k.Rotated = append(k.Rotated, rotatedSecret{Secret: r.Secret[:], Until: r.Until})
+	}
+	return json.Marshal(k)
+}
+
+func decodeKey(v []byte) (*server.StoredKey, error) {
+	var k storedKey
+	if err := json.Unmarshal(v, &k); err != nil {
+		return nil, err
+	}
+	key := &server.StoredKey{Meta: &validation.ApiKey{}}
+	if err := proto.Unmarshal(k.Meta, key.Meta); err != nil {
+		return nil, err
+	}
+	copy(key.Secret[:], k.Secret)
+	for _, r := range k.Rotated {
+		rs := server.RotatedSecret{Until: r.Until}
+		copy(rs.Secret[:], r.Secret)
+		key.Rotated = append(key.Rotated, rs)
+	}
+	return key, nil
+}
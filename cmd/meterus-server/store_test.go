@@ -0,0 +1,93 @@
+package main
+
+import (
+	"crypto/sha256"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/elliot14A/meterus-go/internal/server"
+	meter "github.com/elliot14A/meterus-go/meters/v1"
+	"github.com/elliot14A/meterus-go/meterustest"
+	subject "github.com/elliot14A/meterus-go/subject/v1"
+	validation "github.com/elliot14A/meterus-go/validation/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestConformance(t *testing.T) {
+	store, err := openBoltStore(filepath.Join(t.TempDir(), "meterus.db"))
+	require.NoError(t, err)
+	defer store.Close()
+	backend, err := server.New(server.Options{Store: store})
+	require.NoError(t, err)
+
+	meterustest.RunConformance(t, meterustest.Implementation{
+		Metering:   backend.MeteringServer(),
+		Subjects:   backend.SubjectServer(),
+		Validation: backend.ValidationServer(),
+	})
+}
+
+func TestBoltStoreSurvivesReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "meterus.db")
+	store, err := openBoltStore(path)
+	require.NoError(t, err)
+
+	events := []*meter.CloudEvent{
+		{Id: "evt-1", Source: "test", Type: "request", Subject: "acme", Time: timestamppb.New(time.Unix(1700000000, 0))},
+		{Id: "evt-2", Source: "test", Type: "request", Subject: "globex", Time: timestamppb.New(time.Unix(1700000060, 0))},
+	}
+	for _, e := range events {
+		require.NoError(t, store.PutEvent(e))
+	}
+	// Meters and subjects are stored out of ID order, updated and deleted,
+	// and must load in the order they were first stored.
+	for _, m := range []*meter.Meter{{Id: "m-2", Slug: "tokens"}, {Id: "m-1", Slug: "requests"}, {Id: "m-3", Slug: "gone"}} {
+		require.NoError(t, store.PutMeter(m))
+	}
+	require.NoError(t, store.PutMeter(&meter.Meter{Id: "m-2", Slug: "tokens", Description: proto.String("updated")}))
+	require.NoError(t, store.DeleteMeter("m-3"))
+	require.NoError(t, store.PutSubject(&subject.Subject{Id: "globex"}))
+	require.NoError(t, store.PutSubject(&subject.Subject{Id: "acme", DisplayName: proto.String("Acme")}))
+	require.NoError(t, store.PutSubject(&subject.Subject{Id: "initech"}))
+	require.NoError(t, store.DeleteSubject("initech"))
+
+	key := &server.StoredKey{
+		Meta:   &validation.ApiKey{Id: "key-1", Subject: "acme", Scopes: []string{"meters:write"}},
+		Secret: sha256.Sum256([]byte("secret")),
+		Rotated: []server.RotatedSecret{
+			{Secret: sha256.Sum256([]byte("old")), Until: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)},
+		},
+	}
+	require.NoError(t, store.PutAPIKey(key))
+	require.NoError(t, store.Close())
+
+	store, err = openBoltStore(path)
+	require.NoError(t, err)
+	defer store.Close()
+	snap, err := store.Load()
+	require.NoError(t, err)
+
+	require.Len(t, snap.Events, 2)
+	for i, e := range events {
+		assert.True(t, proto.Equal(e, snap.Events[i]), "event %d: got %v", i, snap.Events[i])
+	}
+	require.Len(t, snap.Meters, 2)
+	assert.Equal(t, "m-2", snap.Meters[0].Id)
+	assert.Equal(t, "updated", snap.Meters[0].GetDescription())
+	assert.Equal(t, "m-1", snap.Meters[1].Id)
+	require.Len(t, snap.Subjects, 2)
+	assert.Equal(t, "globex", snap.Subjects[0].Id)
+	assert.Equal(t, "Acme", snap.Subjects[1].GetDisplayName())
+
+	require.Len(t, snap.APIKeys, 1)
+	got := snap.APIKeys[0]
+	assert.True(t, proto.Equal(key.Meta, got.Meta), "got %v", got.Meta)
+	assert.Equal(t, key.Secret, got.Secret)
+	require.Len(t, got.Rotated, 1)
+	assert.Equal(t, key.Rotated[0].Secret, got.Rotated[0].Secret)
+	assert.True(t, key.Rotated[0].Until.Equal(got.Rotated[0].Until))
+}
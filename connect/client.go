@@ -0,0 +1,193 @@
+package connect
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// Conn calls unary methods over the Connect protocol. It implements
+// grpc.ClientConnInterface.
+type Conn struct {
+	baseURL      string
+	httpClient   *http.Client
+	codec        codec
+	interceptors []grpc.UnaryClientInterceptor
+}
+
+var _ grpc.ClientConnInterface = (*Conn)(nil)
+
+// Option configures a Conn.
+type Option func(*Conn)
+
+// WithHTTPClient sets the HTTP client used to send requests. It defaults to
+// http.DefaultClient.
+func WithHTTPClient(c *http.Client) Option {
+	return func(conn *Conn) {
+		conn.httpClient = c
+	}
+}
+
+// WithJSON encodes messages as JSON rather than binary protobuf, which is
+// easier to inspect in proxies.
+func WithJSON() Option {
+	return func(conn *Conn) {
+		conn.codec = jsonCodec
+	}
+}
+
+// WithUnaryInterceptors adds interceptors to the calls made on the Conn, as
+// grpc.WithChainUnaryInterceptor does for a gRPC connection. The first one is
+// the outermost.
+func WithUnaryInterceptors(interceptors ...grpc.UnaryClientInterceptor) Option {
+	return func(conn *Conn) {
+		conn.interceptors = append(conn.interceptors, interceptors...)
+	}
+}
+
+// NewConn returns a Conn sending requests to the server at baseURL, such as
+// https://meterus.example.com.
+func NewConn(baseURL string, opts ...Option) *Conn {
+	c := &Conn{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: http.DefaultClient,
+		codec:      protoCodec,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Close releases the idle connections of the Conn's HTTP client.
+func (c *Conn) Close() error {
+	c.httpClient.CloseIdleConnections()
+	return nil
+}
+
+// Invoke implements grpc.ClientConnInterface. It supports the grpc.Header and
+// grpc.Trailer call options.
+func (c *Conn) Invoke(ctx context.Context, method string, args, reply any, opts ...grpc.CallOption) error {
+	invoker := c.invoke
+	for i := len(c.interceptors) - 1; i >= 0; i-- {
+		interceptor, next := c.interceptors[i], invoker
+		invoker = func(ctx context.Context, method string, req, reply any, _ *grpc.ClientConn, opts ...grpc.CallOption) error {
+			return interceptor(ctx, method, req, reply, nil, next, opts...)
+		}
+	}
+	return invoker(ctx, method, args, reply, nil, opts...)
+}
+
+// NewStream implements grpc.ClientConnInterface. Streams are not supported.
+func (c *Conn) NewStream(context.Context, *grpc.StreamDesc, string, ...grpc.CallOption) (grpc.ClientStream, error) {
+	return nil, status.Error(codes.Unimplemented, "connect: streaming calls are not supported")
+}
+
+func (c *Conn) invoke(ctx context.Context, method string, args, reply any, _ *grpc.ClientConn, opts ...grpc.CallOption) error {
+	req, ok := args.(proto.Message)
+	if !ok {
+		return status.Errorf(codes.Internal, "connect: request is a %T, not a proto.Message", args)
+	}
+	res, ok := reply.(proto.Message)
+	if !ok {
+		return status.Errorf(codes.Internal, "connect: response is a %T, not a proto.Message", reply)
+	}
+	body, err := c.codec.marshal(req)
+	if err != nil {
+		return status.Errorf(codes.Internal, "connect: failed to encode request: %v", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+method, bytes.NewReader(body))
+	if err != nil {
+		return status.Errorf(codes.Internal, "connect: failed to create request: %v", err)
+	}
+	if md, ok := metadata.FromOutgoingContext(ctx); ok {
+		setMetadata(httpReq.Header, md, "")
+	}
+	httpReq.Header.Set("Content-Type", c.codec.contentType)
+	httpReq.Header.Set(protocolVersionHeader, "1")
+	if deadline, ok := ctx.Deadline(); ok {
+		httpReq.Header.Set(timeoutHeader, formatTimeout(time.Until(deadline)))
+	}
+
+	httpRes, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		if ctx.Err() != nil {
+			return status.FromContextError(ctx.Err()).Err()
+		}
+		return status.Errorf(codes.Unavailable, "connect: failed to send request: %v", err)
+	}
+	defer httpRes.Body.Close()
+
+	header, err := readMetadata(httpRes.Header, "")
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	trailer, err := readMetadata(httpRes.Header, trailerPrefix)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	for _, opt := range opts {
+		switch o := opt.(type) {
+		case grpc.HeaderCallOption:
+			*o.HeaderAddr = header
+		case grpc.TrailerCallOption:
+			*o.TrailerAddr = trailer
+		}
+	}
+
+	b, err := io.ReadAll(io.LimitReader(httpRes.Body, maxMessageSize+1))
+	if err != nil {
+		if ctx.Err() != nil {
+			return status.FromContextError(ctx.Err()).Err()
+		}
+		return status.Errorf(codes.Unavailable, "connect: failed to read response: %v", err)
+	}
+	if len(b) > maxMessageSize {
+		return status.Errorf(codes.ResourceExhausted, "connect: response larger than %d bytes", maxMessageSize)
+	}
+	if httpRes.StatusCode != http.StatusOK {
+		return decodeError(httpRes.StatusCode, b)
+	}
+	resCodec, ok := codecFor(httpRes.Header.Get("Content-Type"))
+	if !ok {
+		return status.Errorf(codes.Internal, "connect: unexpected response content type %q", httpRes.Header.Get("Content-Type"))
+	}
+	if err := resCodec.unmarshal(b, res); err != nil {
+		return status.Errorf(codes.Internal, "connect: failed to decode response: %v", err)
+	}
+	return nil
+}
+
+// decodeError returns the status of an error response.
+func decodeError(httpStatus int, body []byte) error {
+	var we wireError
+	if err := json.Unmarshal(body, &we); err != nil || we.Code == "" {
+		return status.Errorf(codeFromHTTPStatus(httpStatus), "connect: HTTP status %d: %s", httpStatus, strings.TrimSpace(string(body)))
+	}
+	code, ok := codeFromName(we.Code)
+	if !ok {
+		return status.Errorf(codes.Unknown, "connect: unknown code %q: %s", we.Code, we.Message)
+	}
+	s := &spb.Status{Code: int32(code), Message: we.Message}
+	for _, d := range we.Details {
+		value, err := decodeBinary(d.Value)
+		if err != nil {
+			return status.Errorf(codes.Internal, "connect: failed to decode error detail %s: %v", d.Type, err)
+		}
+		s.Details = append(s.Details, &anypb.Any{TypeUrl: typeURLPrefix + d.Type, Value: value})
+	}
+	return status.FromProto(s).Err()
+}
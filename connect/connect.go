@@ -0,0 +1,228 @@
+// Package connect carries the Meterus services over the unary Connect
+// protocol, which works over HTTP/1.1 and through proxies that do not support
+// gRPC's HTTP/2 trailers.
+//
+// Conn is a grpc.ClientConnInterface, so the generated clients and the
+// client package's services work over it unchanged:
+//
+//	c, err := client.NewMeterusConnectClient("https://meterus.example.com", apiKey)
+//
+// Handler serves services registered on it like a grpc.Server does:
+//
+//	h := connect.NewHandler()
+//	meter.RegisterMeteringServiceServer(h, impl)
+//	http.ListenAndServe(":8080", h)
+//
+// Only unary methods are supported. See https://connectrpc.com/docs/protocol.
+package connect
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	protocolVersionHeader = "Connect-Protocol-Version"
+	timeoutHeader         = "Connect-Timeout-Ms"
+	trailerPrefix         = "Trailer-"
+
+	protoContentType = "application/proto"
+	jsonContentType  = "application/json"
+
+	// maxMessageSize limits the size of messages read, like gRPC's default
+	// receive limit.
+	maxMessageSize = 4 << 20
+)
+
+// codec encodes messages for a content type.
+type codec struct {
+	contentType string
+	marshal     func(proto.Message) ([]byte, error)
+	unmarshal   func([]byte, proto.Message) error
+}
+
+var (
+	protoCodec = codec{protoContentType, proto.Marshal, proto.Unmarshal}
+	jsonCodec  = codec{jsonContentType, protojson.Marshal, protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal}
+)
+
+func codecFor(contentType string) (codec, bool) {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	switch strings.TrimSpace(mediaType) {
+	case protoContentType:
+		return protoCodec, true
+	case jsonContentType:
+		return jsonCodec, true
+	}
+	return codec{}, false
+}
+
+// codeNames are the names of status codes in the protocol.
+var codeNames = map[codes.Code]string{
+	codes.Canceled:           "canceled",
+	codes.Unknown:            "unknown",
+	codes.InvalidArgument:    "invalid_argument",
+	codes.DeadlineExceeded:   "deadline_exceeded",
+	codes.NotFound:           "not_found",
+	codes.AlreadyExists:      "already_exists",
+	codes.PermissionDenied:   "permission_denied",
+	codes.ResourceExhausted:  "resource_exhausted",
+	codes.FailedPrecondition: "failed_precondition",
+	codes.Aborted:            "aborted",
+	codes.OutOfRange:         "out_of_range",
+	codes.Unimplemented:      "unimplemented",
+	codes.Internal:           "internal",
+	codes.Unavailable:        "unavailable",
+	codes.DataLoss:           "data_loss",
+	codes.Unauthenticated:    "unauthenticated",
+}
+
+func codeFromName(name string) (codes.Code, bool) {
+	for code, n := range codeNames {
+		if n == name {
+			return code, true
+		}
+	}
+	return codes.Unknown, false
+}
+
+// httpStatus returns the HTTP status of an error response with code.
+func httpStatus(code codes.Code) int {
+	switch code {
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// codeFromHTTPStatus returns the code of an error response without a
+// protocol error body, such as one written by a proxy.
+func codeFromHTTPStatus(status int) codes.Code {
+	switch status {
+	case http.StatusBadRequest:
+		return codes.Internal
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.Unimplemented
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return codes.Unavailable
+	default:
+		return codes.Unknown
+	}
+}
+
+// wireError is the body of an error response.
+type wireError struct {
+	Code    string       `json:"code"`
+	Message string       `json:"message,omitempty"`
+	Details []wireDetail `json:"details,omitempty"`
+}
+
+// wireDetail is an error detail: a protobuf message and its type name.
+type wireDetail struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+const typeURLPrefix = "type.googleapis.com/"
+
+// isProtocolHeader reports whether the header key is part of the protocol
+// rather than metadata.
+func isProtocolHeader(key string) bool {
+	switch http.CanonicalHeaderKey(key) {
+	case "Content-Type", "Content-Length", "Content-Encoding", "Accept-Encoding",
+		"Connection", "Transfer-Encoding", "Te", "Host", "Date":
+		return true
+	}
+	return strings.HasPrefix(http.CanonicalHeaderKey(key), "Connect-")
+}
+
+// setMetadata adds md to h, prefixing keys with prefix. Values of binary
+// keys, which end in -bin, are base64 encoded.
+func setMetadata(h http.Header, md metadata.MD, prefix string) {
+	for key, values := range md {
+		for _, v := range values {
+			if strings.HasSuffix(key, "-bin") {
+				v = base64.RawStdEncoding.EncodeToString([]byte(v))
+			}
+			h.Add(prefix+key, v)
+		}
+	}
+}
+
+// readMetadata returns the metadata in h, keeping only keys starting with
+// prefix if it is not empty and stripping it.
+func readMetadata(h http.Header, prefix string) (metadata.MD, error) {
+	md := metadata.MD{}
+	for key, values := range h {
+		if prefix != "" {
+			if !strings.HasPrefix(key, prefix) {
+				continue
+			}
+			key = strings.TrimPrefix(key, prefix)
+		} else if strings.HasPrefix(key, trailerPrefix) || isProtocolHeader(key) {
+			continue
+		}
+		key = strings.ToLower(key)
+		for _, v := range values {
+			if strings.HasSuffix(key, "-bin") {
+				b, err := decodeBinary(v)
+				if err != nil {
+					return nil, fmt.Errorf("failed to decode header %s: %w", key, err)
+				}
+				v = string(b)
+			}
+			md.Append(key, v)
+		}
+	}
+	return md, nil
+}
+
+// decodeBinary decodes base64 with or without padding.
+func decodeBinary(s string) ([]byte, error) {
+	if strings.HasSuffix(s, "=") {
+		return base64.StdEncoding.DecodeString(s)
+	}
+	return base64.RawStdEncoding.DecodeString(s)
+}
+
+// formatTimeout returns the value of the timeout header for d, rounded up to
+// the millisecond.
+func formatTimeout(d time.Duration) string {
+	ms := (d + time.Millisecond - 1) / time.Millisecond
+	if ms < 1 {
+		ms = 1
+	}
+	return strconv.FormatInt(int64(ms), 10)
+}
@@ -0,0 +1,274 @@
+package connect_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elliot14A/meterus-go/connect"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const echoMethod = "/meterus.test.v1.EchoService/Echo"
+
+// echoFunc implements the Echo method of a test service.
+type echoFunc func(ctx context.Context, req *wrapperspb.StringValue) (*wrapperspb.StringValue, error)
+
+var echoServiceDesc = grpc.ServiceDesc{
+	ServiceName: "meterus.test.v1.EchoService",
+	HandlerType: (*any)(nil),
+	Methods: []grpc.MethodDesc{{
+		MethodName: "Echo",
+		Handler: func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+			in := new(wrapperspb.StringValue)
+			if err := dec(in); err != nil {
+				return nil, err
+			}
+			handler := func(ctx context.Context, req any) (any, error) {
+				return srv.(echoFunc)(ctx, req.(*wrapperspb.StringValue))
+			}
+			if interceptor == nil {
+				return handler(ctx, in)
+			}
+			return interceptor(ctx, in, &grpc.UnaryServerInfo{Server: srv, FullMethod: echoMethod}, handler)
+		},
+	}},
+}
+
+// serveEcho serves fn over the Connect protocol and returns the server's URL.
+func serveEcho(t *testing.T, fn echoFunc) string {
+	t.Helper()
+	h := connect.NewHandler()
+	h.RegisterService(&echoServiceDesc, fn)
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func echo(ctx context.Context, conn *connect.Conn, value string, opts ...grpc.CallOption) (*wrapperspb.StringValue, error) {
+	res := new(wrapperspb.StringValue)
+	err := conn.Invoke(ctx, echoMethod, wrapperspb.String(value), res, opts...)
+	return res, err
+}
+
+func TestUnaryRoundTrip(t *testing.T) {
+	url := serveEcho(t, func(_ context.Context, req *wrapperspb.StringValue) (*wrapperspb.StringValue, error) {
+		return wrapperspb.String("hello " + req.Value), nil
+	})
+	for name, opts := range map[string][]connect.Option{
+		"proto": nil,
+		"json":  {connect.WithJSON()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			conn := connect.NewConn(url+"/", opts...)
+			defer conn.Close()
+			res, err := echo(context.Background(), conn, "acme")
+			require.NoError(t, err)
+			assert.Equal(t, "hello acme", res.Value)
+		})
+	}
+
+	conn := connect.NewConn(url)
+	err := conn.Invoke(context.Background(), "/meterus.test.v1.EchoService/Missing", wrapperspb.String(""), new(wrapperspb.StringValue))
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+}
+
+func TestErrorsKeepCodeAndDetails(t *testing.T) {
+	for _, code := range []codes.Code{codes.InvalidArgument, codes.NotFound, codes.PermissionDenied, codes.ResourceExhausted, codes.Unavailable, codes.Internal} {
+		t.Run(code.String(), func(t *testing.T) {
+			url := serveEcho(t, func(context.Context, *wrapperspb.StringValue) (*wrapperspb.StringValue, error) {
+				s, err := status.New(code, "went wrong").WithDetails(
+					&errdetails.ErrorInfo{Reason: "TEST", Domain: "meterus", Metadata: map[string]string{"k": "v"}},
+					&errdetails.RetryInfo{RetryDelay: durationpb.New(3 * time.Second)},
+				)
+				require.NoError(t, err)
+				return nil, s.Err()
+			})
+			for name, opts := range map[string][]connect.Option{
+				"proto": nil,
+				"json":  {connect.WithJSON()},
+			} {
+				t.Run(name, func(t *testing.T) {
+					_, err := echo(context.Background(), connect.NewConn(url, opts...), "acme")
+					s := status.Convert(err)
+					assert.Equal(t, code, s.Code())
+					assert.Equal(t, "went wrong", s.Message())
+					details := s.Details()
+					require.Len(t, details, 2)
+					info, ok := details[0].(*errdetails.ErrorInfo)
+					require.True(t, ok, "got %T", details[0])
+					assert.Equal(t, "TEST", info.Reason)
+					assert.Equal(t, map[string]string{"k": "v"}, info.Metadata)
+					retry, ok := details[1].(*errdetails.RetryInfo)
+					require.True(t, ok, "got %T", details[1])
+					assert.Equal(t, 3*time.Second, retry.RetryDelay.AsDuration())
+				})
+			}
+		})
+	}
+}
+
+func TestErrorsFromProxies(t *testing.T) {
+	tests := map[int]codes.Code{
+		http.StatusBadGateway:         codes.Unavailable,
+		http.StatusServiceUnavailable: codes.Unavailable,
+		http.StatusUnauthorized:       codes.Unauthenticated,
+		http.StatusNotFound:           codes.Unimplemented,
+		http.StatusTeapot:             codes.Unknown,
+	}
+	for httpStatus, code := range tests {
+		t.Run(strconv.Itoa(httpStatus), func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				http.Error(w, "upstream failed", httpStatus)
+			}))
+			defer srv.Close()
+			_, err := echo(context.Background(), connect.NewConn(srv.URL), "acme")
+			assert.Equal(t, code, status.Code(err))
+			assert.Contains(t, status.Convert(err).Message(), "upstream failed")
+		})
+	}
+}
+
+func TestMetadataHeaders(t *testing.T) {
+	binary := string([]byte{0x00, 0xff, 0x10, '='})
+	var (
+		mu       sync.Mutex
+		incoming metadata.MD
+	)
+	url := serveEcho(t, func(ctx context.Context, req *wrapperspb.StringValue) (*wrapperspb.StringValue, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		mu.Lock()
+		incoming = md
+		mu.Unlock()
+		require.NoError(t, grpc.SetHeader(ctx, metadata.Pairs("x-header", "h", "header-bin", binary)))
+		require.NoError(t, grpc.SetTrailer(ctx, metadata.Pairs("x-trailer", "t", "trailer-bin", binary)))
+		return req, nil
+	})
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(),
+		"authorization", "Bearer key", "x-request-id", "r1", "x-request-id", "r2", "trace-bin", binary)
+	var header, trailer metadata.MD
+	_, err := echo(ctx, connect.NewConn(url), "acme", grpc.Header(&header), grpc.Trailer(&trailer))
+	require.NoError(t, err)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"Bearer key"}, incoming.Get("authorization"))
+	assert.Equal(t, []string{"r1", "r2"}, incoming.Get("x-request-id"))
+	assert.Equal(t, []string{binary}, incoming.Get("trace-bin"), "binary metadata must survive the round trip")
+	assert.Empty(t, incoming.Get("connect-protocol-version"), "protocol headers are not metadata")
+
+	assert.Equal(t, []string{"h"}, header.Get("x-header"))
+	assert.Equal(t, []string{binary}, header.Get("header-bin"))
+	assert.Empty(t, header.Get("x-trailer"), "trailers must not be reported as headers")
+	assert.Equal(t, []string{"t"}, trailer.Get("x-trailer"))
+	assert.Equal(t, []string{binary}, trailer.Get("trailer-bin"))
+}
+
+func TestInvalidBinaryHeader(t *testing.T) {
+	url := serveEcho(t, func(_ context.Context, req *wrapperspb.StringValue) (*wrapperspb.StringValue, error) {
+		return req, nil
+	})
+	res := post(t, url, map[string]string{"Trace-Bin": "not base64!"})
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	assert.Equal(t, "invalid_argument", decodeCode(t, res))
+}
+
+func TestTimeoutHeader(t *testing.T) {
+	var (
+		mu        sync.Mutex
+		header    string
+		remaining time.Duration
+	)
+	h := connect.NewHandler()
+	h.RegisterService(&echoServiceDesc, echoFunc(func(ctx context.Context, req *wrapperspb.StringValue) (*wrapperspb.StringValue, error) {
+		if deadline, ok := ctx.Deadline(); ok {
+			mu.Lock()
+			remaining = time.Until(deadline)
+			mu.Unlock()
+		}
+		if req.Value == "block" {
+			<-ctx.Done()
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
+		return req, nil
+	}))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		header = r.Header.Get("Connect-Timeout-Ms")
+		mu.Unlock()
+		h.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	conn := connect.NewConn(srv.URL)
+
+	_, err := echo(context.Background(), conn, "acme")
+	require.NoError(t, err)
+	mu.Lock()
+	assert.Empty(t, header, "calls without a deadline must not send a timeout")
+	mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = echo(ctx, conn, "acme")
+	require.NoError(t, err)
+	mu.Lock()
+	ms, err := strconv.Atoi(header)
+	require.NoError(t, err)
+	assert.InDelta(t, 5000, ms, 100, "the timeout must be the time left to the deadline")
+	assert.InDelta(t, 5*time.Second, remaining, float64(200*time.Millisecond), "the handler must get the caller's deadline")
+	mu.Unlock()
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = echo(ctx, conn, "block")
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+
+	for _, v := range []string{"soon", "-1", "12345678901"} {
+		res := post(t, srv.URL, map[string]string{"Connect-Timeout-Ms": v})
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode, v)
+		assert.Equal(t, "invalid_argument", decodeCode(t, res), v)
+	}
+}
+
+// post sends an Echo request with the given headers.
+func post(t *testing.T, url string, headers map[string]string) *http.Response {
+	t.Helper()
+	b, err := proto.Marshal(wrapperspb.String("acme"))
+	require.NoError(t, err)
+	req, err := http.NewRequest(http.MethodPost, url+echoMethod, strings.NewReader(string(b)))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/proto")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { res.Body.Close() })
+	return res
+}
+
+// decodeCode returns the code of an error response.
+func decodeCode(t *testing.T, res *http.Response) string {
+	t.Helper()
+	var body struct {
+		Code string `json:"code"`
+	}
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+	return body.Code
+}
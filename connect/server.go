@@ -0,0 +1,216 @@
+package connect
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// Handler serves the unary methods of the services registered on it over the
+// Connect protocol. It implements grpc.ServiceRegistrar, so generated
+// RegisterXServer functions accept it.
+type Handler struct {
+	interceptor grpc.UnaryServerInterceptor
+
+	mu      sync.RWMutex
+	methods map[string]method
+}
+
+var _ grpc.ServiceRegistrar = (*Handler)(nil)
+
+// method is a registered unary method.
+type method struct {
+	impl any
+	desc grpc.MethodDesc
+}
+
+// HandlerOption configures a Handler.
+type HandlerOption func(*Handler)
+
+// WithInterceptors adds interceptors to the calls served by the Handler, as
+// grpc.ChainUnaryInterceptor does for a gRPC server. The first one is the
+// outermost.
+func WithInterceptors(interceptors ...grpc.UnaryServerInterceptor) HandlerOption {
+	return func(h *Handler) {
+		for _, i := range interceptors {
+			h.interceptor = chainInterceptors(h.interceptor, i)
+		}
+	}
+}
+
+// NewHandler returns a Handler without services.
+func NewHandler(opts ...HandlerOption) *Handler {
+	h := &Handler{methods: make(map[string]method)}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// RegisterService implements grpc.ServiceRegistrar.
+func (h *Handler) RegisterService(desc *grpc.ServiceDesc, impl any) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, md := range desc.Methods {
+		h.methods["/"+desc.ServiceName+"/"+md.MethodName] = method{impl: impl, desc: md}
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.RLock()
+	m, ok := h.methods[r.URL.Path]
+	h.mu.RUnlock()
+	if !ok {
+		writeError(w, nil, status.Errorf(codes.Unimplemented, "unknown method %s", r.URL.Path))
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	c, ok := codecFor(r.Header.Get("Content-Type"))
+	if !ok {
+		w.Header().Set("Accept-Post", protoContentType+", "+jsonContentType)
+		http.Error(w, http.StatusText(http.StatusUnsupportedMediaType), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	ctx := r.Context()
+	if v := r.Header.Get(timeoutHeader); v != "" {
+		ms, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || ms < 0 || len(v) > 10 {
+			writeError(w, nil, status.Errorf(codes.InvalidArgument, "invalid %s %q", timeoutHeader, v))
+			return
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(ms)*time.Millisecond)
+		defer cancel()
+	}
+	md, err := readMetadata(r.Header, "")
+	if err != nil {
+		writeError(w, nil, status.Error(codes.InvalidArgument, err.Error()))
+		return
+	}
+	ctx = metadata.NewIncomingContext(ctx, md)
+	stream := &serverStream{method: r.URL.Path}
+	ctx = grpc.NewContextWithServerTransportStream(ctx, stream)
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxMessageSize+1))
+	if err != nil {
+		writeError(w, stream, status.Errorf(codes.Unavailable, "failed to read request: %v", err))
+		return
+	}
+	if len(body) > maxMessageSize {
+		writeError(w, stream, status.Errorf(codes.ResourceExhausted, "request larger than %d bytes", maxMessageSize))
+		return
+	}
+	dec := func(v any) error {
+		if err := c.unmarshal(body, v.(proto.Message)); err != nil {
+			return status.Errorf(codes.InvalidArgument, "failed to decode request: %v", err)
+		}
+		return nil
+	}
+	res, err := m.desc.Handler(m.impl, ctx, dec, h.interceptor)
+	if err == nil && ctx.Err() != nil {
+		err = status.FromContextError(ctx.Err()).Err()
+	}
+	if err != nil {
+		writeError(w, stream, err)
+		return
+	}
+	b, err := c.marshal(res.(proto.Message))
+	if err != nil {
+		writeError(w, stream, status.Errorf(codes.Internal, "failed to encode response: %v", err))
+		return
+	}
+	stream.writeMetadata(w.Header())
+	w.Header().Set("Content-Type", c.contentType)
+	w.Write(b)
+}
+
+// writeError writes the error response for err, with the metadata set on
+// stream if it is not nil.
+func writeError(w http.ResponseWriter, stream *serverStream, err error) {
+	s := status.Convert(err)
+	if stream != nil {
+		stream.writeMetadata(w.Header())
+	}
+	we := wireError{Code: codeNames[s.Code()], Message: s.Message()}
+	if we.Code == "" {
+		we.Code = codeNames[codes.Unknown]
+	}
+	for _, d := range s.Proto().GetDetails() {
+		we.Details = append(we.Details, wireDetail{
+			Type:  strings.TrimPrefix(d.GetTypeUrl(), typeURLPrefix),
+			Value: base64.RawStdEncoding.EncodeToString(d.GetValue()),
+		})
+	}
+	w.Header().Set("Content-Type", jsonContentType)
+	w.WriteHeader(httpStatus(s.Code()))
+	_ = json.NewEncoder(w).Encode(we)
+}
+
+// serverStream collects the metadata a handler sets with grpc.SetHeader,
+// grpc.SendHeader and grpc.SetTrailer.
+type serverStream struct {
+	method string
+
+	mu      sync.Mutex
+	header  metadata.MD
+	trailer metadata.MD
+}
+
+func (s *serverStream) Method() string {
+	return s.method
+}
+
+func (s *serverStream) SetHeader(md metadata.MD) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func (s *serverStream) SendHeader(md metadata.MD) error {
+	return s.SetHeader(md)
+}
+
+func (s *serverStream) SetTrailer(md metadata.MD) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.trailer = metadata.Join(s.trailer, md)
+	return nil
+}
+
+func (s *serverStream) writeMetadata(h http.Header) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	setMetadata(h, s.header, "")
+	setMetadata(h, s.trailer, trailerPrefix)
+}
+
+// chainInterceptors returns an interceptor calling outer, then inner.
+func chainInterceptors(outer, inner grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	if outer == nil {
+		return inner
+	}
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		return outer(ctx, req, info, func(ctx context.Context, req any) (any, error) {
+			return inner(ctx, req, info, handler)
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package gateway
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+var pathVariable = regexp.MustCompile(`\{([a-z_]+)\}`)
+
+// pathVariables returns the names of the variables of a route pattern.
+func pathVariables(pattern string) []string {
+	var names []string
+	for _, m := range pathVariable.FindAllStringSubmatch(pattern, -1) {
+		names = append(names, m[1])
+	}
+	return names
+}
+
+// bindQuery sets the fields of msg from query parameters named after them,
+// by JSON or proto name. Repeated fields take every value of their parameter,
+// and map fields take parameters of the form name[key].
+func bindQuery(msg protoreflect.Message, query url.Values) error {
+	for param, values := range query {
+		name, key, isMap := strings.Cut(param, "[")
+		if isMap {
+			if !strings.HasSuffix(key, "]") {
+				return fmt.Errorf("invalid query parameter %q", param)
+			}
+			key = strings.TrimSuffix(key, "]")
+		}
+		fd := fieldByName(msg.Descriptor(), name)
+		if fd == nil {
+			return fmt.Errorf("unknown query parameter %q", param)
+		}
+		if fd.IsMap() != isMap {
+			return fmt.Errorf("invalid query parameter %q", param)
+		}
+
+		switch {
+		case fd.IsMap():
+			if err := setMapEntry(msg, fd, key, values); err != nil {
+				return err
+			}
+		case fd.IsList():
+			list := msg.Mutable(fd).List()
+			for _, v := range values {
+				value, err := parseValue(fd, v)
+				if err != nil {
+					return err
+				}
+				list.Append(value)
+			}
+		default:
+			if err := setField(msg, fd, values[len(values)-1]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func fieldByName(md protoreflect.MessageDescriptor, name string) protoreflect.FieldDescriptor {
+	if fd := md.Fields().ByJSONName(name); fd != nil {
+		return fd
+	}
+	return md.Fields().ByName(protoreflect.Name(name))
+}
+
+// setMapEntry sets the entry key of the map field fd. Values whose message has
+// a single repeated field, like FilterGroupValues, take every value.
+func setMapEntry(msg protoreflect.Message, fd protoreflect.FieldDescriptor, key string, values []string) error {
+	m := msg.Mutable(fd).Map()
+	vd := fd.MapValue()
+	if vd.Kind() != protoreflect.MessageKind {
+		value, err := parseValue(vd, values[len(values)-1])
+		if err != nil {
+			return err
+		}
+		m.Set(protoreflect.ValueOfString(key).MapKey(), value)
+		return nil
+	}
+	fields := vd.Message().Fields()
+	if fields.Len() != 1 || !fields.Get(0).IsList() {
+		return fmt.Errorf("field %s cannot be set from the query string", fd.JSONName())
+	}
+	entry := m.NewValue()
+	list := entry.Message().Mutable(fields.Get(0)).List()
+	for _, v := range values {
+		value, err := parseValue(fields.Get(0), v)
+		if err != nil {
+			return err
+		}
+		list.Append(value)
+	}
+	m.Set(protoreflect.ValueOfString(key).MapKey(), entry)
+	return nil
+}
+
+// setField sets the singular field fd of msg from s.
+func setField(msg protoreflect.Message, fd protoreflect.FieldDescriptor, s string) error {
+	value, err := parseValue(fd, s)
+	if err != nil {
+		return err
+	}
+	msg.Set(fd, value)
+	return nil
+}
+
+// parseValue parses s as a value of fd. Messages are parsed from their JSON
+// string form, which covers well-known types such as Timestamp and Duration.
+func parseValue(fd protoreflect.FieldDescriptor, s string) (protoreflect.Value, error) {
+	var (
+		v   protoreflect.Value
+		err error
+	)
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		v = protoreflect.ValueOfString(s)
+	case protoreflect.BytesKind:
+		var b []byte
+		if b, err = base64.StdEncoding.DecodeString(s); err == nil {
+			v = protoreflect.ValueOfBytes(b)
+		}
+	case protoreflect.BoolKind:
+		var b bool
+		if b, err = strconv.ParseBool(s); err == nil {
+			v = protoreflect.ValueOfBool(b)
+		}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		var n int64
+		if n, err = strconv.ParseInt(s, 10, 32); err == nil {
+			v = protoreflect.ValueOfInt32(int32(n))
+		}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		var n int64
+		if n, err = strconv.ParseInt(s, 10, 64); err == nil {
+			v = protoreflect.ValueOfInt64(n)
+		}
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		var n uint64
+		if n, err = strconv.ParseUint(s, 10, 32); err == nil {
+			v = protoreflect.ValueOfUint32(uint32(n))
+		}
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		var n uint64
+		if n, err = strconv.ParseUint(s, 10, 64); err == nil {
+			v = protoreflect.ValueOfUint64(n)
+		}
+	case protoreflect.FloatKind:
+		var f float64
+		if f, err = strconv.ParseFloat(s, 32); err == nil {
+			v = protoreflect.ValueOfFloat32(float32(f))
+		}
+	case protoreflect.DoubleKind:
+		var f float64
+		if f, err = strconv.ParseFloat(s, 64); err == nil {
+			v = protoreflect.ValueOfFloat64(f)
+		}
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByName(protoreflect.Name(s)); ev != nil {
+			v = protoreflect.ValueOfEnum(ev.Number())
+		} else {
+			var n int64
+			if n, err = strconv.ParseInt(s, 10, 32); err == nil {
+				v = protoreflect.ValueOfEnum(protoreflect.EnumNumber(n))
+			}
+		}
+	case protoreflect.MessageKind:
+		var mt protoreflect.MessageType
+		if mt, err = protoregistry.GlobalTypes.FindMessageByName(fd.Message().FullName()); err == nil {
+			m := mt.New()
+			if err = protojson.Unmarshal([]byte(strconv.Quote(s)), m.Interface()); err == nil {
+				v = protoreflect.ValueOfMessage(m)
+			}
+		}
+	default:
+		err = fmt.Errorf("unsupported kind %s", fd.Kind())
+	}
+	if err != nil {
+		return protoreflect.Value{}, fmt.Errorf("invalid value %q for %s: %w", s, fd.JSONName(), err)
+	}
+	return v, nil
+}
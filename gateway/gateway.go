@@ -0,0 +1,299 @@
+// Package gateway serves the Meterus gRPC services as a REST/JSON API, for
+// consumers that cannot speak gRPC.
+//
+// Requests and responses are encoded with protojson, the Authorization header
+// is forwarded to Meterus, and gRPC status codes are translated to HTTP
+// statuses. The gateway serves an OpenAPI document describing its routes at
+// /openapi.json:
+//
+//	conn, err := grpc.NewClient("meterus:50051", grpc.WithTransportCredentials(insecure.NewCredentials()))
+//	...
+//	http.ListenAndServe(":8080", gateway.New(conn))
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	meter "github.com/elliot14A/meterus-go/meters/v1"
+	subject "github.com/elliot14A/meterus-go/subject/v1"
+	validation "github.com/elliot14A/meterus-go/validation/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// OpenAPIPath is the path the OpenAPI document is served at.
+const OpenAPIPath = "/openapi.json"
+
+// maxBodySize limits the size of request bodies.
+const maxBodySize = 4 << 20
+
+// Gateway is an http.Handler translating REST/JSON requests into calls to the
+// Meterus services.
+type Gateway struct {
+	routes  []route
+	mux     *http.ServeMux
+	openAPI []byte
+}
+
+// route maps an HTTP method and path onto a unary call. Path variables are
+// named after the request fields they set, unless fields maps them to
+// another field.
+type route struct {
+	method    string
+	pattern   string
+	operation string
+	summary   string
+	// body reports whether the request message is read from the request
+	// body. Otherwise its fields are read from the query string.
+	body bool
+	// status is the HTTP status of a successful response.
+	status int
+	// fields maps path variables to the request fields they set, where the
+	// two names differ.
+	fields   map[string]protoreflect.Name
+	request  protoreflect.MessageDescriptor
+	response protoreflect.MessageDescriptor
+	newReq   func() proto.Message
+	call     func(ctx context.Context, req proto.Message) (proto.Message, error)
+}
+
+// newRoute returns a route calling the unary method call of a generated
+// client.
+func newRoute[Req, Res proto.Message](method, pattern, operation, summary string, body bool, call func(context.Context, Req, ...grpc.CallOption) (Res, error)) route {
+	var req Req
+	var res Res
+	r := route{
+		method:    method,
+		pattern:   pattern,
+		operation: operation,
+		summary:   summary,
+		body:      body,
+		status:    http.StatusOK,
+		request:   req.ProtoReflect().Descriptor(),
+		response:  res.ProtoReflect().Descriptor(),
+		newReq:    func() proto.Message { return req.ProtoReflect().New().Interface() },
+		call: func(ctx context.Context, in proto.Message) (proto.Message, error) {
+			return call(ctx, in.(Req))
+		},
+	}
+	if r.response.FullName() == (&emptypb.Empty{}).ProtoReflect().Descriptor().FullName() {
+		r.status = http.StatusNoContent
+	} else if method == http.MethodPost && strings.HasPrefix(operation, "Create") {
+		r.status = http.StatusCreated
+	}
+	return r
+}
+
+// withPathField returns r with the path variable name setting the request
+// field, for routes whose variable is named more precisely than the field.
+func (r route) withPathField(name string, field protoreflect.Name) route {
+	fields := make(map[string]protoreflect.Name, len(r.fields)+1)
+	for k, v := range r.fields {
+		fields[k] = v
+	}
+	fields[name] = field
+	r.fields = fields
+	return r
+}
+
+// pathField returns the request field set by the path variable name.
+func (r route) pathField(name string) protoreflect.FieldDescriptor {
+	field, ok := r.fields[name]
+	if !ok {
+		field = protoreflect.Name(name)
+	}
+	return r.request.Fields().ByName(field)
+}
+
+// New returns a Gateway calling Meterus over conn.
+func New(conn grpc.ClientConnInterface) *Gateway {
+	metering := meter.NewMeteringServiceClient(conn)
+	subjects := subject.NewSubjectServiceClient(conn)
+	keys := validation.NewValidationServiceClient(conn)
+
+	g := &Gateway{
+		routes: []route{
+			newRoute("POST", "/v1/events", "Ingest", "Ingest an event", true, metering.Ingest),
+			newRoute("GET", "/v1/meters", "ListMeters", "List meters", false, metering.ListMeters),
+			newRoute("POST", "/v1/meters", "CreateMeter", "Create a meter", true, metering.CreateMeter),
+			newRoute("GET", "/v1/meters/{meter_id_or_slug}", "GetMeter", "Get a meter by ID or slug", false, metering.GetMeter),
+			newRoute("DELETE", "/v1/meters/{meter_id_or_slug}", "DeleteMeter", "Delete a meter", false, metering.DeleteMeter),
+			newRoute("GET", "/v1/meters/{meter_id_or_slug}/query", "QueryMeter", "Query the values of a meter", false, metering.QueryMeter),
+			newRoute("GET", "/v1/meters/{meter_id_or_slug}/subjects", "ListMeterSubjects", "List the subjects with events for a meter", false, metering.ListMeterSubjects),
+
+			newRoute("POST", "/v1/subjects", "CreateSubject", "Create a subject", true, subjects.CreateSubject),
+			newRoute("GET", "/v1/subjects", "ListSubjects", "List subjects", false, subjects.ListSubjects),
+			newRoute("GET", "/v1/subjects/{subject_id}", "GetSubject", "Get a subject", false, subjects.GetSubject),
+			newRoute("PUT", "/v1/subjects/{subject_id}", "UpdateSubject", "Update a subject", true, subjects.UpdateSubject).withPathField("subject_id", "id"),
+			newRoute("DELETE", "/v1/subjects/{subject_id}", "DeleteSubject", "Delete a subject", false, subjects.DeleteSubject),
+
+			newRoute("POST", "/v1/validate", "ValidateApiKey", "Validate the API key of the request", true, keys.ValidateApiKey),
+			newRoute("POST", "/v1/validate-and-meter", "ValidateAndMeter", "Validate the API key of the request and ingest an event", true, keys.ValidateAndMeter),
+			newRoute("POST", "/v1/api-keys", "CreateApiKey", "Create an API key", true, keys.CreateApiKey),
+			newRoute("GET", "/v1/api-keys", "ListApiKeys", "List API keys", false, keys.ListApiKeys),
+			newRoute("DELETE", "/v1/api-keys/{api_key_id}", "RevokeApiKey", "Revoke an API key", false, keys.RevokeApiKey),
+			newRoute("POST", "/v1/api-keys/{api_key_id}/rotate", "RotateApiKey", "Rotate the secret of an API key", true, keys.RotateApiKey),
+		},
+		mux: http.NewServeMux(),
+	}
+	for _, r := range g.routes {
+		for _, name := range pathVariables(r.pattern) {
+			if r.pathField(name) == nil {
+				panic(fmt.Sprintf("gateway: path variable %q of %s %s sets no field of %s", name, r.method, r.pattern, r.request.FullName()))
+			}
+		}
+		g.mux.Handle(r.method+" "+r.pattern, g.handler(r))
+	}
+
+	doc, err := json.MarshalIndent(g.document(), "", "  ")
+	if err != nil {
+		// The document only holds maps, slices and strings.
+		panic(err)
+	}
+	g.openAPI = doc
+	g.mux.HandleFunc("GET "+OpenAPIPath, func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(g.openAPI)
+	})
+	return g
+}
+
+// ServeHTTP implements http.Handler.
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.mux.ServeHTTP(w, r)
+}
+
+// OpenAPI returns the OpenAPI 3 document describing the gateway's routes, as
+// JSON.
+func (g *Gateway) OpenAPI() []byte {
+	return append([]byte(nil), g.openAPI...)
+}
+
+func (g *Gateway) handler(rt route) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := rt.newReq()
+		if err := bindRequest(w, rt, r, req.ProtoReflect()); err != nil {
+			s := status.New(codes.InvalidArgument, err.Error())
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeStatus(w, http.StatusRequestEntityTooLarge, s)
+				return
+			}
+			writeError(w, s.Err())
+			return
+		}
+
+		ctx := r.Context()
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, "authorization", auth)
+		}
+		res, err := rt.call(ctx, req)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if rt.status == http.StatusNoContent {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		b, err := protojson.MarshalOptions{EmitUnpopulated: true}.Marshal(res)
+		if err != nil {
+			writeError(w, status.Errorf(codes.Internal, "failed to encode response: %v", err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(rt.status)
+		w.Write(b)
+	})
+}
+
+// bindRequest fills req from the path variables of r and from either its body
+// or its query string.
+func bindRequest(w http.ResponseWriter, rt route, r *http.Request, req protoreflect.Message) error {
+	if rt.body {
+		b, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+		if err != nil {
+			return fmt.Errorf("failed to read request body: %w", err)
+		}
+		if len(b) > 0 {
+			if err := protojson.Unmarshal(b, req.Interface()); err != nil {
+				return fmt.Errorf("invalid request body: %w", err)
+			}
+		}
+	} else if err := bindQuery(req, r.URL.Query()); err != nil {
+		return err
+	}
+	for _, name := range pathVariables(rt.pattern) {
+		if err := setField(req, rt.pathField(name), r.PathValue(name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// errorBody is the body of error responses.
+type errorBody struct {
+	Error   string `json:"error"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	s, _ := status.FromError(err)
+	writeStatus(w, HTTPStatusFromCode(s.Code()), s)
+}
+
+// writeStatus writes s as a JSON error body with the HTTP status code.
+func writeStatus(w http.ResponseWriter, code int, s *status.Status) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(errorBody{
+		Error:   http.StatusText(code),
+		Code:    s.Code().String(),
+		Message: s.Message(),
+	})
+}
+
+// HTTPStatusFromCode returns the HTTP status the gateway responds with for a
+// gRPC status code.
+func HTTPStatusFromCode(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		// Client closed request, as used by nginx.
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,237 @@
+package gateway_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elliot14A/meterus-go/gateway"
+	meter "github.com/elliot14A/meterus-go/meters/v1"
+	"github.com/elliot14A/meterus-go/meterustest"
+	subject "github.com/elliot14A/meterus-go/subject/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func serve(g *gateway.Gateway, method, target, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer key")
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, r)
+	return w
+}
+
+func TestGatewayRoutes(t *testing.T) {
+	tests := []struct {
+		method, target, body string
+		call                 string
+		req                  proto.Message
+		status               int
+	}{
+		{
+			method: "POST", target: "/v1/meters", body: `{"slug":"tokens","aggregation":"AGGREGATION_SUM"}`,
+			call:   "/meterus.meter.v1.MeteringService/CreateMeter",
+			req:    &meter.CreateMeterRequest{Slug: "tokens", Aggregation: meter.Aggregation_AGGREGATION_SUM},
+			status: http.StatusCreated,
+		},
+		{
+			method: "GET", target: "/v1/meters/tokens",
+			call:   "/meterus.meter.v1.MeteringService/GetMeter",
+			req:    &meter.MeterId{MeterIdOrSlug: "tokens"},
+			status: http.StatusOK,
+		},
+		{
+			method: "DELETE", target: "/v1/meters/tokens",
+			call:   "/meterus.meter.v1.MeteringService/DeleteMeter",
+			req:    &meter.MeterId{MeterIdOrSlug: "tokens"},
+			status: http.StatusNoContent,
+		},
+		{
+			method: "PUT", target: "/v1/subjects/acme", body: `{"displayName":"Acme"}`,
+			call:   "/meterus.subject.v1.SubjectService/UpdateSubject",
+			req:    &subject.Subject{Id: "acme", DisplayName: proto.String("Acme")},
+			status: http.StatusOK,
+		},
+		{
+			method: "GET", target: "/v1/subjects/acme",
+			call:   "/meterus.subject.v1.SubjectService/GetSubject",
+			req:    &subject.SubjectId{SubjectId: "acme"},
+			status: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.target, func(t *testing.T) {
+			conn := &meterustest.StubConn{}
+			w := serve(gateway.New(conn), tt.method, tt.target, tt.body)
+			assert.Equal(t, tt.status, w.Code, w.Body.String())
+			calls := conn.Calls()
+			require.Len(t, calls, 1)
+			assert.Equal(t, tt.call, calls[0].Method)
+			assert.Empty(t, cmpProto(tt.req, calls[0].Args[0].(proto.Message)))
+			assert.Equal(t, []string{"Bearer key"}, calls[0].Args[1].(metadata.MD).Get("authorization"), "the Authorization header must be forwarded")
+		})
+	}
+
+	g := gateway.New(&meterustest.StubConn{})
+	assert.Equal(t, http.StatusNotFound, serve(g, "GET", "/v1/unknown", "").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(g, "PATCH", "/v1/meters", "").Code)
+}
+
+func TestGatewayEncodesResponses(t *testing.T) {
+	conn := &meterustest.StubConn{InvokeFunc: func(context.Context, string, proto.Message) (proto.Message, error) {
+		return &meter.Meter{Slug: "tokens", Aggregation: meter.Aggregation_AGGREGATION_SUM}, nil
+	}}
+	w := serve(gateway.New(conn), "GET", "/v1/meters/tokens", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "tokens", body["slug"])
+	assert.Equal(t, "AGGREGATION_SUM", body["aggregation"])
+	assert.Equal(t, []any{}, body["groupBy"], "unpopulated fields must be emitted")
+}
+
+func TestGatewayBindsQuery(t *testing.T) {
+	conn := &meterustest.StubConn{}
+	g := gateway.New(conn)
+	w := serve(g, "GET", "/v1/meters/tokens/query?from=2024-01-01T00:00:00Z&subject=acme&subject=globex"+
+		"&filterGroupBy[model]=gpt-4&filterGroupBy[model]=gpt-5&filterGroupBy[region]=eu&window_size=DAY", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	calls := conn.Calls()
+	require.Len(t, calls, 1)
+	assert.Empty(t, cmpProto(&meter.QueryMeterRequest{
+		MeterIdOrSlug: "tokens",
+		From:          timestamppb.New(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)),
+		Subject:       []string{"acme", "globex"},
+		FilterGroupBy: map[string]*meter.FilterGroupValues{
+			"model":  {Values: []string{"gpt-4", "gpt-5"}},
+			"region": {Values: []string{"eu"}},
+		},
+		WindowSize: "DAY",
+	}, calls[0].Args[0].(proto.Message)))
+
+	for _, query := range []string{"unknown=1", "from=yesterday", "subject[a]=b", "filterGroupBy=gpt-4", "filterGroupBy[model=gpt-4"} {
+		t.Run(query, func(t *testing.T) {
+			conn := &meterustest.StubConn{}
+			w := serve(gateway.New(conn), "GET", "/v1/meters/tokens/query?"+query, "")
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Contains(t, w.Body.String(), `"code":"InvalidArgument"`)
+			assert.Empty(t, conn.Calls(), "invalid requests must not be forwarded")
+		})
+	}
+}
+
+func TestGatewayMapsStatusCodes(t *testing.T) {
+	tests := map[codes.Code]int{
+		codes.InvalidArgument:   http.StatusBadRequest,
+		codes.Unauthenticated:   http.StatusUnauthorized,
+		codes.PermissionDenied:  http.StatusForbidden,
+		codes.NotFound:          http.StatusNotFound,
+		codes.AlreadyExists:     http.StatusConflict,
+		codes.ResourceExhausted: http.StatusTooManyRequests,
+		codes.Unavailable:       http.StatusServiceUnavailable,
+		codes.DeadlineExceeded:  http.StatusGatewayTimeout,
+		codes.Canceled:          499,
+		codes.Internal:          http.StatusInternalServerError,
+	}
+	for code, want := range tests {
+		t.Run(code.String(), func(t *testing.T) {
+			assert.Equal(t, want, gateway.HTTPStatusFromCode(code))
+
+			conn := &meterustest.StubConn{InvokeFunc: func(context.Context, string, proto.Message) (proto.Message, error) {
+				return nil, status.Error(code, "went wrong")
+			}}
+			w := serve(gateway.New(conn), "GET", "/v1/meters/tokens", "")
+			assert.Equal(t, want, w.Code)
+			var body map[string]string
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+			assert.Equal(t, map[string]string{
+				"error":   http.StatusText(want),
+				"code":    code.String(),
+				"message": "went wrong",
+			}, body)
+		})
+	}
+}
+
+func TestGatewayLimitsBodySize(t *testing.T) {
+	conn := &meterustest.StubConn{}
+	g := gateway.New(conn)
+	body := `{"id":"` + strings.Repeat("x", 4<<20) + `"}`
+	w := serve(g, "POST", "/v1/events", body)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"InvalidArgument"`)
+	assert.Empty(t, conn.Calls(), "oversized requests must not be forwarded")
+
+	w = serve(g, "POST", "/v1/events", `{"id":`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestGatewayOpenAPI(t *testing.T) {
+	g := gateway.New(&meterustest.StubConn{})
+	w := serve(g, "GET", gateway.OpenAPIPath, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.JSONEq(t, string(g.OpenAPI()), w.Body.String())
+
+	var doc struct {
+		OpenAPI string `json:"openapi"`
+		Paths   map[string]map[string]struct {
+			OperationID string `json:"operationId"`
+			Parameters  []struct {
+				Name  string `json:"name"`
+				In    string `json:"in"`
+				Style string `json:"style"`
+			} `json:"parameters"`
+			RequestBody json.RawMessage            `json:"requestBody"`
+			Responses   map[string]json.RawMessage `json:"responses"`
+		} `json:"paths"`
+		Components struct {
+			Schemas map[string]json.RawMessage `json:"schemas"`
+		} `json:"components"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	assert.Equal(t, "3.0.3", doc.OpenAPI)
+
+	update := doc.Paths["/v1/subjects/{subject_id}"]["put"]
+	assert.Equal(t, "UpdateSubject", update.OperationID)
+	require.Len(t, update.Parameters, 1)
+	assert.Equal(t, "subject_id", update.Parameters[0].Name)
+	assert.Equal(t, "path", update.Parameters[0].In)
+	assert.NotEmpty(t, update.RequestBody)
+	assert.Contains(t, update.Responses, "200")
+
+	assert.Contains(t, doc.Paths["/v1/meters"]["post"].Responses, "201")
+	assert.Contains(t, doc.Paths["/v1/meters/{meter_id_or_slug}"]["delete"].Responses, "204")
+
+	query := doc.Paths["/v1/meters/{meter_id_or_slug}/query"]["get"]
+	params := make(map[string]string)
+	for _, p := range query.Parameters {
+		params[p.Name] = p.In + " " + p.Style
+	}
+	assert.Equal(t, "path ", params["meter_id_or_slug"])
+	assert.Equal(t, "query deepObject", params["filterGroupBy"])
+	assert.NotContains(t, params, "meterIdOrSlug", "path variables must not be query parameters")
+
+	assert.Contains(t, doc.Components.Schemas, "Error")
+	assert.Contains(t, doc.Components.Schemas, "meterus.meter.v1.Meter")
+}
+
+// cmpProto returns the differences between two messages, or "" if they are
+// equal.
+func cmpProto(want, got proto.Message) string {
+	if proto.Equal(want, got) {
+		return ""
+	}
+	return fmt.Sprintf("want %v, got %v", want, got)
+}
@@ -0,0 +1,239 @@
+package gateway
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// object is a JSON object of the OpenAPI document.
+type object = map[string]any
+
+// document returns the OpenAPI 3 document describing the routes of g. Schemas
+// are derived from the descriptors of the request and response messages,
+// following their protojson encoding.
+func (g *Gateway) document() object {
+	schemas := object{}
+	paths := object{}
+	for _, rt := range g.routes {
+		op := object{
+			"operationId": rt.operation,
+			"summary":     rt.summary,
+			"tags":        []string{tag(rt.pattern)},
+			"responses":   responses(rt, schemas),
+		}
+		params := []object{}
+		vars := make(map[protoreflect.Name]bool)
+		for _, name := range pathVariables(rt.pattern) {
+			fd := rt.pathField(name)
+			vars[fd.Name()] = true
+			params = append(params, object{
+				"name":     name,
+				"in":       "path",
+				"required": true,
+				"schema":   fieldSchema(fd, schemas),
+			})
+		}
+		if rt.body {
+			op["requestBody"] = object{
+				"required": true,
+				"content": object{
+					"application/json": object{"schema": messageSchema(rt.request, schemas)},
+				},
+			}
+		} else {
+			params = append(params, queryParameters(rt.request, vars, schemas)...)
+		}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+
+		item, _ := paths[rt.pattern].(object)
+		if item == nil {
+			item = object{}
+			paths[rt.pattern] = item
+		}
+		item[strings.ToLower(rt.method)] = op
+	}
+
+	schemas["Error"] = object{
+		"type": "object",
+		"properties": object{
+			"error":   object{"type": "string", "description": "HTTP status text"},
+			"code":    object{"type": "string", "description": "gRPC status code"},
+			"message": object{"type": "string"},
+		},
+	}
+	return object{
+		"openapi": "3.0.3",
+		"info": object{
+			"title":   "Meterus",
+			"version": "v1",
+		},
+		"paths": paths,
+		"components": object{
+			"schemas": schemas,
+			"securitySchemes": object{
+				"apiKey": object{"type": "apiKey", "in": "header", "name": "Authorization"},
+			},
+		},
+		"security": []object{{"apiKey": []string{}}},
+	}
+}
+
+// tag groups routes by the first segment after the version.
+func tag(pattern string) string {
+	segments := strings.Split(strings.TrimPrefix(pattern, "/"), "/")
+	if len(segments) < 2 {
+		return pattern
+	}
+	return segments[1]
+}
+
+func responses(rt route, schemas object) object {
+	errorResponse := object{
+		"description": "Error",
+		"content": object{
+			"application/json": object{"schema": object{"$ref": "#/components/schemas/Error"}},
+		},
+	}
+	ok := object{"description": http.StatusText(rt.status)}
+	if rt.status != http.StatusNoContent {
+		ok["content"] = object{
+			"application/json": object{"schema": messageSchema(rt.response, schemas)},
+		}
+	}
+	return object{
+		strconv.Itoa(rt.status): ok,
+		"default":               errorResponse,
+	}
+}
+
+// queryParameters describes the fields of md that can be set from the query
+// string, skipping path variables.
+func queryParameters(md protoreflect.MessageDescriptor, vars map[protoreflect.Name]bool, schemas object) []object {
+	var params []object
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if vars[fd.Name()] {
+			continue
+		}
+		param := object{
+			"name":   fd.JSONName(),
+			"in":     "query",
+			"schema": fieldSchema(fd, schemas),
+		}
+		switch {
+		case fd.IsMap():
+			// Map entries are given as name[key]=value, see setMapEntry.
+			param["style"] = "deepObject"
+			param["explode"] = true
+			if vd := fd.MapValue(); vd.Kind() == protoreflect.MessageKind && vd.Message().Fields().Len() == 1 {
+				param["schema"] = object{
+					"type":                 "object",
+					"additionalProperties": fieldSchema(vd.Message().Fields().Get(0), schemas),
+				}
+			}
+		case fd.IsList():
+			param["explode"] = true
+		}
+		params = append(params, param)
+	}
+	return params
+}
+
+// messageSchema returns a reference to the schema of md, adding it and the
+// schemas of the messages it refers to to schemas.
+func messageSchema(md protoreflect.MessageDescriptor, schemas object) object {
+	if s := wellKnownSchema(md); s != nil {
+		return s
+	}
+	name := string(md.FullName())
+	ref := object{"$ref": "#/components/schemas/" + name}
+	if _, ok := schemas[name]; ok {
+		return ref
+	}
+	properties := object{}
+	schema := object{"type": "object", "properties": properties}
+	// Register the schema before descending, for recursive messages.
+	schemas[name] = schema
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		properties[fd.JSONName()] = fieldSchema(fd, schemas)
+	}
+	return ref
+}
+
+// fieldSchema returns the schema of the value of fd.
+func fieldSchema(fd protoreflect.FieldDescriptor, schemas object) object {
+	switch {
+	case fd.IsMap():
+		return object{
+			"type":                 "object",
+			"additionalProperties": singularSchema(fd.MapValue(), schemas),
+		}
+	case fd.IsList():
+		return object{
+			"type":  "array",
+			"items": singularSchema(fd, schemas),
+		}
+	}
+	return singularSchema(fd, schemas)
+}
+
+func singularSchema(fd protoreflect.FieldDescriptor, schemas object) object {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return object{"type": "boolean"}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return object{"type": "integer", "format": "int32"}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		// protojson encodes 64-bit integers as strings.
+		return object{"type": "string", "format": "int64"}
+	case protoreflect.FloatKind:
+		return object{"type": "number", "format": "float"}
+	case protoreflect.DoubleKind:
+		return object{"type": "number", "format": "double"}
+	case protoreflect.BytesKind:
+		return object{"type": "string", "format": "byte"}
+	case protoreflect.EnumKind:
+		values := fd.Enum().Values()
+		names := make([]string, values.Len())
+		for i := range names {
+			names[i] = string(values.Get(i).Name())
+		}
+		return object{"type": "string", "enum": names}
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return messageSchema(fd.Message(), schemas)
+	default:
+		return object{"type": "string"}
+	}
+}
+
+// wellKnownSchema returns the schema of the JSON form of a well-known type, or
+// nil if md is not one.
+func wellKnownSchema(md protoreflect.MessageDescriptor) object {
+	switch md.FullName() {
+	case "google.protobuf.Timestamp":
+		return object{"type": "string", "format": "date-time"}
+	case "google.protobuf.Duration":
+		return object{"type": "string", "example": "1.5s"}
+	case "google.protobuf.Struct":
+		return object{"type": "object", "additionalProperties": true}
+	case "google.protobuf.Value":
+		return object{}
+	case "google.protobuf.ListValue":
+		return object{"type": "array", "items": object{}}
+	case "google.protobuf.Empty":
+		return object{"type": "object"}
+	case "google.protobuf.FieldMask":
+		return object{"type": "string"}
+	}
+	return nil
+}
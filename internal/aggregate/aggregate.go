@@ -0,0 +1,294 @@
+// Package aggregate computes QueryMeter results from stored events. It is
+// shared by the in-repo Meterus server implementations.
+package aggregate
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	meter "github.com/elliot14A/meterus-go/meters/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// SubjectKey is the group-by key that groups rows by event subject.
+const SubjectKey = "subject"
+
+// Window sizes accepted in QueryMeterRequest.WindowSize.
+const (
+	WindowMinute = "MINUTE"
+	WindowHour   = "HOUR"
+	WindowDay    = "DAY"
+)
+
+// Query computes the result of req for meter m over events. Events of the
+// meter's type are filtered by time range, subject and group values, split
+// into windows of the requested size aligned in the requested time zone, and
+// grouped by the requested keys. Group keys other than "subject" name event
+// data properties, as does the meter's value property; both may be written as
+// dotted paths with an optional "$." prefix. Events lacking a usable value are
+// skipped. Rows are ordered by window start and then by group values.
+func Query(m *meter.Meter, events []*meter.CloudEvent, req *meter.QueryMeterRequest) (*meter.QueryMeterResponse, error) {
+	loc := time.UTC
+	if req.WindowTimeZone != "" {
+		var err error
+		if loc, err = time.LoadLocation(req.WindowTimeZone); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid window time zone %q", req.WindowTimeZone)
+		}
+	}
+	windowSize := strings.ToUpper(req.WindowSize)
+	switch windowSize {
+	case "", WindowMinute, WindowHour, WindowDay:
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "invalid window size %q", req.WindowSize)
+	}
+	for _, key := range req.GroupBy {
+		if key != SubjectKey && !slices.Contains(m.GroupBy, key) {
+			return nil, status.Errorf(codes.InvalidArgument, "meter %q cannot be grouped by %q", m.Slug, key)
+		}
+	}
+	for key := range req.FilterGroupBy {
+		if key != SubjectKey && !slices.Contains(m.GroupBy, key) {
+			return nil, status.Errorf(codes.InvalidArgument, "meter %q cannot be filtered by %q", m.Slug, key)
+		}
+	}
+
+	rows := make(map[string]*row)
+	for _, e := range events {
+		if e.Type != m.EventType || !inRange(e.Time.AsTime(), req.From, req.To) {
+			continue
+		}
+		if len(req.Subject) > 0 && !slices.Contains(req.Subject, e.Subject) {
+			continue
+		}
+		if !matchesFilters(e, req.FilterGroupBy) {
+			continue
+		}
+
+		var value *structpb.Value
+		if m.Aggregation != meter.Aggregation_AGGREGATION_COUNT {
+			var ok bool
+			if value, ok = property(e.Data, m.GetValueProperty()); !ok {
+				continue
+			}
+		}
+
+		from, to := req.From, req.To
+		if windowSize != "" {
+			start, end := window(e.Time.AsTime().In(loc), windowSize)
+			from, to = timestamppb.New(start), timestamppb.New(end)
+		}
+		groups := make([]string, len(req.GroupBy))
+		key := strconv.FormatInt(from.AsTime().UnixNano(), 10)
+		for i, g := range req.GroupBy {
+			groups[i], _ = groupValue(e, g)
+			key += "\x00" + groups[i]
+		}
+
+		r := rows[key]
+		if r == nil {
+			r = &row{from: from, to: to, groups: groups, unique: make(map[string]bool)}
+			rows[key] = r
+		}
+		r.add(m.Aggregation, value)
+	}
+
+	res := &meter.QueryMeterResponse{From: req.From, To: req.To, WindowSize: windowSize}
+	for _, r := range rows {
+		if data := r.result(m.Aggregation, req.GroupBy); data != nil {
+			res.Data = append(res.Data, data)
+		}
+	}
+	slices.SortFunc(res.Data, func(a, b *meter.QueryMeterRow) int {
+		if c := a.From.AsTime().Compare(b.From.AsTime()); c != 0 {
+			return c
+		}
+		return strings.Compare(groupString(a.GroupBy, req.GroupBy), groupString(b.GroupBy, req.GroupBy))
+	})
+	return res, nil
+}
+
+type row struct {
+	from, to *timestamppb.Timestamp
+	groups   []string
+	count    int
+	values   int
+	sum      float64
+	min, max float64
+	unique   map[string]bool
+}
+
+func (r *row) add(agg meter.Aggregation, value *structpb.Value) {
+	switch agg {
+	case meter.Aggregation_AGGREGATION_COUNT:
+		r.count++
+	case meter.Aggregation_AGGREGATION_UNIQUE_COUNT:
+		s, ok := scalarString(value)
+		if !ok {
+			return
+		}
+		r.count++
+		r.unique[s] = true
+	default:
+		v, ok := number(value)
+		if !ok {
+			return
+		}
+		if r.values == 0 || v < r.min {
+			r.min = v
+		}
+		if r.values == 0 || v > r.max {
+			r.max = v
+		}
+		r.values++
+		r.count++
+		r.sum += v
+	}
+}
+
+// result returns the row in wire form, or nil if no event contributed to it.
+func (r *row) result(agg meter.Aggregation, groupBy []string) *meter.QueryMeterRow {
+	if r.count == 0 {
+		return nil
+	}
+	out := &meter.QueryMeterRow{From: r.from, To: r.to}
+	switch agg {
+	case meter.Aggregation_AGGREGATION_COUNT:
+		out.Value = float64(r.count)
+	case meter.Aggregation_AGGREGATION_SUM:
+		out.Value = r.sum
+	case meter.Aggregation_AGGREGATION_AVG:
+		out.Value = r.sum / float64(r.values)
+	case meter.Aggregation_AGGREGATION_MIN:
+		out.Value = r.min
+	case meter.Aggregation_AGGREGATION_MAX:
+		out.Value = r.max
+	case meter.Aggregation_AGGREGATION_UNIQUE_COUNT:
+		out.Value = float64(len(r.unique))
+	}
+	if len(groupBy) > 0 {
+		out.GroupBy = &structpb.Struct{Fields: make(map[string]*structpb.Value, len(groupBy))}
+		for i, key := range groupBy {
+			if r.groups[i] == "" {
+				out.GroupBy.Fields[key] = structpb.NewNullValue()
+			} else {
+				out.GroupBy.Fields[key] = structpb.NewStringValue(r.groups[i])
+			}
+		}
+	}
+	return out
+}
+
+// window returns the bounds of the window of the given size containing t,
+// aligned in the location of t.
+func window(t time.Time, size string) (time.Time, time.Time) {
+	y, mo, d := t.Date()
+	switch size {
+	case WindowMinute:
+		start := time.Date(y, mo, d, t.Hour(), t.Minute(), 0, 0, t.Location())
+		return start, start.Add(time.Minute)
+	case WindowHour:
+		start := time.Date(y, mo, d, t.Hour(), 0, 0, 0, t.Location())
+		return start, start.Add(time.Hour)
+	default:
+		start := time.Date(y, mo, d, 0, 0, 0, 0, t.Location())
+		return start, start.AddDate(0, 0, 1)
+	}
+}
+
+func inRange(t time.Time, from, to *timestamppb.Timestamp) bool {
+	if from != nil && t.Before(from.AsTime()) {
+		return false
+	}
+	if to != nil && !t.Before(to.AsTime()) {
+		return false
+	}
+	return true
+}
+
+func matchesFilters(e *meter.CloudEvent, filters map[string]*meter.FilterGroupValues) bool {
+	for key, allowed := range filters {
+		if len(allowed.GetValues()) == 0 {
+			continue
+		}
+		v, ok := groupValue(e, key)
+		if !ok || !slices.Contains(allowed.Values, v) {
+			return false
+		}
+	}
+	return true
+}
+
+// groupValue returns the value of a group-by key for an event.
+func groupValue(e *meter.CloudEvent, key string) (string, bool) {
+	if key == SubjectKey {
+		return e.Subject, e.Subject != ""
+	}
+	v, ok := property(e.Data, key)
+	if !ok {
+		return "", false
+	}
+	return scalarString(v)
+}
+
+// property looks up a dotted property path, optionally prefixed with "$.",
+// in event data.
+func property(data *structpb.Struct, path string) (*structpb.Value, bool) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if data == nil || path == "" {
+		return nil, false
+	}
+	fields := data.Fields
+	parts := strings.Split(path, ".")
+	for i, part := range parts {
+		v, ok := fields[part]
+		if !ok {
+			return nil, false
+		}
+		if i == len(parts)-1 {
+			return v, true
+		}
+		s := v.GetStructValue()
+		if s == nil {
+			return nil, false
+		}
+		fields = s.Fields
+	}
+	return nil, false
+}
+
+func number(v *structpb.Value) (float64, bool) {
+	switch k := v.GetKind().(type) {
+	case *structpb.Value_NumberValue:
+		return k.NumberValue, true
+	case *structpb.Value_StringValue:
+		f, err := strconv.ParseFloat(k.StringValue, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func scalarString(v *structpb.Value) (string, bool) {
+	switch k := v.GetKind().(type) {
+	case *structpb.Value_StringValue:
+		return k.StringValue, true
+	case *structpb.Value_NumberValue:
+		return strconv.FormatFloat(k.NumberValue, 'f', -1, 64), true
+	case *structpb.Value_BoolValue:
+		return strconv.FormatBool(k.BoolValue), true
+	}
+	return "", false
+}
+
+func groupString(s *structpb.Struct, keys []string) string {
+	var b strings.Builder
+	for _, key := range keys {
+		b.WriteString(s.GetFields()[key].GetStringValue())
+		b.WriteByte(0)
+	}
+	return b.String()
+}
@@ -0,0 +1,162 @@
+// Package server implements the Meterus metering, subject and validation
+// services. It is shared by the in-memory test server and the standalone
+// server, which persists its state through a Store.
+package server
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sync"
+	"time"
+
+	meter "github.com/elliot14A/meterus-go/meters/v1"
+	subject "github.com/elliot14A/meterus-go/subject/v1"
+	validation "github.com/elliot14A/meterus-go/validation/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// Backend holds events, meters, subjects and API keys and serves the Meterus
+// services from them. All data is held in memory; mutations are written to
+// the Store before they are applied.
+type Backend struct {
+	now      func() time.Time
+	store    Store
+	onIngest func(*meter.CloudEvent)
+	metering *meteringServer
+	subjects *subjectServer
+	keys     *validationServer
+
+	mu    sync.Mutex
+	state state
+}
+
+// state is the data held by a Backend.
+type state struct {
+	events   []*meter.CloudEvent
+	eventIDs map[string]bool
+	meters   []*meter.Meter
+	subjects []*subject.Subject
+	apiKeys  []*StoredKey
+}
+
+// Options configures a Backend.
+type Options struct {
+	// Clock stamps events, meters and API keys and expires API keys. It
+	// defaults to time.Now.
+	Clock func() time.Time
+	// Store persists the data. Without one, data lives in memory only.
+	Store Store
+	// OnIngest is called with each stored event, with the backend locked.
+	OnIngest func(*meter.CloudEvent)
+}
+
+// New returns a Backend holding the data loaded from opts.Store.
+func New(opts Options) (*Backend, error) {
+	b := &Backend{
+		now:      opts.Clock,
+		store:    opts.Store,
+		onIngest: opts.OnIngest,
+		state:    state{eventIDs: make(map[string]bool)},
+	}
+	if b.now == nil {
+		b.now = time.Now
+	}
+	if b.store == nil {
+		b.store = nopStore{}
+	}
+	b.metering = &meteringServer{b: b}
+	b.subjects = &subjectServer{b: b}
+	b.keys = &validationServer{b: b}
+
+	snap, err := b.store.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load stored data: %w", err)
+	}
+	for _, e := range snap.Events {
+		b.state.eventIDs[e.Source+"\x00"+e.Id] = true
+	}
+	b.state.events = snap.Events
+	b.state.meters = snap.Meters
+	b.state.subjects = snap.Subjects
+	b.state.apiKeys = snap.APIKeys
+	return b, nil
+}
+
+// Register registers the services on s.
+func (b *Backend) Register(s grpc.ServiceRegistrar) {
+	meter.RegisterMeteringServiceServer(s, b.metering)
+	subject.RegisterSubjectServiceServer(s, b.subjects)
+	validation.RegisterValidationServiceServer(s, b.keys)
+}
+
+// MeteringServer returns the implementation of the metering service.
+func (b *Backend) MeteringServer() meter.MeteringServiceServer {
+	return b.metering
+}
+
+// SubjectServer returns the implementation of the subject service.
+func (b *Backend) SubjectServer() subject.SubjectServiceServer {
+	return b.subjects
+}
+
+// ValidationServer returns the implementation of the validation service.
+func (b *Backend) ValidationServer() validation.ValidationServiceServer {
+	return b.keys
+}
+
+// Events returns copies of the stored events, in ingestion order.
+func (b *Backend) Events() []*meter.CloudEvent {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	events := make([]*meter.CloudEvent, len(b.state.events))
+	for i, e := range b.state.events {
+		events[i] = proto.Clone(e).(*meter.CloudEvent)
+	}
+	return events
+}
+
+// AddApiKey stores an API key with the given secret, subject and scopes, as if
+// it had been created through CreateApiKey. It does nothing if a valid key
+// with the secret already exists.
+func (b *Backend) AddApiKey(secret, subject string, scopes ...string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.findAPIKey(secret) != nil {
+		return nil
+	}
+	key := newAPIKey(secret, subject, scopes, b.now())
+	if err := b.store.PutAPIKey(key); err != nil {
+		return fmt.Errorf("failed to store api key: %w", err)
+	}
+	b.state.apiKeys = append(b.state.apiKeys, key)
+	return nil
+}
+
+// storeError reports a failure to persist a mutation to the caller.
+func storeError(err error) error {
+	return status.Errorf(codes.Internal, "failed to persist: %v", err)
+}
+
+func hashSecret(secret string) [sha256.Size]byte {
+	return sha256.Sum256([]byte(secret))
+}
+
+// paginate returns the given page of items, counting pages from 1. A limit of
+// zero or less returns all items.
+func paginate[T any](items []T, limit, page int32) []T {
+	if limit <= 0 {
+		return items
+	}
+	if page < 1 {
+		page = 1
+	}
+	start := int(limit) * int(page-1)
+	if start >= len(items) {
+		return nil
+	}
+	end := min(start+int(limit), len(items))
+	return items[start:end]
+}
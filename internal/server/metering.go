@@ -0,0 +1,169 @@
+package server
+
+import (
+	"context"
+	"slices"
+
+	"github.com/elliot14A/meterus-go/internal/aggregate"
+	"github.com/elliot14A/meterus-go/internal/uuid"
+	meter "github.com/elliot14A/meterus-go/meters/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type meteringServer struct {
+	meter.UnimplementedMeteringServiceServer
+	b *Backend
+}
+
+func (m *meteringServer) Ingest(_ context.Context, event *meter.CloudEvent) (*emptypb.Empty, error) {
+	if event.Type == "" {
+		return nil, status.Error(codes.InvalidArgument, "event type is required")
+	}
+	if event.Subject == "" {
+		return nil, status.Error(codes.InvalidArgument, "event subject is required")
+	}
+	m.b.mu.Lock()
+	defer m.b.mu.Unlock()
+	if err := m.b.ingest(event); err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// ingest stores a copy of event, assigning it an ID and time if it has none.
+// Events with the source and ID of a stored event are ignored, so that
+// retried deliveries are counted once. It must be called with b.mu held.
+func (b *Backend) ingest(event *meter.CloudEvent) error {
+	event = proto.Clone(event).(*meter.CloudEvent)
+	if event.Id == "" {
+		event.Id = uuid.MustNew()
+	}
+	if event.Time == nil {
+		event.Time = timestamppb.New(b.now())
+	}
+	key := event.Source + "\x00" + event.Id
+	if b.state.eventIDs[key] {
+		return nil
+	}
+	if err := b.store.PutEvent(event); err != nil {
+		return storeError(err)
+	}
+	b.state.eventIDs[key] = true
+	b.state.events = append(b.state.events, event)
+	if b.onIngest != nil {
+		b.onIngest(event)
+	}
+	return nil
+}
+
+func (m *meteringServer) ListMeters(_ context.Context, req *meter.ListMetersRequest) (*meter.ListMetersResponse, error) {
+	m.b.mu.Lock()
+	defer m.b.mu.Unlock()
+	res := &meter.ListMetersResponse{}
+	for _, mt := range paginate(m.b.state.meters, req.Limit, req.Page) {
+		res.Meters = append(res.Meters, proto.Clone(mt).(*meter.Meter))
+	}
+	return res, nil
+}
+
+func (m *meteringServer) CreateMeter(_ context.Context, req *meter.CreateMeterRequest) (*meter.Meter, error) {
+	if req.Slug == "" {
+		return nil, status.Error(codes.InvalidArgument, "meter slug is required")
+	}
+	if req.EventType == "" {
+		return nil, status.Error(codes.InvalidArgument, "meter event type is required")
+	}
+	if req.Aggregation != meter.Aggregation_AGGREGATION_COUNT && req.GetValueProperty() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "value property is required for %s", req.Aggregation)
+	}
+
+	m.b.mu.Lock()
+	defer m.b.mu.Unlock()
+	if m.b.findMeter(req.Slug) != nil {
+		return nil, status.Errorf(codes.AlreadyExists, "meter %q already exists", req.Slug)
+	}
+	now := timestamppb.New(m.b.now())
+	mt := &meter.Meter{
+		Id:            uuid.MustNew(),
+		Slug:          req.Slug,
+		Description:   req.Description,
+		Aggregation:   req.Aggregation,
+		ValueProperty: req.ValueProperty,
+		GroupBy:       slices.Clone(req.GroupBy),
+		EventType:     req.EventType,
+		CreatedBy:     req.CreatedBy,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if err := m.b.store.PutMeter(mt); err != nil {
+		return nil, storeError(err)
+	}
+	m.b.state.meters = append(m.b.state.meters, mt)
+	return proto.Clone(mt).(*meter.Meter), nil
+}
+
+func (m *meteringServer) GetMeter(_ context.Context, req *meter.MeterId) (*meter.Meter, error) {
+	m.b.mu.Lock()
+	defer m.b.mu.Unlock()
+	mt := m.b.findMeter(req.MeterIdOrSlug)
+	if mt == nil {
+		return nil, status.Errorf(codes.NotFound, "meter %q not found", req.MeterIdOrSlug)
+	}
+	return proto.Clone(mt).(*meter.Meter), nil
+}
+
+func (m *meteringServer) DeleteMeter(_ context.Context, req *meter.MeterId) (*emptypb.Empty, error) {
+	m.b.mu.Lock()
+	defer m.b.mu.Unlock()
+	mt := m.b.findMeter(req.MeterIdOrSlug)
+	if mt == nil {
+		return nil, status.Errorf(codes.NotFound, "meter %q not found", req.MeterIdOrSlug)
+	}
+	if err := m.b.store.DeleteMeter(mt.Id); err != nil {
+		return nil, storeError(err)
+	}
+	m.b.state.meters = slices.DeleteFunc(m.b.state.meters, func(x *meter.Meter) bool { return x == mt })
+	return &emptypb.Empty{}, nil
+}
+
+func (m *meteringServer) QueryMeter(_ context.Context, req *meter.QueryMeterRequest) (*meter.QueryMeterResponse, error) {
+	m.b.mu.Lock()
+	defer m.b.mu.Unlock()
+	mt := m.b.findMeter(req.MeterIdOrSlug)
+	if mt == nil {
+		return nil, status.Errorf(codes.NotFound, "meter %q not found", req.MeterIdOrSlug)
+	}
+	return aggregate.Query(mt, m.b.state.events, req)
+}
+
+func (m *meteringServer) ListMeterSubjects(_ context.Context, req *meter.ListMeterSubjectsRequest) (*meter.ListMeterSubjectsResponse, error) {
+	m.b.mu.Lock()
+	defer m.b.mu.Unlock()
+	mt := m.b.findMeter(req.MeterIdOrSlug)
+	if mt == nil {
+		return nil, status.Errorf(codes.NotFound, "meter %q not found", req.MeterIdOrSlug)
+	}
+	var subjects []string
+	for _, e := range m.b.state.events {
+		if e.Type == mt.EventType {
+			subjects = append(subjects, e.Subject)
+		}
+	}
+	slices.Sort(subjects)
+	return &meter.ListMeterSubjectsResponse{Subjects: slices.Compact(subjects)}, nil
+}
+
+// findMeter returns the meter with the given ID or slug. It must be called
+// with b.mu held.
+func (b *Backend) findMeter(idOrSlug string) *meter.Meter {
+	for _, mt := range b.state.meters {
+		if mt.Id == idOrSlug || mt.Slug == idOrSlug {
+			return mt
+		}
+	}
+	return nil
+}
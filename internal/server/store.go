@@ -0,0 +1,70 @@
+package server
+
+import (
+	"crypto/sha256"
+	"slices"
+	"time"
+
+	meter "github.com/elliot14A/meterus-go/meters/v1"
+	subject "github.com/elliot14A/meterus-go/subject/v1"
+	validation "github.com/elliot14A/meterus-go/validation/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// Store persists the data of a Backend. The Backend serializes calls, and
+// passes values it does not modify afterwards.
+type Store interface {
+	// Load returns the stored data, with each kind of record in the order it
+	// was first stored.
+	Load() (*Snapshot, error)
+
+	PutEvent(event *meter.CloudEvent) error
+	PutMeter(m *meter.Meter) error
+	DeleteMeter(id string) error
+	PutSubject(s *subject.Subject) error
+	DeleteSubject(id string) error
+	PutAPIKey(key *StoredKey) error
+}
+
+// Snapshot is the data loaded from a Store.
+type Snapshot struct {
+	Events   []*meter.CloudEvent
+	Meters   []*meter.Meter
+	Subjects []*subject.Subject
+	APIKeys  []*StoredKey
+}
+
+// StoredKey is an API key. Only hashes of its secrets are kept.
+type StoredKey struct {
+	Meta   *validation.ApiKey
+	Secret [sha256.Size]byte
+	// Rotated holds secrets replaced by RotateApiKey that are still valid
+	// during their grace period.
+	Rotated []RotatedSecret
+}
+
+// RotatedSecret is the hash of a replaced secret and the end of its grace
+// period.
+type RotatedSecret struct {
+	Secret [sha256.Size]byte
+	Until  time.Time
+}
+
+func (k *StoredKey) clone() *StoredKey {
+	return &StoredKey{
+		Meta:    proto.Clone(k.Meta).(*validation.ApiKey),
+		Secret:  k.Secret,
+		Rotated: slices.Clone(k.Rotated),
+	}
+}
+
+// nopStore is the Store of a Backend held in memory only.
+type nopStore struct{}
+
+func (nopStore) Load() (*Snapshot, error)          { return &Snapshot{}, nil }
+func (nopStore) PutEvent(*meter.CloudEvent) error  { return nil }
+func (nopStore) PutMeter(*meter.Meter) error       { return nil }
+func (nopStore) DeleteMeter(string) error          { return nil }
+func (nopStore) PutSubject(*subject.Subject) error { return nil }
+func (nopStore) DeleteSubject(string) error        { return nil }
+func (nopStore) PutAPIKey(*StoredKey) error        { return nil }
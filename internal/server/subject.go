@@ -0,0 +1,95 @@
+package server
+
+import (
+	"context"
+	"slices"
+
+	subject "github.com/elliot14A/meterus-go/subject/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+type subjectServer struct {
+	subject.UnimplementedSubjectServiceServer
+	b *Backend
+}
+
+func (s *subjectServer) CreateSubject(_ context.Context, req *subject.Subject) (*subject.Subject, error) {
+	if req.Id == "" {
+		return nil, status.Error(codes.InvalidArgument, "subject id is required")
+	}
+	s.b.mu.Lock()
+	defer s.b.mu.Unlock()
+	if s.b.findSubject(req.Id) != nil {
+		return nil, status.Errorf(codes.AlreadyExists, "subject %q already exists", req.Id)
+	}
+	sub := proto.Clone(req).(*subject.Subject)
+	if err := s.b.store.PutSubject(sub); err != nil {
+		return nil, storeError(err)
+	}
+	s.b.state.subjects = append(s.b.state.subjects, sub)
+	return proto.Clone(sub).(*subject.Subject), nil
+}
+
+func (s *subjectServer) ListSubjects(_ context.Context, req *subject.ListSubjectRequest) (*subject.ListSubjectResponse, error) {
+	s.b.mu.Lock()
+	defer s.b.mu.Unlock()
+	res := &subject.ListSubjectResponse{Total: uint32(len(s.b.state.subjects))}
+	for _, sub := range paginate(s.b.state.subjects, req.Limit, req.Page) {
+		res.Subjects = append(res.Subjects, proto.Clone(sub).(*subject.Subject))
+	}
+	return res, nil
+}
+
+func (s *subjectServer) GetSubject(_ context.Context, req *subject.SubjectId) (*subject.Subject, error) {
+	s.b.mu.Lock()
+	defer s.b.mu.Unlock()
+	sub := s.b.findSubject(req.SubjectId)
+	if sub == nil {
+		return nil, status.Errorf(codes.NotFound, "subject %q not found", req.SubjectId)
+	}
+	return proto.Clone(sub).(*subject.Subject), nil
+}
+
+func (s *subjectServer) DeleteSubject(_ context.Context, req *subject.SubjectId) (*emptypb.Empty, error) {
+	s.b.mu.Lock()
+	defer s.b.mu.Unlock()
+	sub := s.b.findSubject(req.SubjectId)
+	if sub == nil {
+		return nil, status.Errorf(codes.NotFound, "subject %q not found", req.SubjectId)
+	}
+	if err := s.b.store.DeleteSubject(sub.Id); err != nil {
+		return nil, storeError(err)
+	}
+	s.b.state.subjects = slices.DeleteFunc(s.b.state.subjects, func(x *subject.Subject) bool { return x == sub })
+	return &emptypb.Empty{}, nil
+}
+
+func (s *subjectServer) UpdateSubject(_ context.Context, req *subject.Subject) (*subject.Subject, error) {
+	s.b.mu.Lock()
+	defer s.b.mu.Unlock()
+	sub := s.b.findSubject(req.Id)
+	if sub == nil {
+		return nil, status.Errorf(codes.NotFound, "subject %q not found", req.Id)
+	}
+	updated := proto.Clone(sub).(*subject.Subject)
+	updated.DisplayName = req.DisplayName
+	if err := s.b.store.PutSubject(updated); err != nil {
+		return nil, storeError(err)
+	}
+	sub.DisplayName = req.DisplayName
+	return updated, nil
+}
+
+// findSubject returns the subject with the given ID. It must be called with
+// b.mu held.
+func (b *Backend) findSubject(id string) *subject.Subject {
+	for _, sub := range b.state.subjects {
+		if sub.Id == id {
+			return sub
+		}
+	}
+	return nil
+}
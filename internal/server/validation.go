@@ -0,0 +1,291 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/elliot14A/meterus-go/client"
+	"github.com/elliot14A/meterus-go/internal/uuid"
+	meter "github.com/elliot14A/meterus-go/meters/v1"
+	validation "github.com/elliot14A/meterus-go/validation/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type validationServer struct {
+	validation.UnimplementedValidationServiceServer
+	b *Backend
+}
+
+func newAPIKey(secret, subject string, scopes []string, now time.Time) *StoredKey {
+	return &StoredKey{
+		Meta: &validation.ApiKey{
+			Id:        uuid.MustNew(),
+			Subject:   subject,
+			Scopes:    slices.Clone(scopes),
+			Prefix:    secretPrefix(secret),
+			CreatedAt: timestamppb.New(now),
+		},
+		Secret: hashSecret(secret),
+	}
+}
+
+// matches reports whether secret is a currently valid secret of the key.
+func (k *StoredKey) matches(secret string, now time.Time) bool {
+	if k.Meta.RevokedAt != nil {
+		return false
+	}
+	if k.Meta.ExpiresAt != nil && !now.Before(k.Meta.ExpiresAt.AsTime()) {
+		return false
+	}
+	hash := hashSecret(secret)
+	if hash == k.Secret {
+		return true
+	}
+	for _, r := range k.Rotated {
+		if hash == r.Secret && now.Before(r.Until) {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *validationServer) ValidateApiKey(ctx context.Context, req *validation.ValidateApiKeyRequest) (*validation.ValidateApiKeyResponse, error) {
+	v.b.mu.Lock()
+	defer v.b.mu.Unlock()
+	return v.b.validate(ctx, req.RequiredScopes), nil
+}
+
+// ValidateAndMeter checks the API key of the call against the required
+// scopes and, if it is valid, ingests the event of the request. Events without
+// a subject are billed to the subject of the key, and events for another
+// subject are rejected with PermissionDenied. Unknown keys fail the call
+// with Unauthenticated, so that a reply always carries a validation result.
+func (v *validationServer) ValidateAndMeter(ctx context.Context, req *validation.ValidateAndMeterRequest) (*validation.ValidateApiKeyResponse, error) {
+	if req.Event == nil || req.Event.Type == "" {
+		return nil, status.Error(codes.InvalidArgument, "event type is required")
+	}
+	v.b.mu.Lock()
+	defer v.b.mu.Unlock()
+	res := v.b.validate(ctx, req.RequiredScopes)
+	if !res.IsValid {
+		if len(res.MissingScopes) == 0 {
+			return nil, status.Error(codes.Unauthenticated, "invalid api key")
+		}
+		return res, nil
+	}
+	if req.Event.Subject != "" && req.Event.Subject != res.Metadata.Subject {
+		return nil, status.Error(codes.PermissionDenied, "event subject does not match the api key")
+	}
+	event := proto.Clone(req.Event).(*meter.CloudEvent)
+	event.Subject = res.Metadata.Subject
+	if err := v.b.ingest(event); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// validate checks the API key of the incoming call against the required
+// scopes. It must be called with b.mu held.
+func (b *Backend) validate(ctx context.Context, required []string) *validation.ValidateApiKeyResponse {
+	secret, ok := bearerToken(ctx)
+	if !ok {
+		return &validation.ValidateApiKeyResponse{}
+	}
+	key := b.findAPIKey(secret)
+	if key == nil {
+		return &validation.ValidateApiKeyResponse{}
+	}
+
+	res := &validation.ValidateApiKeyResponse{
+		Metadata: &validation.Metadata{
+			Subject:              key.Meta.Subject,
+			AdditionalAttributes: key.Meta.AdditionalAttributes,
+		},
+		GrantedScopes: slices.Clone(key.Meta.Scopes),
+		MissingScopes: key.missingScopes(required),
+	}
+	res.IsValid = len(res.MissingScopes) == 0
+	return res
+}
+
+// ValidateApiKey validates apiKey against the stored keys, so that the
+// backend can serve as the middleware.Validator authenticating its own calls.
+func (b *Backend) ValidateApiKey(_ context.Context, apiKey string, scopes []string) (*client.ValidationResult, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	key := b.findAPIKey(apiKey)
+	if key == nil {
+		return &client.ValidationResult{}, nil
+	}
+	res := &client.ValidationResult{
+		Subject:       key.Meta.Subject,
+		Scopes:        slices.Clone(key.Meta.Scopes),
+		MissingScopes: key.missingScopes(scopes),
+		Attributes:    key.Meta.AdditionalAttributes,
+	}
+	if len(res.MissingScopes) > 0 {
+		return res, fmt.Errorf("%w: %s", client.ErrMissingScopes, strings.Join(res.MissingScopes, ", "))
+	}
+	res.Valid = true
+	return res, nil
+}
+
+// missingScopes returns the required scopes the key does not grant.
+func (k *StoredKey) missingScopes(required []string) []string {
+	var missing []string
+	for _, scope := range required {
+		expr, err := client.ParseScopeExpr(scope)
+		if err != nil || !expr.Allows(k.Meta.Scopes) {
+			missing = append(missing, scope)
+		}
+	}
+	return missing
+}
+
+func (v *validationServer) CreateApiKey(_ context.Context, req *validation.CreateApiKeyRequest) (*validation.CreateApiKeyResponse, error) {
+	if req.Subject == "" {
+		return nil, status.Error(codes.InvalidArgument, "api key subject is required")
+	}
+	secret := newSecret()
+	v.b.mu.Lock()
+	defer v.b.mu.Unlock()
+	key := newAPIKey(secret, req.Subject, req.Scopes, v.b.now())
+	key.Meta.Name = req.Name
+	key.Meta.AdditionalAttributes = req.AdditionalAttributes
+	key.Meta.ExpiresAt = req.ExpiresAt
+	if err := v.b.store.PutAPIKey(key); err != nil {
+		return nil, storeError(err)
+	}
+	v.b.state.apiKeys = append(v.b.state.apiKeys, key)
+	return &validation.CreateApiKeyResponse{
+		ApiKey: proto.Clone(key.Meta).(*validation.ApiKey),
+		Secret: secret,
+	}, nil
+}
+
+func (v *validationServer) ListApiKeys(_ context.Context, req *validation.ListApiKeysRequest) (*validation.ListApiKeysResponse, error) {
+	v.b.mu.Lock()
+	defer v.b.mu.Unlock()
+	var keys []*validation.ApiKey
+	for _, key := range v.b.state.apiKeys {
+		if req.Subject != "" && key.Meta.Subject != req.Subject {
+			continue
+		}
+		if key.Meta.RevokedAt != nil && !req.IncludeRevoked {
+			continue
+		}
+		keys = append(keys, key.Meta)
+	}
+	res := &validation.ListApiKeysResponse{Total: uint32(len(keys))}
+	for _, key := range paginate(keys, req.Limit, req.Page) {
+		res.ApiKeys = append(res.ApiKeys, proto.Clone(key).(*validation.ApiKey))
+	}
+	return res, nil
+}
+
+func (v *validationServer) RevokeApiKey(_ context.Context, req *validation.ApiKeyId) (*emptypb.Empty, error) {
+	v.b.mu.Lock()
+	defer v.b.mu.Unlock()
+	key := v.b.apiKeyByID(req.ApiKeyId)
+	if key == nil {
+		return nil, status.Errorf(codes.NotFound, "api key %q not found", req.ApiKeyId)
+	}
+	if key.Meta.RevokedAt != nil {
+		return &emptypb.Empty{}, nil
+	}
+	revoked := key.clone()
+	revoked.Meta.RevokedAt = timestamppb.New(v.b.now())
+	if err := v.b.store.PutAPIKey(revoked); err != nil {
+		return nil, storeError(err)
+	}
+	*key = *revoked
+	return &emptypb.Empty{}, nil
+}
+
+func (v *validationServer) RotateApiKey(_ context.Context, req *validation.RotateApiKeyRequest) (*validation.CreateApiKeyResponse, error) {
+	secret := newSecret()
+	v.b.mu.Lock()
+	defer v.b.mu.Unlock()
+	key := v.b.apiKeyByID(req.ApiKeyId)
+	if key == nil {
+		return nil, status.Errorf(codes.NotFound, "api key %q not found", req.ApiKeyId)
+	}
+	if key.Meta.RevokedAt != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "api key %q is revoked", req.ApiKeyId)
+	}
+	rotated := key.clone()
+	if grace := req.GracePeriod.AsDuration(); grace > 0 {
+		rotated.Rotated = append(rotated.Rotated, RotatedSecret{Secret: key.Secret, Until: v.b.now().Add(grace)})
+	}
+	rotated.Secret = hashSecret(secret)
+	rotated.Meta.Prefix = secretPrefix(secret)
+	if req.ExpiresAt != nil {
+		rotated.Meta.ExpiresAt = req.ExpiresAt
+	}
+	if err := v.b.store.PutAPIKey(rotated); err != nil {
+		return nil, storeError(err)
+	}
+	*key = *rotated
+	return &validation.CreateApiKeyResponse{
+		ApiKey: proto.Clone(key.Meta).(*validation.ApiKey),
+		Secret: secret,
+	}, nil
+}
+
+// findAPIKey returns the key a secret belongs to, if it is valid. It must be
+// called with b.mu held.
+func (b *Backend) findAPIKey(secret string) *StoredKey {
+	now := b.now()
+	for _, key := range b.state.apiKeys {
+		if key.matches(secret, now) {
+			return key
+		}
+	}
+	return nil
+}
+
+// apiKeyByID returns the key with the given ID. It must be called with b.mu
+// held.
+func (b *Backend) apiKeyByID(id string) *StoredKey {
+	for _, key := range b.state.apiKeys {
+		if key.Meta.Id == id {
+			return key
+		}
+	}
+	return nil
+}
+
+func bearerToken(ctx context.Context) (string, bool) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get("authorization") {
+		scheme, token, ok := strings.Cut(value, " ")
+		if ok && strings.EqualFold(scheme, "Bearer") && token != "" {
+			return token, true
+		}
+	}
+	return "", false
+}
+
+func newSecret() string {
+	var b [24]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return "mk_" + hex.EncodeToString(b[:])
+}
+
+// secretPrefix returns the part of a secret that is safe to show to identify
+// its key.
+func secretPrefix(secret string) string {
+	return secret[:min(len(secret), 8)]
+}
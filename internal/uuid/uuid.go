@@ -0,0 +1,28 @@
+// Package uuid generates the random IDs of events, meters and API keys. It is
+// shared by the client and the in-repo Meterus server implementations.
+package uuid
+
+import (
+	"crypto/rand"
+	"fmt"
+)
+
+// New returns a random version 4 UUID.
+func New() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("failed to generate uuid: %w", err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// MustNew is like New but panics if the system random source fails.
+func MustNew() string {
+	id, err := New()
+	if err != nil {
+		panic(err)
+	}
+	return id
+}
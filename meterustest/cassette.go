@@ -0,0 +1,297 @@
+package meterustest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Cassette holds recorded gRPC exchanges. Exchanges are recorded through
+// UnaryClientInterceptor, saved to and loaded from golden files, and replayed
+// without a server through the connection returned by Replay:
+//
+//	// Recording against a real server
+//	cassette := meterustest.NewCassette()
+//	c, err := client.NewMeterusClient(addr, apiKey,
+//		grpc.WithUnaryInterceptor(cassette.UnaryClientInterceptor()))
+//	...
+//	err = cassette.Save("testdata/ingest.json")
+//
+//	// Replaying
+//	cassette, err := meterustest.LoadCassette("testdata/ingest.json")
+//	metering := meter.NewMeteringServiceClient(cassette.Replay())
+type Cassette struct {
+	mu           sync.Mutex
+	interactions []Interaction
+}
+
+// Interaction is a recorded exchange. Messages are stored as protobuf JSON.
+type Interaction struct {
+	Method   string          `json:"method"`
+	Request  json.RawMessage `json:"request"`
+	Response json.RawMessage `json:"response,omitempty"`
+	Error    *RecordedError  `json:"error,omitempty"`
+}
+
+// RecordedError is the status of a failed exchange. Status holds the full
+// status, details included, as protobuf JSON; Code and Message repeat it for
+// readers of golden files. Exchanges recorded without Status replay with
+// Code and Message alone.
+type RecordedError struct {
+	Code    string          `json:"code"`
+	Message string          `json:"message"`
+	Status  json.RawMessage `json:"status,omitempty"`
+}
+
+type cassetteFile struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// NewCassette returns an empty Cassette.
+func NewCassette() *Cassette {
+	return &Cassette{}
+}
+
+// LoadCassette loads a Cassette saved by Save.
+func LoadCassette(path string) (*Cassette, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette: %w", err)
+	}
+	var f cassetteFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("failed to decode cassette %s: %w", path, err)
+	}
+	return &Cassette{interactions: f.Interactions}, nil
+}
+
+// Save writes the recorded exchanges to path, creating its directory if
+// needed.
+func (c *Cassette) Save(path string) error {
+	c.mu.Lock()
+	b, err := json.MarshalIndent(cassetteFile{Interactions: c.interactions}, "", "  ")
+	c.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode cassette: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create cassette directory: %w", err)
+	}
+	if err := os.WriteFile(path, append(b, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	return nil
+}
+
+// Interactions returns the recorded exchanges in the order they completed.
+func (c *Cassette) Interactions() []Interaction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Interaction(nil), c.interactions...)
+}
+
+// UnaryClientInterceptor returns an interceptor recording the exchanges of
+// the calls it intercepts.
+func (c *Cassette) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		in, ok := req.(proto.Message)
+		if !ok {
+			return err
+		}
+		it := Interaction{Method: method, Request: marshalMessage(in)}
+		if err != nil {
+			s := status.Convert(err)
+			it.Error = &RecordedError{Code: s.Code().String(), Message: s.Message(), Status: marshalMessage(s.Proto())}
+		} else if out, ok := reply.(proto.Message); ok {
+			it.Response = marshalMessage(out)
+		}
+		c.mu.Lock()
+		c.interactions = append(c.interactions, it)
+		c.mu.Unlock()
+		return err
+	}
+}
+
+// ReplayOption configures the connection returned by Replay.
+type ReplayOption func(*replayConn)
+
+// WithNormalizer sets a function applied to requests before they are
+// matched against recorded requests, such as to clear generated IDs and
+// timestamps. It receives the full method name and may modify req.
+func WithNormalizer(fn func(method string, req proto.Message)) ReplayOption {
+	return func(r *replayConn) {
+		r.normalizers = append(r.normalizers, fn)
+	}
+}
+
+// IgnoreFields ignores the fields with the given protobuf names, such as "id"
+// or "time", at any depth when matching requests.
+func IgnoreFields(names ...string) ReplayOption {
+	set := make(map[protoreflect.Name]bool, len(names))
+	for _, name := range names {
+		set[protoreflect.Name(name)] = true
+	}
+	return WithNormalizer(func(_ string, req proto.Message) {
+		clearFields(req.ProtoReflect(), set)
+	})
+}
+
+// Replay returns a connection answering calls from the recorded exchanges,
+// for use with the generated client constructors. A call is answered by the
+// first unused exchange of the same method whose request equals the call's
+// once both are normalized. Calls without such an exchange fail with
+// codes.Internal, describing the next unused recorded request of the method.
+// Streams are not supported.
+func (c *Cassette) Replay(opts ...ReplayOption) grpc.ClientConnInterface {
+	r := &replayConn{cassette: c, used: make(map[int]bool)}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+type replayConn struct {
+	cassette    *Cassette
+	normalizers []func(string, proto.Message)
+
+	mu   sync.Mutex
+	used map[int]bool
+}
+
+func (r *replayConn) Invoke(ctx context.Context, method string, args, reply any, _ ...grpc.CallOption) error {
+	if err := ctx.Err(); err != nil {
+		return status.FromContextError(err).Err()
+	}
+	req, ok := args.(proto.Message)
+	if !ok {
+		return status.Errorf(codes.Internal, "meterustest: cannot replay request of type %T", args)
+	}
+	want := r.normalize(method, req)
+
+	r.cassette.mu.Lock()
+	interactions := r.cassette.interactions
+	r.cassette.mu.Unlock()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var next json.RawMessage
+	for i, it := range interactions {
+		if it.Method != method || r.used[i] {
+			continue
+		}
+		recorded := req.ProtoReflect().New().Interface()
+		if err := protojson.Unmarshal(it.Request, recorded); err != nil {
+			return status.Errorf(codes.Internal, "meterustest: invalid recorded request for %s: %v", method, err)
+		}
+		if next == nil {
+			next = marshalMessage(recorded)
+		}
+		if !proto.Equal(want, r.normalize(method, recorded)) {
+			continue
+		}
+		r.used[i] = true
+		return replay(it, reply)
+	}
+	if next == nil {
+		return status.Errorf(codes.Internal, "meterustest: no recorded exchange left for %s", method)
+	}
+	return status.Errorf(codes.Internal, "meterustest: no recorded exchange for %s matches request %s; next recorded request is %s",
+		method, marshalMessage(want), next)
+}
+
+func (r *replayConn) NewStream(context.Context, *grpc.StreamDesc, string, ...grpc.CallOption) (grpc.ClientStream, error) {
+	return nil, status.Error(codes.Unimplemented, "meterustest: streams cannot be replayed")
+}
+
+// normalize returns a normalized copy of req.
+func (r *replayConn) normalize(method string, req proto.Message) proto.Message {
+	req = proto.Clone(req)
+	for _, fn := range r.normalizers {
+		fn(method, req)
+	}
+	return req
+}
+
+func replay(it Interaction, reply any) error {
+	if it.Error != nil {
+		// Statuses whose details could not be encoded are recorded as null.
+		if len(it.Error.Status) == 0 || string(it.Error.Status) == "null" {
+			return status.Error(parseCode(it.Error.Code), it.Error.Message)
+		}
+		var s spb.Status
+		if err := protojson.Unmarshal(it.Error.Status, &s); err != nil {
+			return status.Errorf(codes.Internal, "meterustest: invalid recorded status for %s: %v", it.Method, err)
+		}
+		return status.FromProto(&s).Err()
+	}
+	out, ok := reply.(proto.Message)
+	if !ok {
+		return status.Errorf(codes.Internal, "meterustest: cannot replay response of type %T", reply)
+	}
+	if err := protojson.Unmarshal(it.Response, out); err != nil {
+		return status.Errorf(codes.Internal, "meterustest: invalid recorded response for %s: %v", it.Method, err)
+	}
+	return nil
+}
+
+// marshalMessage returns m as compact protobuf JSON. The output is stable for
+// a given message, which keeps golden files diffable.
+func marshalMessage(m proto.Message) json.RawMessage {
+	b, err := protojson.Marshal(m)
+	if err != nil {
+		return json.RawMessage("null")
+	}
+	// protojson randomizes whitespace; reformatting makes it deterministic.
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, b); err != nil {
+		return json.RawMessage(b)
+	}
+	return buf.Bytes()
+}
+
+func parseCode(s string) codes.Code {
+	for c := codes.OK; c <= codes.Unauthenticated; c++ {
+		if c.String() == s {
+			return c
+		}
+	}
+	return codes.Unknown
+}
+
+// clearFields clears the fields with the given names in m and in the
+// messages it contains.
+func clearFields(m protoreflect.Message, names map[protoreflect.Name]bool) {
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if names[fd.Name()] {
+			m.Clear(fd)
+			return true
+		}
+		switch {
+		case fd.IsList() && fd.Message() != nil:
+			list := v.List()
+			for i := 0; i < list.Len(); i++ {
+				clearFields(list.Get(i).Message(), names)
+			}
+		case fd.IsMap() && fd.MapValue().Message() != nil:
+			v.Map().Range(func(_ protoreflect.MapKey, v protoreflect.Value) bool {
+				clearFields(v.Message(), names)
+				return true
+			})
+		case fd.Message() != nil && !fd.IsMap():
+			clearFields(v.Message(), names)
+		}
+		return true
+	})
+}
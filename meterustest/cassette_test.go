@@ -0,0 +1,80 @@
+package meterustest_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/elliot14A/meterus-go/client"
+	meter "github.com/elliot14A/meterus-go/meters/v1"
+	"github.com/elliot14A/meterus-go/meterustest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestCassetteRoundTrip(t *testing.T) {
+	faults := meterustest.NewFaults(1)
+	faults.Add(meterustest.FaultRule{
+		Method:     "GetMeter",
+		Code:       codes.ResourceExhausted,
+		Message:    "slow down",
+		RetryDelay: 2 * time.Second,
+		Times:      1,
+	})
+	srv := meterustest.NewServer(meterustest.WithFaults(faults))
+	defer srv.Close()
+	ctx := context.Background()
+
+	cassette := meterustest.NewCassette()
+	c := srv.Client("admin-key", grpc.WithUnaryInterceptor(cassette.UnaryClientInterceptor()))
+	defer c.Close()
+	metering := c.NewMeteringService()
+	event, err := client.NewCloudEvent("evt-1", "gateway", "1.0", "request", time.Now(), "acme", nil)
+	require.NoError(t, err)
+	require.NoError(t, metering.Ingest(ctx, event))
+	_, err = metering.GetMeter(ctx, "tokens")
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	path := filepath.Join(t.TempDir(), "testdata", "cassette.json")
+	require.NoError(t, cassette.Save(path))
+	loaded, err := meterustest.LoadCassette(path)
+	require.NoError(t, err)
+	require.Len(t, loaded.Interactions(), 2)
+
+	t.Run("replay", func(t *testing.T) {
+		replayed := client.NewMeteringServiceFromConn(loaded.Replay(meterustest.IgnoreFields("id", "time")), "")
+		other := proto.Clone(event).(*meter.CloudEvent)
+		other.Id = "evt-2"
+		require.NoError(t, replayed.Ingest(ctx, other), "ignored fields must not be matched")
+
+		_, err := replayed.GetMeter(ctx, "tokens")
+		s := status.Convert(err)
+		assert.Equal(t, codes.ResourceExhausted, s.Code())
+		assert.Equal(t, "slow down", s.Message())
+		require.Len(t, s.Details(), 1, "status details must be replayed")
+		info, ok := s.Details()[0].(*errdetails.RetryInfo)
+		require.True(t, ok)
+		assert.Equal(t, 2*time.Second, info.RetryDelay.AsDuration())
+
+		err = replayed.Ingest(ctx, other)
+		assert.Equal(t, codes.Internal, status.Code(err))
+		assert.Contains(t, err.Error(), "no recorded exchange left")
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		replayed := client.NewMeteringServiceFromConn(loaded.Replay(), "")
+		other := proto.Clone(event).(*meter.CloudEvent)
+		other.Id = "evt-2"
+		err := replayed.Ingest(ctx, other)
+		assert.Equal(t, codes.Internal, status.Code(err))
+		assert.Contains(t, err.Error(), "matches request")
+		assert.Contains(t, err.Error(), `"id":"evt-2"`)
+		assert.Contains(t, err.Error(), `"id":"evt-1"`, "the error must describe the next recorded request")
+	})
+}
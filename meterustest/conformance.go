@@ -0,0 +1,494 @@
+package meterustest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/elliot14A/meterus-go/internal/uuid"
+	meter "github.com/elliot14A/meterus-go/meters/v1"
+	subject "github.com/elliot14A/meterus-go/subject/v1"
+	validation "github.com/elliot14A/meterus-go/validation/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Implementation is a Meterus backend checked by RunConformance. Subjects and
+// Validation are optional; their contracts are skipped when nil.
+type Implementation struct {
+	Metering   meter.MeteringServiceServer
+	Subjects   subject.SubjectServiceServer
+	Validation validation.ValidationServiceServer
+}
+
+// RunConformance checks that impl behaves like the Meterus services. Each
+// contract runs as a subtest named after it, and failures state the contract
+// violated. The servers are called directly, without a gRPC transport. The
+// checks use meters, event types and subjects with random names, so they can
+// run against a backend holding other data.
+//
+//	func TestConformance(t *testing.T) {
+//		srv := meterustest.NewServer()
+//		defer srv.Close()
+//		meterustest.RunConformance(t, meterustest.Implementation{
+//			Metering:   srv.MeteringServer(),
+//			Subjects:   srv.SubjectServer(),
+//			Validation: srv.ValidationServer(),
+//		})
+//	}
+func RunConformance(t *testing.T, impl Implementation) {
+	c := &conformance{impl: impl}
+	t.Run("Meters", func(t *testing.T) {
+		t.Run("CreateMeter returns the meter", c.createMeter)
+		t.Run("CreateMeter rejects invalid requests", c.createMeterInvalid)
+		t.Run("CreateMeter rejects duplicate slugs", c.createMeterDuplicate)
+		t.Run("GetMeter resolves IDs and slugs", c.getMeter)
+		t.Run("GetMeter reports unknown meters", c.getMeterNotFound)
+		t.Run("DeleteMeter removes the meter", c.deleteMeter)
+		t.Run("ListMeters paginates", c.listMeters)
+	})
+	t.Run("Query", func(t *testing.T) {
+		t.Run("aggregations", c.aggregations)
+		t.Run("time range", c.queryRange)
+		t.Run("subject filter", c.querySubjects)
+		t.Run("group by", c.groupBy)
+		t.Run("FilterGroupBy", c.filterGroupBy)
+		t.Run("window size", c.windowSize)
+		t.Run("WindowTimeZone", c.windowTimeZone)
+		t.Run("unknown meter", c.queryNotFound)
+	})
+	t.Run("ListMeterSubjects", c.listMeterSubjects)
+	t.Run("Subjects", func(t *testing.T) {
+		if impl.Subjects == nil {
+			t.Skip("no subject service")
+		}
+		t.Run("CRUD", c.subjectCRUD)
+		t.Run("ListSubjects paginates", c.listSubjects)
+	})
+	t.Run("Validation", func(t *testing.T) {
+		if impl.Validation == nil {
+			t.Skip("no validation service")
+		}
+		t.Run("unknown keys are invalid", c.unknownKey)
+		t.Run("created keys are valid", c.createdKey)
+	})
+}
+
+type conformance struct {
+	impl Implementation
+}
+
+// conformanceBase is the start of the hour the query checks ingest events in.
+var conformanceBase = time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+
+// fixtureEvents returns the events ingested for query checks: four events in
+// two hours for two subjects, with a number property "tokens" and string
+// properties "model" and "region".
+func fixtureEvents(eventType string) []*meter.CloudEvent {
+	specs := []struct {
+		offset  time.Duration
+		subject string
+		tokens  float64
+		model   string
+		region  string
+	}{
+		{0, "alice", 1, "small", "eu"},
+		{10 * time.Minute, "bob", 2, "large", "us"},
+		{70 * time.Minute, "alice", 3, "small", "us"},
+		{80 * time.Minute, "alice", 4, "medium", "eu"},
+	}
+	events := make([]*meter.CloudEvent, len(specs))
+	for i, s := range specs {
+		data, _ := structpb.NewStruct(map[string]any{"tokens": s.tokens, "model": s.model, "region": s.region})
+		events[i] = &meter.CloudEvent{
+			Id:          uuid.MustNew(),
+			Source:      "conformance",
+			SpecVersion: "1.0",
+			Type:        eventType,
+			Time:        timestamppb.New(conformanceBase.Add(s.offset)),
+			Subject:     s.subject,
+			Data:        data,
+		}
+	}
+	return events
+}
+
+// uniqueName returns name with a random suffix.
+func uniqueName(name string) string {
+	return name + "-" + uuid.MustNew()[:8]
+}
+
+func (c *conformance) newMeter(t *testing.T, agg meter.Aggregation, valueProperty string) *meter.Meter {
+	t.Helper()
+	req := &meter.CreateMeterRequest{
+		Slug:        uniqueName("conformance"),
+		Description: proto.String("conformance meter"),
+		Aggregation: agg,
+		GroupBy:     []string{"model", "region"},
+		EventType:   uniqueName("conformance.event"),
+		CreatedBy:   "conformance",
+	}
+	if valueProperty != "" {
+		req.ValueProperty = proto.String(valueProperty)
+	}
+	m, err := c.impl.Metering.CreateMeter(context.Background(), req)
+	require.NoError(t, err, "CreateMeter must accept a valid request")
+	require.NotNil(t, m, "CreateMeter must return the meter")
+	t.Cleanup(func() {
+		c.impl.Metering.DeleteMeter(context.Background(), &meter.MeterId{MeterIdOrSlug: m.Id})
+	})
+	return m
+}
+
+// newFixture creates a meter and ingests the fixture events for it.
+func (c *conformance) newFixture(t *testing.T, agg meter.Aggregation, valueProperty string) *meter.Meter {
+	t.Helper()
+	m := c.newMeter(t, agg, valueProperty)
+	for _, e := range fixtureEvents(m.EventType) {
+		_, err := c.impl.Metering.Ingest(context.Background(), e)
+		require.NoError(t, err, "Ingest must accept a valid event")
+	}
+	return m
+}
+
+func (c *conformance) query(t *testing.T, req *meter.QueryMeterRequest) *meter.QueryMeterResponse {
+	t.Helper()
+	if req.From == nil {
+		req.From = timestamppb.New(conformanceBase.Add(-time.Hour))
+	}
+	if req.To == nil {
+		req.To = timestamppb.New(conformanceBase.Add(3 * time.Hour))
+	}
+	res, err := c.impl.Metering.QueryMeter(context.Background(), req)
+	require.NoError(t, err, "QueryMeter must accept a valid request")
+	return res
+}
+
+// assertCode asserts that err carries the given status code.
+func assertCode(t *testing.T, want codes.Code, err error, contract string) {
+	t.Helper()
+	require.Error(t, err, contract)
+	assert.Equal(t, want.String(), status.Code(err).String(), contract)
+}
+
+func (c *conformance) createMeter(t *testing.T) {
+	m := c.newMeter(t, meter.Aggregation_AGGREGATION_SUM, "$.tokens")
+	assert.NotEmpty(t, m.Id, "CreateMeter must assign an ID")
+	assert.Equal(t, "conformance meter", m.GetDescription(), "CreateMeter must store the description")
+	assert.Equal(t, meter.Aggregation_AGGREGATION_SUM, m.Aggregation, "CreateMeter must store the aggregation")
+	assert.Equal(t, "$.tokens", m.GetValueProperty(), "CreateMeter must store the value property")
+	assert.Equal(t, []string{"model", "region"}, m.GroupBy, "CreateMeter must store the group-by keys")
+	assert.NotEmpty(t, m.EventType, "CreateMeter must store the event type")
+	assert.NotNil(t, m.CreatedAt, "CreateMeter must set the creation time")
+}
+
+func (c *conformance) createMeterInvalid(t *testing.T) {
+	ctx := context.Background()
+	_, err := c.impl.Metering.CreateMeter(ctx, &meter.CreateMeterRequest{
+		EventType:   uniqueName("conformance.event"),
+		Aggregation: meter.Aggregation_AGGREGATION_COUNT,
+	})
+	assertCode(t, codes.InvalidArgument, err, "CreateMeter must reject a meter without slug")
+
+	_, err = c.impl.Metering.CreateMeter(ctx, &meter.CreateMeterRequest{
+		Slug:        uniqueName("conformance"),
+		EventType:   uniqueName("conformance.event"),
+		Aggregation: meter.Aggregation_AGGREGATION_SUM,
+	})
+	assertCode(t, codes.InvalidArgument, err, "CreateMeter must reject a SUM meter without value property")
+}
+
+func (c *conformance) createMeterDuplicate(t *testing.T) {
+	m := c.newMeter(t, meter.Aggregation_AGGREGATION_COUNT, "")
+	_, err := c.impl.Metering.CreateMeter(context.Background(), &meter.CreateMeterRequest{
+		Slug:        m.Slug,
+		EventType:   m.EventType,
+		Aggregation: meter.Aggregation_AGGREGATION_COUNT,
+	})
+	assertCode(t, codes.AlreadyExists, err, "CreateMeter must reject a slug already in use")
+}
+
+func (c *conformance) getMeter(t *testing.T) {
+	m := c.newMeter(t, meter.Aggregation_AGGREGATION_COUNT, "")
+	for _, key := range []string{m.Id, m.Slug} {
+		got, err := c.impl.Metering.GetMeter(context.Background(), &meter.MeterId{MeterIdOrSlug: key})
+		require.NoError(t, err, "GetMeter must find a meter by ID or slug %q", key)
+		assert.Equal(t, m.Id, got.Id, "GetMeter(%q) must return the meter it names", key)
+		assert.Equal(t, m.Slug, got.Slug, "GetMeter(%q) must return the meter it names", key)
+	}
+}
+
+func (c *conformance) getMeterNotFound(t *testing.T) {
+	_, err := c.impl.Metering.GetMeter(context.Background(), &meter.MeterId{MeterIdOrSlug: uniqueName("missing")})
+	assertCode(t, codes.NotFound, err, "GetMeter must report an unknown meter as NotFound")
+}
+
+func (c *conformance) deleteMeter(t *testing.T) {
+	ctx := context.Background()
+	m := c.newMeter(t, meter.Aggregation_AGGREGATION_COUNT, "")
+	_, err := c.impl.Metering.DeleteMeter(ctx, &meter.MeterId{MeterIdOrSlug: m.Slug})
+	require.NoError(t, err, "DeleteMeter must delete a meter by slug")
+	_, err = c.impl.Metering.GetMeter(ctx, &meter.MeterId{MeterIdOrSlug: m.Id})
+	assertCode(t, codes.NotFound, err, "GetMeter must not find a deleted meter")
+	_, err = c.impl.Metering.DeleteMeter(ctx, &meter.MeterId{MeterIdOrSlug: m.Id})
+	assertCode(t, codes.NotFound, err, "DeleteMeter must report an unknown meter as NotFound")
+}
+
+func (c *conformance) listMeters(t *testing.T) {
+	created := make(map[string]bool)
+	for range 3 {
+		created[c.newMeter(t, meter.Aggregation_AGGREGATION_COUNT, "").Id] = true
+	}
+
+	const limit = 2
+	seen := make(map[string]bool)
+	for page := int32(1); ; page++ {
+		res, err := c.impl.Metering.ListMeters(context.Background(), &meter.ListMetersRequest{Limit: limit, Page: page})
+		require.NoError(t, err, "ListMeters must accept page %d", page)
+		require.LessOrEqual(t, len(res.Meters), limit, "ListMeters must return at most limit meters per page")
+		for _, m := range res.Meters {
+			require.False(t, seen[m.Id], "ListMeters must not return meter %q on two pages", m.Id)
+			seen[m.Id] = true
+		}
+		if len(res.Meters) < limit {
+			break
+		}
+		require.Less(t, int(page), 10000, "ListMeters must run out of pages")
+	}
+	for id := range created {
+		assert.True(t, seen[id], "ListMeters must return meter %q on some page", id)
+	}
+}
+
+func (c *conformance) aggregations(t *testing.T) {
+	tests := []struct {
+		agg      meter.Aggregation
+		property string
+		want     float64
+	}{
+		{meter.Aggregation_AGGREGATION_COUNT, "", 4},
+		{meter.Aggregation_AGGREGATION_SUM, "$.tokens", 10},
+		{meter.Aggregation_AGGREGATION_AVG, "$.tokens", 2.5},
+		{meter.Aggregation_AGGREGATION_MIN, "$.tokens", 1},
+		{meter.Aggregation_AGGREGATION_MAX, "$.tokens", 4},
+		{meter.Aggregation_AGGREGATION_UNIQUE_COUNT, "$.model", 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.agg.String(), func(t *testing.T) {
+			m := c.newFixture(t, tt.agg, tt.property)
+			res := c.query(t, &meter.QueryMeterRequest{MeterIdOrSlug: m.Slug})
+			require.Len(t, res.Data, 1, "QueryMeter without window size or group-by must return a single row")
+			assert.InDelta(t, tt.want, res.Data[0].Value, 1e-9, "%s over %s must aggregate all matching events", tt.agg, valueOr(tt.property, "events"))
+		})
+	}
+}
+
+func (c *conformance) queryRange(t *testing.T) {
+	m := c.newFixture(t, meter.Aggregation_AGGREGATION_SUM, "$.tokens")
+	res := c.query(t, &meter.QueryMeterRequest{
+		MeterIdOrSlug: m.Id,
+		From:          timestamppb.New(conformanceBase.Add(10 * time.Minute)),
+		To:            timestamppb.New(conformanceBase.Add(80 * time.Minute)),
+	})
+	require.Len(t, res.Data, 1, "QueryMeter must return a single row for a range with events")
+	assert.Equal(t, 5.0, res.Data[0].Value, "QueryMeter must include events at From and exclude events at To")
+}
+
+func (c *conformance) querySubjects(t *testing.T) {
+	m := c.newFixture(t, meter.Aggregation_AGGREGATION_SUM, "$.tokens")
+	res := c.query(t, &meter.QueryMeterRequest{MeterIdOrSlug: m.Slug, Subject: []string{"bob"}})
+	require.Len(t, res.Data, 1, "QueryMeter must return a single row for a subject with events")
+	assert.Equal(t, 2.0, res.Data[0].Value, "QueryMeter must only aggregate events of the requested subjects")
+}
+
+func (c *conformance) groupBy(t *testing.T) {
+	m := c.newFixture(t, meter.Aggregation_AGGREGATION_SUM, "$.tokens")
+	res := c.query(t, &meter.QueryMeterRequest{MeterIdOrSlug: m.Slug, GroupBy: []string{"subject", "region"}})
+	want := map[string]float64{"alice/eu": 5, "alice/us": 3, "bob/us": 2}
+	assert.Equal(t, want, groupedValues(res, "subject", "region"), "QueryMeter must return a row per combination of group-by values")
+
+	_, err := c.impl.Metering.QueryMeter(context.Background(), &meter.QueryMeterRequest{MeterIdOrSlug: m.Slug, GroupBy: []string{"undeclared"}})
+	assertCode(t, codes.InvalidArgument, err, "QueryMeter must reject group-by keys the meter does not declare")
+}
+
+func (c *conformance) filterGroupBy(t *testing.T) {
+	m := c.newFixture(t, meter.Aggregation_AGGREGATION_COUNT, "")
+	res := c.query(t, &meter.QueryMeterRequest{
+		MeterIdOrSlug: m.Slug,
+		FilterGroupBy: map[string]*meter.FilterGroupValues{"model": {Values: []string{"small", "medium"}}},
+		GroupBy:       []string{"model"},
+	})
+	want := map[string]float64{"small": 2, "medium": 1}
+	assert.Equal(t, want, groupedValues(res, "model"), "QueryMeter must only aggregate events whose property matches one of the FilterGroupBy values")
+}
+
+func (c *conformance) windowSize(t *testing.T) {
+	m := c.newFixture(t, meter.Aggregation_AGGREGATION_SUM, "$.tokens")
+	res := c.query(t, &meter.QueryMeterRequest{MeterIdOrSlug: m.Slug, WindowSize: "HOUR"})
+	require.Len(t, res.Data, 2, "QueryMeter must return a row per hour window with events")
+	for i, want := range []struct {
+		from  time.Time
+		value float64
+	}{{conformanceBase, 3}, {conformanceBase.Add(time.Hour), 7}} {
+		row := res.Data[i]
+		assert.True(t, want.from.Equal(row.From.AsTime()), "HOUR window %d must start at %s, got %s", i, want.from, row.From.AsTime())
+		assert.True(t, want.from.Add(time.Hour).Equal(row.To.AsTime()), "HOUR window %d must last an hour", i)
+		assert.Equal(t, want.value, row.Value, "HOUR window %d must aggregate the events within it", i)
+	}
+
+	_, err := c.impl.Metering.QueryMeter(context.Background(), &meter.QueryMeterRequest{MeterIdOrSlug: m.Slug, WindowSize: "FORTNIGHT"})
+	assertCode(t, codes.InvalidArgument, err, "QueryMeter must reject unknown window sizes")
+}
+
+func (c *conformance) windowTimeZone(t *testing.T) {
+	m := c.newFixture(t, meter.Aggregation_AGGREGATION_COUNT, "")
+	// At UTC+11 the events at 12:xx and 13:xx UTC fall on 23:xx and 00:xx
+	// local time, in different days, while they share a day in UTC.
+	res := c.query(t, &meter.QueryMeterRequest{
+		MeterIdOrSlug:  m.Slug,
+		From:           timestamppb.New(conformanceBase.Add(-24 * time.Hour)),
+		To:             timestamppb.New(conformanceBase.Add(24 * time.Hour)),
+		WindowSize:     "DAY",
+		WindowTimeZone: "Pacific/Noumea",
+	})
+	loc, err := time.LoadLocation("Pacific/Noumea")
+	require.NoError(t, err)
+	require.Len(t, res.Data, 2, "DAY windows must be aligned to midnight in WindowTimeZone")
+	day := time.Date(2024, 3, 10, 0, 0, 0, 0, loc)
+	assert.True(t, day.Equal(res.Data[0].From.AsTime()), "the first DAY window must start at local midnight %s, got %s", day, res.Data[0].From.AsTime())
+	assert.Equal(t, 2.0, res.Data[0].Value, "the first DAY window must hold the events of the local day")
+	assert.Equal(t, 2.0, res.Data[1].Value, "the second DAY window must hold the events of the next local day")
+
+	_, err = c.impl.Metering.QueryMeter(context.Background(), &meter.QueryMeterRequest{MeterIdOrSlug: m.Slug, WindowSize: "DAY", WindowTimeZone: "Not/AZone"})
+	assertCode(t, codes.InvalidArgument, err, "QueryMeter must reject unknown time zones")
+}
+
+func (c *conformance) queryNotFound(t *testing.T) {
+	_, err := c.impl.Metering.QueryMeter(context.Background(), &meter.QueryMeterRequest{MeterIdOrSlug: uniqueName("missing")})
+	assertCode(t, codes.NotFound, err, "QueryMeter must report an unknown meter as NotFound")
+}
+
+func (c *conformance) listMeterSubjects(t *testing.T) {
+	m := c.newFixture(t, meter.Aggregation_AGGREGATION_COUNT, "")
+	for _, key := range []string{m.Id, m.Slug} {
+		res, err := c.impl.Metering.ListMeterSubjects(context.Background(), &meter.ListMeterSubjectsRequest{MeterIdOrSlug: key})
+		require.NoError(t, err, "ListMeterSubjects must find a meter by ID or slug %q", key)
+		assert.ElementsMatch(t, []string{"alice", "bob"}, res.Subjects, "ListMeterSubjects must return each subject with events for the meter once")
+	}
+	_, err := c.impl.Metering.ListMeterSubjects(context.Background(), &meter.ListMeterSubjectsRequest{MeterIdOrSlug: uniqueName("missing")})
+	assertCode(t, codes.NotFound, err, "ListMeterSubjects must report an unknown meter as NotFound")
+}
+
+func (c *conformance) subjectCRUD(t *testing.T) {
+	ctx := context.Background()
+	id := uniqueName("conformance-subject")
+	created, err := c.impl.Subjects.CreateSubject(ctx, &subject.Subject{Id: id, DisplayName: proto.String("Before")})
+	require.NoError(t, err, "CreateSubject must accept a valid subject")
+	assert.Equal(t, id, created.Id, "CreateSubject must return the subject")
+
+	_, err = c.impl.Subjects.CreateSubject(ctx, &subject.Subject{Id: id})
+	assertCode(t, codes.AlreadyExists, err, "CreateSubject must reject an ID already in use")
+
+	_, err = c.impl.Subjects.UpdateSubject(ctx, &subject.Subject{Id: id, DisplayName: proto.String("After")})
+	require.NoError(t, err, "UpdateSubject must update an existing subject")
+	got, err := c.impl.Subjects.GetSubject(ctx, &subject.SubjectId{SubjectId: id})
+	require.NoError(t, err, "GetSubject must find an existing subject")
+	assert.Equal(t, "After", got.GetDisplayName(), "GetSubject must return the updated display name")
+
+	_, err = c.impl.Subjects.DeleteSubject(ctx, &subject.SubjectId{SubjectId: id})
+	require.NoError(t, err, "DeleteSubject must delete an existing subject")
+	_, err = c.impl.Subjects.GetSubject(ctx, &subject.SubjectId{SubjectId: id})
+	assertCode(t, codes.NotFound, err, "GetSubject must not find a deleted subject")
+	_, err = c.impl.Subjects.DeleteSubject(ctx, &subject.SubjectId{SubjectId: id})
+	assertCode(t, codes.NotFound, err, "DeleteSubject must report an unknown subject as NotFound")
+}
+
+func (c *conformance) listSubjects(t *testing.T) {
+	ctx := context.Background()
+	for range 3 {
+		id := uniqueName("conformance-subject")
+		_, err := c.impl.Subjects.CreateSubject(ctx, &subject.Subject{Id: id})
+		require.NoError(t, err, "CreateSubject must accept a valid subject")
+		t.Cleanup(func() { c.impl.Subjects.DeleteSubject(ctx, &subject.SubjectId{SubjectId: id}) })
+	}
+	all, err := c.impl.Subjects.ListSubjects(ctx, &subject.ListSubjectRequest{})
+	require.NoError(t, err, "ListSubjects must accept a request without limit")
+	first, err := c.impl.Subjects.ListSubjects(ctx, &subject.ListSubjectRequest{Limit: 2, Page: 1})
+	require.NoError(t, err, "ListSubjects must accept a limit")
+	assert.Len(t, first.Subjects, 2, "ListSubjects must return limit subjects on a full page")
+	assert.Equal(t, all.Total, first.Total, "ListSubjects must report the total regardless of pagination")
+	assert.GreaterOrEqual(t, int(all.Total), 3, "ListSubjects must count all subjects")
+}
+
+func (c *conformance) unknownKey(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+uniqueName("unknown")))
+	res, err := c.impl.Validation.ValidateApiKey(ctx, &validation.ValidateApiKeyRequest{})
+	if err != nil {
+		assertCode(t, codes.Unauthenticated, err, "ValidateApiKey must reject an unknown key as invalid or Unauthenticated")
+		return
+	}
+	assert.False(t, res.IsValid, "ValidateApiKey must not report an unknown key as valid")
+}
+
+func (c *conformance) createdKey(t *testing.T) {
+	sub := uniqueName("conformance-subject")
+	created, err := c.impl.Validation.CreateApiKey(context.Background(), &validation.CreateApiKeyRequest{
+		Name:    "conformance",
+		Subject: sub,
+		Scopes:  []string{"meters:read"},
+	})
+	if status.Code(err) == codes.Unimplemented {
+		t.Skip("API key management is not implemented")
+	}
+	require.NoError(t, err, "CreateApiKey must accept a valid request")
+	require.NotEmpty(t, created.Secret, "CreateApiKey must return the secret")
+	t.Cleanup(func() {
+		// Leave no usable key behind in a backend holding other data.
+		_, err := c.impl.Validation.RevokeApiKey(context.Background(), &validation.ApiKeyId{ApiKeyId: created.GetApiKey().GetId()})
+		assert.NoError(t, err, "RevokeApiKey must revoke a created key")
+	})
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+created.Secret))
+	res, err := c.impl.Validation.ValidateApiKey(ctx, &validation.ValidateApiKeyRequest{RequiredScopes: []string{"meters:read"}})
+	require.NoError(t, err, "ValidateApiKey must accept a created key")
+	assert.True(t, res.IsValid, "ValidateApiKey must report a created key with the required scopes as valid")
+	assert.Equal(t, sub, res.GetMetadata().GetSubject(), "ValidateApiKey must return the subject of the key")
+
+	res, err = c.impl.Validation.ValidateApiKey(ctx, &validation.ValidateApiKeyRequest{RequiredScopes: []string{"meters:write"}})
+	if err != nil {
+		assertCode(t, codes.PermissionDenied, err, "ValidateApiKey must reject a key lacking scopes as invalid or PermissionDenied")
+		return
+	}
+	assert.False(t, res.IsValid, "ValidateApiKey must not report a key lacking the required scopes as valid")
+}
+
+// groupedValues returns the values of the rows of res keyed by their group
+// values joined with "/".
+func groupedValues(res *meter.QueryMeterResponse, keys ...string) map[string]float64 {
+	values := make(map[string]float64)
+	for _, row := range res.Data {
+		var k string
+		for i, key := range keys {
+			if i > 0 {
+				k += "/"
+			}
+			k += fmt.Sprint(row.GroupBy.GetFields()[key].AsInterface())
+		}
+		values[k] += row.Value
+	}
+	return values
+}
+
+func valueOr(s, fallback string) string {
+	if s == "" {
+		return fallback
+	}
+	return s
+}
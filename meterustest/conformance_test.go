@@ -0,0 +1,17 @@
+package meterustest_test
+
+import (
+	"testing"
+
+	"github.com/elliot14A/meterus-go/meterustest"
+)
+
+func TestConformance(t *testing.T) {
+	srv := meterustest.NewServer()
+	defer srv.Close()
+	meterustest.RunConformance(t, meterustest.Implementation{
+		Metering:   srv.MeteringServer(),
+		Subjects:   srv.SubjectServer(),
+		Validation: srv.ValidationServer(),
+	})
+}
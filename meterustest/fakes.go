@@ -0,0 +1,271 @@
+package meterustest
+
+import (
+	"context"
+	"sync"
+
+	"github.com/elliot14A/meterus-go/client"
+	meter "github.com/elliot14A/meterus-go/meters/v1"
+	subject "github.com/elliot14A/meterus-go/subject/v1"
+	validation "github.com/elliot14A/meterus-go/validation/v1"
+)
+
+// Call is a call recorded by a fake. Args holds the arguments following the
+// context.
+type Call struct {
+	Method string
+	Args   []any
+}
+
+// callLog records the calls to a fake.
+type callLog struct {
+	mu    sync.Mutex
+	calls []Call
+}
+
+func (l *callLog) record(method string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.calls = append(l.calls, Call{Method: method, Args: args})
+}
+
+// Calls returns the recorded calls in the order they were made.
+func (l *callLog) Calls() []Call {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Call(nil), l.calls...)
+}
+
+// CallsTo returns the recorded calls to the given method.
+func (l *callLog) CallsTo(method string) []Call {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var calls []Call
+	for _, c := range l.calls {
+		if c.Method == method {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// ResetCalls forgets the recorded calls.
+func (l *callLog) ResetCalls() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.calls = nil
+}
+
+// FakeMetering is a client.MeteringClient recording its calls. Each method
+// calls the matching function field if set, and otherwise returns an empty
+// result and a nil error. IngestAsync delivers through Ingest.
+type FakeMetering struct {
+	callLog
+
+	IngestFunc            func(ctx context.Context, event *meter.CloudEvent) error
+	ListMetersFunc        func(ctx context.Context, limit, page int32) (*meter.ListMetersResponse, error)
+	GetMeterFunc          func(ctx context.Context, meterIDOrSlug string) (*meter.Meter, error)
+	CreateMeterFunc       func(ctx context.Context, req *meter.CreateMeterRequest) (*meter.Meter, error)
+	DeleteMeterFunc       func(ctx context.Context, meterIDOrSlug string) error
+	QueryMeterFunc        func(ctx context.Context, req *meter.QueryMeterRequest) (*meter.QueryMeterResponse, error)
+	ListMeterSubjectsFunc func(ctx context.Context, meterIDOrSlug string) (*meter.ListMeterSubjectsResponse, error)
+}
+
+var _ client.MeteringClient = (*FakeMetering)(nil)
+
+func (f *FakeMetering) Ingest(ctx context.Context, event *meter.CloudEvent) error {
+	f.record("Ingest", event)
+	return f.ingest(ctx, event)
+}
+
+func (f *FakeMetering) ingest(ctx context.Context, event *meter.CloudEvent) error {
+	if f.IngestFunc != nil {
+		return f.IngestFunc(ctx, event)
+	}
+	return nil
+}
+
+func (f *FakeMetering) IngestAsync(ctx context.Context, event *meter.CloudEvent) *client.Delivery {
+	f.record("IngestAsync", event)
+	err := f.ingest(ctx, event)
+	return client.CompletedDelivery(client.DeliveryResult{EventID: event.Id, Attempts: 1, Err: err})
+}
+
+func (f *FakeMetering) ListMeters(ctx context.Context, limit, page int32) (*meter.ListMetersResponse, error) {
+	f.record("ListMeters", limit, page)
+	if f.ListMetersFunc != nil {
+		return f.ListMetersFunc(ctx, limit, page)
+	}
+	return &meter.ListMetersResponse{}, nil
+}
+
+func (f *FakeMetering) GetMeter(ctx context.Context, meterIDOrSlug string) (*meter.Meter, error) {
+	f.record("GetMeter", meterIDOrSlug)
+	if f.GetMeterFunc != nil {
+		return f.GetMeterFunc(ctx, meterIDOrSlug)
+	}
+	return &meter.Meter{}, nil
+}
+
+func (f *FakeMetering) CreateMeter(ctx context.Context, req *meter.CreateMeterRequest) (*meter.Meter, error) {
+	f.record("CreateMeter", req)
+	if f.CreateMeterFunc != nil {
+		return f.CreateMeterFunc(ctx, req)
+	}
+	return &meter.Meter{}, nil
+}
+
+func (f *FakeMetering) DeleteMeter(ctx context.Context, meterIDOrSlug string) error {
+	f.record("DeleteMeter", meterIDOrSlug)
+	if f.DeleteMeterFunc != nil {
+		return f.DeleteMeterFunc(ctx, meterIDOrSlug)
+	}
+	return nil
+}
+
+func (f *FakeMetering) QueryMeter(ctx context.Context, req *meter.QueryMeterRequest) (*meter.QueryMeterResponse, error) {
+	f.record("QueryMeter", req)
+	if f.QueryMeterFunc != nil {
+		return f.QueryMeterFunc(ctx, req)
+	}
+	return &meter.QueryMeterResponse{}, nil
+}
+
+func (f *FakeMetering) ListMeterSubjects(ctx context.Context, meterIDOrSlug string) (*meter.ListMeterSubjectsResponse, error) {
+	f.record("ListMeterSubjects", meterIDOrSlug)
+	if f.ListMeterSubjectsFunc != nil {
+		return f.ListMeterSubjectsFunc(ctx, meterIDOrSlug)
+	}
+	return &meter.ListMeterSubjectsResponse{}, nil
+}
+
+// FakeSubjects is a client.SubjectClient recording its calls. Each method
+// calls the matching function field if set, and otherwise returns an empty
+// result and a nil error.
+type FakeSubjects struct {
+	callLog
+
+	CreateFunc   func(ctx context.Context, id string, displayName *string) (*subject.Subject, error)
+	GetByIdFunc  func(ctx context.Context, id string) (*subject.Subject, error)
+	ListByIdFunc func(ctx context.Context, page, limit int32) ([]*subject.Subject, error)
+	UpdateFunc   func(ctx context.Context, id string, displayName *string) (*subject.Subject, error)
+	DeleteFunc   func(ctx context.Context, id string) error
+}
+
+var _ client.SubjectClient = (*FakeSubjects)(nil)
+
+func (f *FakeSubjects) Create(ctx context.Context, id string, displayName *string) (*subject.Subject, error) {
+	f.record("Create", id, displayName)
+	if f.CreateFunc != nil {
+		return f.CreateFunc(ctx, id, displayName)
+	}
+	return &subject.Subject{Id: id, DisplayName: displayName}, nil
+}
+
+func (f *FakeSubjects) GetById(ctx context.Context, id string) (*subject.Subject, error) {
+	f.record("GetById", id)
+	if f.GetByIdFunc != nil {
+		return f.GetByIdFunc(ctx, id)
+	}
+	return &subject.Subject{Id: id}, nil
+}
+
+func (f *FakeSubjects) ListById(ctx context.Context, page, limit int32) ([]*subject.Subject, error) {
+	f.record("ListById", page, limit)
+	if f.ListByIdFunc != nil {
+		return f.ListByIdFunc(ctx, page, limit)
+	}
+	return nil, nil
+}
+
+func (f *FakeSubjects) Update(ctx context.Context, id string, displayName *string) (*subject.Subject, error) {
+	f.record("Update", id, displayName)
+	if f.UpdateFunc != nil {
+		return f.UpdateFunc(ctx, id, displayName)
+	}
+	return &subject.Subject{Id: id, DisplayName: displayName}, nil
+}
+
+func (f *FakeSubjects) Delete(ctx context.Context, id string) error {
+	f.record("Delete", id)
+	if f.DeleteFunc != nil {
+		return f.DeleteFunc(ctx, id)
+	}
+	return nil
+}
+
+// FakeValidation is a client.ValidationClient recording its calls. Each
+// method calls the matching function field if set. Without one, validations
+// report the key as invalid, ValidateApiKeyExpr and ValidateAndMeter validate
+// through ValidateApiKeyFunc, ValidateApiKeyExpr checking the expression like
+// client.ValidateScopeExpr, and the other methods return an empty result and a
+// nil error.
+type FakeValidation struct {
+	callLog
+
+	ValidateApiKeyFunc   func(ctx context.Context, apiKey string, scopes []string) (*client.ValidationResult, error)
+	ValidateAndMeterFunc func(ctx context.Context, apiKey string, scopes []string, event *meter.CloudEvent) (*client.ValidationResult, error)
+	CreateApiKeyFunc     func(ctx context.Context, req *validation.CreateApiKeyRequest) (*validation.ApiKey, string, error)
+	ListApiKeysFunc      func(ctx context.Context, req *validation.ListApiKeysRequest) (*validation.ListApiKeysResponse, error)
+	RevokeApiKeyFunc     func(ctx context.Context, id string) error
+	RotateApiKeyFunc     func(ctx context.Context, req *validation.RotateApiKeyRequest) (*validation.ApiKey, string, error)
+}
+
+var _ client.ValidationClient = (*FakeValidation)(nil)
+
+func (f *FakeValidation) ValidateApiKey(ctx context.Context, apiKey string, scopes []string) (*client.ValidationResult, error) {
+	f.record("ValidateApiKey", apiKey, scopes)
+	return f.validate(ctx, apiKey, scopes)
+}
+
+func (f *FakeValidation) validate(ctx context.Context, apiKey string, scopes []string) (*client.ValidationResult, error) {
+	if f.ValidateApiKeyFunc != nil {
+		return f.ValidateApiKeyFunc(ctx, apiKey, scopes)
+	}
+	return &client.ValidationResult{}, nil
+}
+
+func (f *FakeValidation) ValidateApiKeyExpr(ctx context.Context, apiKey string, expr client.ScopeExpr) (*client.ValidationResult, error) {
+	f.record("ValidateApiKeyExpr", apiKey, expr)
+	return client.ValidateScopeExpr(ctx, f.validate, apiKey, expr)
+}
+
+func (f *FakeValidation) ValidateAndMeter(ctx context.Context, apiKey string, scopes []string, event *meter.CloudEvent) (*client.ValidationResult, error) {
+	f.record("ValidateAndMeter", apiKey, scopes, event)
+	if f.ValidateAndMeterFunc != nil {
+		return f.ValidateAndMeterFunc(ctx, apiKey, scopes, event)
+	}
+	return f.validate(ctx, apiKey, scopes)
+}
+
+func (f *FakeValidation) CreateApiKey(ctx context.Context, req *validation.CreateApiKeyRequest) (*validation.ApiKey, string, error) {
+	f.record("CreateApiKey", req)
+	if f.CreateApiKeyFunc != nil {
+		return f.CreateApiKeyFunc(ctx, req)
+	}
+	return &validation.ApiKey{}, "", nil
+}
+
+func (f *FakeValidation) ListApiKeys(ctx context.Context, req *validation.ListApiKeysRequest) (*validation.ListApiKeysResponse, error) {
+	f.record("ListApiKeys", req)
+	if f.ListApiKeysFunc != nil {
+		return f.ListApiKeysFunc(ctx, req)
+	}
+	return &validation.ListApiKeysResponse{}, nil
+}
+
+func (f *FakeValidation) RevokeApiKey(ctx context.Context, id string) error {
+	f.record("RevokeApiKey", id)
+	if f.RevokeApiKeyFunc != nil {
+		return f.RevokeApiKeyFunc(ctx, id)
+	}
+	return nil
+}
+
+func (f *FakeValidation) RotateApiKey(ctx context.Context, req *validation.RotateApiKeyRequest) (*validation.ApiKey, string, error) {
+	f.record("RotateApiKey", req)
+	if f.RotateApiKeyFunc != nil {
+		return f.RotateApiKeyFunc(ctx, req)
+	}
+	return &validation.ApiKey{}, "", nil
+}
@@ -0,0 +1,82 @@
+package meterustest_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/elliot14A/meterus-go/client"
+	meter "github.com/elliot14A/meterus-go/meters/v1"
+	"github.com/elliot14A/meterus-go/meterustest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// billing is code under test depending on the client interfaces.
+type billing struct {
+	keys     client.ValidationClient
+	metering client.MeteringClient
+}
+
+// charge meters a request authorized by an API key allowed to write meters.
+func (b *billing) charge(ctx context.Context, apiKey string) (client.DeliveryResult, error) {
+	res, err := b.keys.ValidateApiKeyExpr(ctx, apiKey, client.MustParseScopeExpr("meters:write AND NOT suspended"))
+	if err != nil {
+		return client.DeliveryResult{}, err
+	}
+	if !res.Valid {
+		return client.DeliveryResult{}, errors.New("invalid api key")
+	}
+	event, err := client.NewCloudEvent("", "billing", "1.0", "request", time.Now(), res.Subject, nil)
+	if err != nil {
+		return client.DeliveryResult{}, err
+	}
+	return b.metering.IngestAsync(ctx, event).Wait(ctx)
+}
+
+func TestFakesDriveClientCode(t *testing.T) {
+	keys := &meterustest.FakeValidation{
+		ValidateApiKeyFunc: func(_ context.Context, apiKey string, _ []string) (*client.ValidationResult, error) {
+			switch apiKey {
+			case "writer":
+				return &client.ValidationResult{Valid: true, Subject: "acme", Scopes: []string{"meters:*"}}, nil
+			case "suspended":
+				return &client.ValidationResult{Valid: true, Subject: "globex", Scopes: []string{"meters", "suspended"}}, nil
+			case "unscoped":
+				return &client.ValidationResult{Valid: true, Subject: "initech"}, nil
+			}
+			return &client.ValidationResult{}, nil
+		},
+	}
+	metering := &meterustest.FakeMetering{}
+	b := &billing{keys: keys, metering: metering}
+	ctx := context.Background()
+
+	res, err := b.charge(ctx, "writer")
+	require.NoError(t, err)
+	assert.Equal(t, 1, res.Attempts)
+	calls := metering.CallsTo("IngestAsync")
+	require.Len(t, calls, 1)
+	event := calls[0].Args[0].(*meter.CloudEvent)
+	assert.Equal(t, "acme", event.Subject)
+	assert.Equal(t, event.Id, res.EventID)
+
+	for _, key := range []string{"suspended", "unscoped"} {
+		_, err = b.charge(ctx, key)
+		assert.True(t, errors.Is(err, client.ErrMissingScopes), "%s: %v", key, err)
+		assert.Equal(t, codes.PermissionDenied, status.Code(err), key)
+	}
+	_, err = b.charge(ctx, "unknown")
+	assert.EqualError(t, err, "invalid api key")
+	assert.Len(t, metering.CallsTo("IngestAsync"), 1, "denied requests must not be metered")
+	assert.Len(t, keys.CallsTo("ValidateApiKeyExpr"), 4)
+
+	metering.IngestFunc = func(context.Context, *meter.CloudEvent) error {
+		return status.Error(codes.Unavailable, "down")
+	}
+	_, err = b.charge(ctx, "writer")
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
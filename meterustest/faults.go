@@ -0,0 +1,339 @@
+package meterustest
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// FaultRule describes misbehaviour injected into the calls it matches. A rule
+// that fires delays the call by its latency and then fails it with Code, or
+// drops the connection if Drop is set. A rule with neither only adds latency.
+type FaultRule struct {
+	// Method selects the calls the rule applies to, either by full method
+	// name, such as "/meterus.meter.v1.MeteringService/Ingest", or by method
+	// name alone, such as "Ingest". It matches all calls if empty.
+	Method string
+
+	// Latency delays the call, and Jitter adds a random delay of up to
+	// Jitter on top of it.
+	Latency time.Duration
+	Jitter  time.Duration
+
+	// Code and Message are the status returned by the call. Code OK leaves
+	// the call to the server.
+	Code    codes.Code
+	Message string
+	// RetryDelay attaches a RetryInfo with the delay to the status, as
+	// Meterus does when it throttles a caller.
+	RetryDelay time.Duration
+
+	// Drop closes the connection of the call once the server has handled
+	// it, so that the call fails as if the network went away mid-call, after
+	// the server acted on it. Streams lose their connection after their
+	// first received message.
+	Drop bool
+
+	// Calls restricts the rule to the given matching calls, numbered from 1.
+	// Probability restricts it to a random fraction of the matching calls.
+	// The rule fires on all matching calls if both are unset.
+	Calls       []int
+	Probability float64
+
+	// Times caps how often the rule fires. Zero means no limit.
+	Times int
+}
+
+// Faults injects faults into the calls of a gRPC server according to a list
+// of rules that can be changed while the server runs. Random choices are
+// drawn from a source seeded with the given seed, so that a sequence of calls
+// misbehaves the same way in every run.
+type Faults struct {
+	mu    sync.Mutex
+	rand  *rand.Rand
+	rules []*faultRule
+	// conns holds the open connections accepted by the listeners of
+	// Listener, by their remote address.
+	conns map[net.Addr]*faultConn
+}
+
+type faultRule struct {
+	FaultRule
+	calls int
+	fired int
+}
+
+// NewFaults returns a Faults without rules whose random choices are drawn
+// from seed.
+func NewFaults(seed int64) *Faults {
+	return &Faults{
+		rand:  rand.New(rand.NewSource(seed)),
+		conns: make(map[net.Addr]*faultConn),
+	}
+}
+
+// WithFaults injects the faults into the server's calls.
+func WithFaults(f *Faults) Option {
+	return func(s *Server) {
+		s.faults = f
+	}
+}
+
+// Add appends rules. Every rule matching a call counts it, and the latencies
+// of all rules firing on a call add up. The first firing rule that fails the
+// call decides how.
+func (f *Faults) Add(rules ...FaultRule) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, rule := range rules {
+		f.rules = append(f.rules, &faultRule{FaultRule: rule})
+	}
+}
+
+// Reset removes all rules.
+func (f *Faults) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rules = nil
+}
+
+// FailNext fails the next n calls to method with code.
+func (f *Faults) FailNext(method string, code codes.Code, n int) {
+	f.Add(FaultRule{Method: method, Code: code, Times: n})
+}
+
+// UnaryServerInterceptor returns an interceptor injecting the faults into
+// unary calls.
+func (f *Faults) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		drop, err := f.inject(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := handler(ctx, req)
+		if drop {
+			f.dropConn(ctx)
+			return nil, errDropped
+		}
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor returns an interceptor injecting the faults into
+// streams when they start.
+func (f *Faults) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		drop, err := f.inject(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		if drop {
+			ss = &droppingStream{ServerStream: ss, faults: f}
+		}
+		return handler(srv, ss)
+	}
+}
+
+// droppingStream drops the connection of a stream after its first received
+// message.
+type droppingStream struct {
+	grpc.ServerStream
+	faults  *Faults
+	dropped bool
+}
+
+func (s *droppingStream) RecvMsg(m any) error {
+	if s.dropped {
+		return errDropped
+	}
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	s.dropped = true
+	s.faults.dropConn(s.Context())
+	return nil
+}
+
+// Listener wraps lis so that Drop rules can close the connections it
+// accepts. Drop rules fail calls with Unavailable without closing anything on
+// servers not serving such a listener.
+func (f *Faults) Listener(lis net.Listener) net.Listener {
+	return &faultListener{Listener: lis, faults: f}
+}
+
+// ConnContext returns ctx carrying c, for use as the ConnContext of an
+// http.Server serving a Listener, so that Drop rules find the connection of
+// HTTP requests.
+func (f *Faults) ConnContext(ctx context.Context, c net.Conn) context.Context {
+	if fc, ok := c.(*faultConn); ok {
+		return context.WithValue(ctx, faultConnKey{}, fc)
+	}
+	return ctx
+}
+
+type faultConnKey struct{}
+
+// errDropped is returned by calls whose connection was dropped. The client
+// does not see it, since the connection is gone.
+var errDropped = status.Error(codes.Unavailable, "connection dropped")
+
+// inject applies the rules firing on a call to method. It reports whether
+// the connection of the call must be dropped.
+func (f *Faults) inject(ctx context.Context, method string) (bool, error) {
+	delay, fault := f.fire(method)
+	if delay > 0 {
+		t := time.NewTimer(delay)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return false, status.FromContextError(ctx.Err()).Err()
+		}
+	}
+	if fault == nil {
+		return false, nil
+	}
+	if fault.Drop {
+		return true, nil
+	}
+	msg := fault.Message
+	if msg == "" {
+		msg = "injected fault"
+	}
+	st := status.New(fault.Code, msg)
+	if fault.RetryDelay > 0 {
+		if withInfo, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(fault.RetryDelay)}); err == nil {
+			st = withInfo
+		}
+	}
+	return false, st.Err()
+}
+
+// fire counts a call to method against the rules and returns the delay to
+// apply and the rule failing the call, if any.
+func (f *Faults) fire(method string) (time.Duration, *faultRule) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var delay time.Duration
+	var fault *faultRule
+	for _, r := range f.rules {
+		if !matchesMethod(r.Method, method) {
+			continue
+		}
+		r.calls++
+		if !f.fires(r) {
+			continue
+		}
+		r.fired++
+		delay += r.Latency
+		if r.Jitter > 0 {
+			delay += time.Duration(f.rand.Int63n(int64(r.Jitter)))
+		}
+		if fault == nil && (r.Code != codes.OK || r.Drop) {
+			fault = r
+		}
+	}
+	return delay, fault
+}
+
+// fires reports whether r fires on its latest call. It must be called with
+// f.mu held.
+func (f *Faults) fires(r *faultRule) bool {
+	if r.Times > 0 && r.fired >= r.Times {
+		return false
+	}
+	if len(r.Calls) > 0 {
+		found := false
+		for _, n := range r.Calls {
+			if n == r.calls {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if r.Probability > 0 && f.rand.Float64() >= r.Probability {
+		return false
+	}
+	return true
+}
+
+func matchesMethod(pattern, method string) bool {
+	if pattern == "" || pattern == method {
+		return true
+	}
+	return !strings.Contains(pattern, "/") && strings.HasSuffix(method, "/"+pattern)
+}
+
+// dropConn closes the connection of the call with ctx, found through the
+// context of HTTP requests or the peer of gRPC calls.
+func (f *Faults) dropConn(ctx context.Context) {
+	c, ok := ctx.Value(faultConnKey{}).(*faultConn)
+	if !ok {
+		p, ok := peer.FromContext(ctx)
+		if !ok {
+			return
+		}
+		f.mu.Lock()
+		c = f.conns[p.Addr]
+		f.mu.Unlock()
+	}
+	if c != nil {
+		c.Close()
+	}
+}
+
+type faultListener struct {
+	net.Listener
+	faults *Faults
+}
+
+func (l *faultListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	fc := &faultConn{Conn: c, faults: l.faults, addr: &faultAddr{c.RemoteAddr()}}
+	l.faults.mu.Lock()
+	l.faults.conns[fc.addr] = fc
+	l.faults.mu.Unlock()
+	return fc, nil
+}
+
+// faultConn is a connection accepted by a faultListener. Its remote address
+// is unique to it, so that it can be found from the peer of a call.
+type faultConn struct {
+	net.Conn
+	faults *Faults
+	addr   *faultAddr
+}
+
+func (c *faultConn) RemoteAddr() net.Addr {
+	return c.addr
+}
+
+func (c *faultConn) Close() error {
+	c.faults.mu.Lock()
+	delete(c.faults.conns, c.addr)
+	c.faults.mu.Unlock()
+	return c.Conn.Close()
+}
+
+// faultAddr wraps the remote address of a connection. Each connection gets
+// its own faultAddr, even when the underlying addresses are equal, as they
+// are for in-process connections.
+type faultAddr struct {
+	net.Addr
+}
@@ -0,0 +1,183 @@
+package meterustest_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/elliot14A/meterus-go/meterustest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const ingestMethod = "/meterus.meter.v1.MeteringService/Ingest"
+
+// failures makes n unary calls to method through the faults and reports
+// which of them failed.
+func failures(f *meterustest.Faults, method string, n int) []bool {
+	intercept := f.UnaryServerInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: method}
+	handler := func(context.Context, any) (any, error) { return nil, nil }
+	failed := make([]bool, n)
+	for i := range failed {
+		_, err := intercept(context.Background(), nil, info, handler)
+		failed[i] = err != nil
+	}
+	return failed
+}
+
+func TestFaultsProbabilityIsSeeded(t *testing.T) {
+	run := func(seed int64) []bool {
+		f := meterustest.NewFaults(seed)
+		f.Add(meterustest.FaultRule{Code: codes.Unavailable, Probability: 0.5})
+		return failures(f, ingestMethod, 100)
+	}
+	first := run(7)
+	assert.Equal(t, first, run(7), "the same seed must fail the same calls")
+	assert.NotEqual(t, first, run(8))
+	n := 0
+	for _, failed := range first {
+		if failed {
+			n++
+		}
+	}
+	assert.InDelta(t, 50, n, 20, "about half of the calls must fail")
+}
+
+func TestFaultsCallsAndTimes(t *testing.T) {
+	f := meterustest.NewFaults(1)
+	f.Add(meterustest.FaultRule{Code: codes.Unavailable, Calls: []int{2, 4}})
+	assert.Equal(t, []bool{false, true, false, true, false}, failures(f, ingestMethod, 5))
+
+	f.Reset()
+	f.Add(meterustest.FaultRule{Code: codes.Unavailable, Times: 2})
+	assert.Equal(t, []bool{true, true, false, false}, failures(f, ingestMethod, 4))
+
+	f.Reset()
+	f.Add(meterustest.FaultRule{Code: codes.Unavailable, Calls: []int{2, 3, 4}, Times: 2})
+	assert.Equal(t, []bool{false, true, true, false}, failures(f, ingestMethod, 4), "Times must cap the calls a rule fires on")
+
+	f.Reset()
+	f.FailNext("Ingest", codes.Internal, 1)
+	assert.Equal(t, []bool{true, false}, failures(f, ingestMethod, 2))
+}
+
+func TestFaultsLatencyAndJitter(t *testing.T) {
+	const latency, jitter = 20 * time.Millisecond, 30 * time.Millisecond
+	f := meterustest.NewFaults(1)
+	f.Add(meterustest.FaultRule{Latency: latency, Jitter: jitter})
+	intercept := f.UnaryServerInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: ingestMethod}
+	handler := func(context.Context, any) (any, error) { return "ok", nil }
+
+	for i := 0; i < 5; i++ {
+		start := time.Now()
+		resp, err := intercept(context.Background(), nil, info, handler)
+		elapsed := time.Since(start)
+		require.NoError(t, err, "rules without a code must only add latency")
+		assert.Equal(t, "ok", resp)
+		assert.GreaterOrEqual(t, elapsed, latency)
+		assert.Less(t, elapsed, latency+jitter+50*time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	_, err := intercept(ctx, nil, info, handler)
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err), "the delay must end with the call's context")
+}
+
+func TestFaultsMatchMethods(t *testing.T) {
+	tests := []struct {
+		pattern string
+		method  string
+		matches bool
+	}{
+		{"", ingestMethod, true},
+		{ingestMethod, ingestMethod, true},
+		{"Ingest", ingestMethod, true},
+		{"Ingest", "/meterus.meter.v1.MeteringService/BatchIngest", false},
+		{"Ingest", "/meterus.meter.v1.MeteringService/IngestAsync", false},
+		{"MeteringService/Ingest", ingestMethod, false},
+		{"/meterus.meter.v1.MeteringService/ListMeters", ingestMethod, false},
+	}
+	for _, tt := range tests {
+		f := meterustest.NewFaults(1)
+		f.Add(meterustest.FaultRule{Method: tt.pattern, Code: codes.Unavailable})
+		assert.Equal(t, []bool{tt.matches}, failures(f, tt.method, 1), "%q on %s", tt.pattern, tt.method)
+	}
+}
+
+func TestFaultsDropUnaryCalls(t *testing.T) {
+	f := meterustest.NewFaults(1)
+	srv := meterustest.NewServer(meterustest.WithFaults(f))
+	defer srv.Close()
+
+	for _, tt := range []struct {
+		name   string
+		events int
+	}{
+		{name: "grpc", events: 1},
+		{name: "connect", events: 2},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c := srv.Client("key")
+			if tt.name == "connect" {
+				c = srv.ConnectClient("key")
+			}
+			defer c.Close()
+			m := c.NewMeteringService()
+
+			f.Add(meterustest.FaultRule{Method: "Ingest", Drop: true, Times: 1})
+			err := m.Ingest(context.Background(), recorderEvent(t, "evt-"+tt.name, "acme", nil))
+			assert.Equal(t, codes.Unavailable, status.Code(err), "dropped calls must fail")
+			assert.Len(t, srv.Events(), tt.events, "dropped calls must reach the server first")
+
+			_, err = m.ListMeters(context.Background(), 10, 1)
+			assert.NoError(t, err, "the client must reconnect after a drop")
+		})
+	}
+}
+
+// recvStream is a server stream receiving messages without end.
+type recvStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *recvStream) Context() context.Context { return s.ctx }
+func (s *recvStream) RecvMsg(any) error        { return nil }
+
+func TestFaultsDropStreams(t *testing.T) {
+	f := meterustest.NewFaults(1)
+	f.Add(meterustest.FaultRule{Drop: true})
+	bl := bufconn.Listen(1 << 10)
+	lis := f.Listener(bl)
+	defer lis.Close()
+	dialed := make(chan net.Conn, 1)
+	go func() {
+		c, err := bl.Dial()
+		assert.NoError(t, err)
+		dialed <- c
+	}()
+	conn, err := lis.Accept()
+	require.NoError(t, err)
+	client := <-dialed
+	defer client.Close()
+
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: conn.RemoteAddr()})
+	intercept := f.StreamServerInterceptor()
+	err = intercept(nil, &recvStream{ctx: ctx}, &grpc.StreamServerInfo{FullMethod: ingestMethod}, func(_ any, ss grpc.ServerStream) error {
+		require.NoError(t, ss.RecvMsg(nil), "the first message must be received")
+		return ss.RecvMsg(nil)
+	})
+	assert.Equal(t, codes.Unavailable, status.Code(err), "the stream must fail after its first message")
+	_, err = client.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF, "the connection of the stream must be closed")
+}
@@ -0,0 +1,315 @@
+package meterustest
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	meter "github.com/elliot14A/meterus-go/meters/v1"
+	validation "github.com/elliot14A/meterus-go/validation/v1"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+// EventFilter selects recorded events. Its description is used in assertion
+// failure messages.
+type EventFilter struct {
+	desc  string
+	match func(*meter.CloudEvent) bool
+}
+
+// Where returns a filter matching the events fn reports true for.
+func Where(desc string, fn func(*meter.CloudEvent) bool) EventFilter {
+	return EventFilter{desc: desc, match: fn}
+}
+
+// OfType matches events of the given type.
+func OfType(eventType string) EventFilter {
+	return Where(fmt.Sprintf("type=%q", eventType), func(e *meter.CloudEvent) bool {
+		return e.Type == eventType
+	})
+}
+
+// ForSubject matches events of the given subject.
+func ForSubject(subject string) EventFilter {
+	return Where(fmt.Sprintf("subject=%q", subject), func(e *meter.CloudEvent) bool {
+		return e.Subject == subject
+	})
+}
+
+// Between matches events dated in [from, to).
+func Between(from, to time.Time) EventFilter {
+	desc := fmt.Sprintf("time in [%s, %s)", from.Format(time.RFC3339), to.Format(time.RFC3339))
+	return Where(desc, func(e *meter.CloudEvent) bool {
+		t := e.Time.AsTime()
+		return !t.Before(from) && t.Before(to)
+	})
+}
+
+// WithData matches events whose data property at the dotted path equals
+// value, compared after conversion to JSON types, so that 500 matches a
+// number property holding 500.
+func WithData(path string, value any) EventFilter {
+	want, err := structpb.NewValue(value)
+	if err != nil {
+		panic(fmt.Sprintf("meterustest: invalid data value %v: %v", value, err))
+	}
+	return DataWhere(fmt.Sprintf("data.%s=%v", path, value), path, func(v any) bool {
+		return reflect.DeepEqual(v, want.AsInterface())
+	})
+}
+
+// DataWhere matches events having a data property at the dotted path for
+// which fn reports true. The property is passed as a JSON value: nil, bool,
+// float64, string, []any or map[string]any.
+func DataWhere(desc, path string, fn func(v any) bool) EventFilter {
+	return Where(desc, func(e *meter.CloudEvent) bool {
+		v, ok := dataValue(e.Data, path)
+		return ok && fn(v)
+	})
+}
+
+func describe(filters []EventFilter) string {
+	if len(filters) == 0 {
+		return "any event"
+	}
+	descs := make([]string, len(filters))
+	for i, f := range filters {
+		descs[i] = f.desc
+	}
+	return strings.Join(descs, " ")
+}
+
+// Recorder records ingested events for assertions. A Server records the
+// events it stores in its Recorder; a standalone Recorder can observe any
+// gRPC server through UnaryServerInterceptor.
+type Recorder struct {
+	mu      sync.Mutex
+	events  []*meter.CloudEvent
+	changed chan struct{}
+}
+
+// NewRecorder returns an empty Recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{changed: make(chan struct{})}
+}
+
+// Recorder returns the recorder of the events stored by the server.
+func (s *Server) Recorder() *Recorder {
+	return s.recorder
+}
+
+// Record records a copy of event.
+func (r *Recorder) Record(event *meter.CloudEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, proto.Clone(event).(*meter.CloudEvent))
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+// Reset forgets all recorded events. Calls to WaitFor in progress then count
+// only the events recorded after the Reset.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = nil
+}
+
+// Events returns copies of the recorded events matching all filters, in the
+// order they were recorded.
+func (r *Recorder) Events(filters ...EventFilter) []*meter.CloudEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.matching(filters)
+}
+
+// Count returns how many recorded events match all filters.
+func (r *Recorder) Count(filters ...EventFilter) int {
+	return len(r.Events(filters...))
+}
+
+func (r *Recorder) matching(filters []EventFilter) []*meter.CloudEvent {
+	var events []*meter.CloudEvent
+next:
+	for _, e := range r.events {
+		for _, f := range filters {
+			if !f.match(e) {
+				continue next
+			}
+		}
+		events = append(events, proto.Clone(e).(*meter.CloudEvent))
+	}
+	return events
+}
+
+// WaitFor waits until at least n recorded events match all filters and
+// returns them, or returns the events matching so far and ctx.Err() when ctx
+// is done first. Events forgotten by Reset do not count, even if they were
+// recorded after WaitFor was called.
+func (r *Recorder) WaitFor(ctx context.Context, n int, filters ...EventFilter) ([]*meter.CloudEvent, error) {
+	for {
+		r.mu.Lock()
+		events := r.matching(filters)
+		changed := r.changed
+		r.mu.Unlock()
+		if len(events) >= n {
+			return events, nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return events, ctx.Err()
+		}
+	}
+}
+
+// UnaryServerInterceptor returns an interceptor recording the events of
+// successful Ingest calls and of ValidateAndMeter calls with a valid key.
+// Like Meterus, it bills ValidateAndMeter events without a subject to the
+// subject of the key.
+func (r *Recorder) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		resp, err := handler(ctx, req)
+		if err != nil {
+			return resp, err
+		}
+		switch req := req.(type) {
+		case *meter.CloudEvent:
+			r.Record(req)
+		case *validation.ValidateAndMeterRequest:
+			res, ok := resp.(*validation.ValidateApiKeyResponse)
+			if !ok || !res.IsValid || req.Event == nil {
+				break
+			}
+			event := req.Event
+			if event.Subject == "" {
+				event = proto.Clone(event).(*meter.CloudEvent)
+				event.Subject = res.Metadata.GetSubject()
+			}
+			r.Record(event)
+		}
+		return resp, err
+	}
+}
+
+// AssertCount asserts that exactly want recorded events match all filters.
+// On failure it lists the recorded events.
+func (r *Recorder) AssertCount(t assert.TestingT, want int, filters ...EventFilter) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+	got := r.Count(filters...)
+	if got == want {
+		return true
+	}
+	return assert.Fail(t, fmt.Sprintf("expected %d events matching %s, got %d", want, describe(filters), got), r.dump())
+}
+
+// AssertNone asserts that no recorded event matches all filters.
+func (r *Recorder) AssertNone(t assert.TestingT, filters ...EventFilter) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+	return r.AssertCount(t, 0, filters...)
+}
+
+// AssertEventually asserts that at least want recorded events match all
+// filters within timeout, for events ingested asynchronously.
+func (r *Recorder) AssertEventually(t assert.TestingT, want int, timeout time.Duration, filters ...EventFilter) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	events, err := r.WaitFor(ctx, want, filters...)
+	if err == nil {
+		return true
+	}
+	return assert.Fail(t, fmt.Sprintf("expected %d events matching %s within %s, got %d", want, describe(filters), timeout, len(events)), r.dump())
+}
+
+// AssertEvents asserts that the recorded events matching all filters equal
+// want, in order. Fields left empty in a wanted event, such as Id or Time,
+// are not compared. On failure it prints a diff of the events as JSON.
+func (r *Recorder) AssertEvents(t assert.TestingT, want []*meter.CloudEvent, filters ...EventFilter) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+	got := r.Events(filters...)
+	for i := range got {
+		if i < len(want) {
+			got[i] = mask(got[i], want[i])
+		}
+	}
+	return assert.Equal(t, format(want), format(got), "events matching %s", describe(filters))
+}
+
+// mask clears the fields of got that are empty in want.
+func mask(got, want *meter.CloudEvent) *meter.CloudEvent {
+	if want.Id == "" {
+		got.Id = ""
+	}
+	if want.Source == "" {
+		got.Source = ""
+	}
+	if want.SpecVersion == "" {
+		got.SpecVersion = ""
+	}
+	if want.Type == "" {
+		got.Type = ""
+	}
+	if want.Time == nil {
+		got.Time = nil
+	}
+	if want.Subject == "" {
+		got.Subject = ""
+	}
+	if want.Data == nil {
+		got.Data = nil
+	}
+	return got
+}
+
+func format(events []*meter.CloudEvent) []string {
+	out := make([]string, len(events))
+	opts := protojson.MarshalOptions{Multiline: true, Indent: "  "}
+	for i, e := range events {
+		out[i] = opts.Format(e)
+	}
+	return out
+}
+
+func (r *Recorder) dump() string {
+	events := r.Events()
+	if len(events) == 0 {
+		return "no events were recorded"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d events were recorded:", len(events))
+	for _, e := range events {
+		fmt.Fprintf(&b, "\n  %s", protojson.MarshalOptions{}.Format(e))
+	}
+	return b.String()
+}
+
+// dataValue looks up a dotted property path in event data.
+func dataValue(data *structpb.Struct, path string) (any, bool) {
+	var v any = data.AsMap()
+	for _, part := range strings.Split(path, ".") {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if v, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
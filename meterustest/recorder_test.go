@@ -0,0 +1,150 @@
+package meterustest_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/elliot14A/meterus-go/client"
+	meter "github.com/elliot14A/meterus-go/meters/v1"
+	"github.com/elliot14A/meterus-go/meterustest"
+	validation "github.com/elliot14A/meterus-go/validation/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// failureRecorder is an assert.TestingT recording failures instead of
+// failing the test.
+type failureRecorder struct {
+	failures []string
+}
+
+func (f *failureRecorder) Errorf(format string, args ...any) {
+	f.failures = append(f.failures, fmt.Sprintf(format, args...))
+}
+
+func recorderEvent(t *testing.T, id, subject string, data map[string]any) *meter.CloudEvent {
+	t.Helper()
+	event, err := client.NewCloudEvent(id, "recorder-test", "1.0", "request", time.Now(), subject, data)
+	require.NoError(t, err)
+	return event
+}
+
+func TestRecorderWithData(t *testing.T) {
+	r := meterustest.NewRecorder()
+	r.Record(recorderEvent(t, "evt-1", "acme", map[string]any{
+		"tokens": 500,
+		"model":  map[string]any{"name": "gpt-4"},
+		"cached": true,
+	}))
+
+	for _, value := range []any{500, int32(500), int64(500), uint(500), 500.0, float32(500)} {
+		assert.Equal(t, 1, r.Count(meterustest.WithData("tokens", value)), "%T must match a number property", value)
+	}
+	assert.Zero(t, r.Count(meterustest.WithData("tokens", "500")), "strings must not match numbers")
+	assert.Zero(t, r.Count(meterustest.WithData("tokens", 501)))
+	assert.Equal(t, 1, r.Count(meterustest.WithData("model.name", "gpt-4")))
+	assert.Equal(t, 1, r.Count(meterustest.WithData("cached", true)))
+	assert.Zero(t, r.Count(meterustest.WithData("model.version", "1")))
+	assert.Zero(t, r.Count(meterustest.WithData("tokens.count", 500)))
+	assert.Panics(t, func() { meterustest.WithData("tokens", make(chan int)) })
+}
+
+func TestRecorderAssertEventsMasksEmptyFields(t *testing.T) {
+	r := meterustest.NewRecorder()
+	r.Record(recorderEvent(t, "evt-1", "acme", map[string]any{"tokens": 1}))
+	r.Record(recorderEvent(t, "evt-2", "globex", map[string]any{"tokens": 2}))
+
+	assert.True(t, r.AssertEvents(t, []*meter.CloudEvent{
+		{Subject: "acme"},
+		{Subject: "globex", Type: "request"},
+	}), "fields left empty must not be compared")
+	assert.True(t, r.AssertEvents(t, []*meter.CloudEvent{{Id: "evt-2"}}, meterustest.ForSubject("globex")))
+
+	ft := &failureRecorder{}
+	assert.False(t, r.AssertEvents(ft, []*meter.CloudEvent{{Subject: "globex"}, {Subject: "acme"}}), "events must match in order")
+	assert.False(t, r.AssertEvents(ft, []*meter.CloudEvent{{Subject: "acme"}}), "unwanted events must fail the assertion")
+	assert.False(t, r.AssertEvents(ft, []*meter.CloudEvent{recorderEvent(t, "evt-1", "acme", map[string]any{"tokens": 3})}, meterustest.ForSubject("acme")))
+	assert.Len(t, ft.failures, 3)
+}
+
+func TestRecorderWaitFor(t *testing.T) {
+	r := meterustest.NewRecorder()
+	ctx := context.Background()
+
+	done := make(chan []*meter.CloudEvent)
+	go func() {
+		events, err := r.WaitFor(ctx, 2, meterustest.ForSubject("acme"))
+		assert.NoError(t, err)
+		done <- events
+	}()
+	r.Record(recorderEvent(t, "evt-1", "acme", nil))
+	r.Record(recorderEvent(t, "evt-2", "globex", nil))
+	r.Record(recorderEvent(t, "evt-3", "acme", nil))
+	select {
+	case events := <-done:
+		require.Len(t, events, 2)
+		assert.Equal(t, "evt-1", events[0].Id)
+		assert.Equal(t, "evt-3", events[1].Id)
+	case <-time.After(time.Second):
+		t.Fatal("WaitFor must return once enough events are recorded")
+	}
+
+	cctx, cancel := context.WithCancel(ctx)
+	errc := make(chan error)
+	go func() {
+		events, err := r.WaitFor(cctx, 3, meterustest.ForSubject("acme"))
+		assert.Len(t, events, 2, "WaitFor must return the events matching so far")
+		errc <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-errc:
+		assert.ErrorIs(t, err, context.Canceled)
+	case <-time.After(time.Second):
+		t.Fatal("WaitFor must return when its context is done")
+	}
+
+	r.Reset()
+	tctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	events, err := r.WaitFor(tctx, 1)
+	assert.ErrorIs(t, err, context.DeadlineExceeded, "events forgotten by Reset must not count")
+	assert.Empty(t, events)
+}
+
+func TestRecorderUnaryServerInterceptor(t *testing.T) {
+	r := meterustest.NewRecorder()
+	intercept := r.UnaryServerInterceptor()
+	ctx := context.Background()
+	reply := func(resp any, err error) grpc.UnaryHandler {
+		return func(context.Context, any) (any, error) { return resp, err }
+	}
+	info := &grpc.UnaryServerInfo{}
+
+	_, err := intercept(ctx, recorderEvent(t, "evt-1", "acme", nil), info, reply(nil, nil))
+	require.NoError(t, err)
+	_, err = intercept(ctx, recorderEvent(t, "evt-2", "acme", nil), info, reply(nil, status.Error(codes.Unavailable, "down")))
+	require.Error(t, err)
+
+	valid := &validation.ValidateApiKeyResponse{IsValid: true, Metadata: &validation.Metadata{Subject: "globex"}}
+	req := &validation.ValidateAndMeterRequest{Event: recorderEvent(t, "evt-3", "", nil)}
+	_, err = intercept(ctx, req, info, reply(valid, nil))
+	require.NoError(t, err)
+	assert.Empty(t, req.Event.Subject, "the request must not be modified")
+	_, err = intercept(ctx, &validation.ValidateAndMeterRequest{Event: recorderEvent(t, "evt-4", "initech", nil)}, info, reply(valid, nil))
+	require.NoError(t, err)
+	_, err = intercept(ctx, &validation.ValidateAndMeterRequest{Event: recorderEvent(t, "evt-5", "", nil)}, info, reply(&validation.ValidateApiKeyResponse{}, nil))
+	require.NoError(t, err)
+
+	r.AssertEvents(t, []*meter.CloudEvent{
+		{Id: "evt-1", Subject: "acme"},
+		{Id: "evt-3", Subject: "globex"},
+		{Id: "evt-4", Subject: "initech"},
+	})
+}
@@ -0,0 +1,203 @@
+// Package meterustest provides an in-memory Meterus server for tests.
+//
+// The server implements the metering, subject and validation services on top
+// of in-memory state and serves them over an in-process connection:
+//
+//	srv := meterustest.NewServer()
+//	defer srv.Close()
+//
+//	c := srv.Client("test-api-key")
+//	err := c.NewMeteringService().Ingest(ctx, event)
+//
+// ConnectClient returns a client using the Connect protocol instead of gRPC,
+// and ServeLoopback serves gRPC on a loopback port for clients that dial real
+// addresses.
+package meterustest
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/elliot14A/meterus-go/client"
+	"github.com/elliot14A/meterus-go/connect"
+	"github.com/elliot14A/meterus-go/internal/server"
+	meter "github.com/elliot14A/meterus-go/meters/v1"
+	subject "github.com/elliot14A/meterus-go/subject/v1"
+	validation "github.com/elliot14A/meterus-go/validation/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// Server is an in-memory Meterus server. It stores events, meters, subjects
+// and API keys and computes QueryMeter results from the stored events.
+type Server struct {
+	lis        *bufconn.Listener
+	grpc       *grpc.Server
+	connectLis *bufconn.Listener
+	connect    *connect.Handler
+	http       *http.Server
+	now        func() time.Time
+	backend    *server.Backend
+	recorder   *Recorder
+	faults     *Faults
+	grpcOpts   []grpc.ServerOption
+}
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithClock sets the clock the server uses to stamp events, meters and API
+// keys, and to expire API keys. It defaults to time.Now.
+func WithClock(now func() time.Time) Option {
+	return func(s *Server) {
+		s.now = now
+	}
+}
+
+// WithServerOptions passes options to the underlying gRPC server, such as
+// interceptors.
+func WithServerOptions(opts ...grpc.ServerOption) Option {
+	return func(s *Server) {
+		s.grpcOpts = append(s.grpcOpts, opts...)
+	}
+}
+
+// NewServer starts a Server. It must be closed when no longer used.
+func NewServer(opts ...Option) *Server {
+	s := &Server{
+		lis:        bufconn.Listen(1 << 20),
+		connectLis: bufconn.Listen(1 << 20),
+		now:        time.Now,
+		recorder:   NewRecorder(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	backend, err := server.New(server.Options{Clock: s.now, OnIngest: s.recorder.Record})
+	if err != nil {
+		// Loading an in-memory backend cannot fail.
+		panic(err)
+	}
+	s.backend = backend
+
+	var lis, connectLis net.Listener = s.lis, s.connectLis
+	var connectOpts []connect.HandlerOption
+	if s.faults != nil {
+		lis = s.faults.Listener(lis)
+		connectLis = s.faults.Listener(connectLis)
+		s.grpcOpts = append(s.grpcOpts,
+			grpc.ChainUnaryInterceptor(s.faults.UnaryServerInterceptor()),
+			grpc.ChainStreamInterceptor(s.faults.StreamServerInterceptor()))
+		connectOpts = append(connectOpts, connect.WithInterceptors(s.faults.UnaryServerInterceptor()))
+	}
+	s.grpc = grpc.NewServer(s.grpcOpts...)
+	s.backend.Register(s.grpc)
+	go s.grpc.Serve(lis)
+
+	s.connect = connect.NewHandler(connectOpts...)
+	s.backend.Register(s.connect)
+	s.http = &http.Server{Handler: s.connect}
+	if s.faults != nil {
+		s.http.ConnContext = s.faults.ConnContext
+	}
+	go s.http.Serve(connectLis)
+	return s
+}
+
+// Client returns a client connected to the server that authenticates with
+// apiKey. The caller must close it.
+func (s *Server) Client(apiKey string, opts ...grpc.DialOption) *client.Client {
+	opts = append([]grpc.DialOption{grpc.WithContextDialer(s.dial)}, opts...)
+	c, err := client.NewMeterusClient("passthrough:///meterustest", apiKey, opts...)
+	if err != nil {
+		// NewMeterusClient only fails on invalid options.
+		panic(err)
+	}
+	return c
+}
+
+// ServeLoopback also serves gRPC on a new port of the loopback interface and
+// returns its address, for clients that dial real addresses, such as one
+// created with client.NewBalancedMeterusClient. Close stops serving it.
+func (s *Server) ServeLoopback() string {
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("meterustest: failed to listen on loopback: %v", err))
+	}
+	addr := tcp.Addr().String()
+	var lis net.Listener = tcp
+	if s.faults != nil {
+		lis = s.faults.Listener(lis)
+	}
+	go s.grpc.Serve(lis)
+	return addr
+}
+
+// ConnectClient returns a client connected to the server over the Connect
+// protocol that authenticates with apiKey. The caller must close it. Options
+// given to WithServerOptions do not apply to its calls.
+func (s *Server) ConnectClient(apiKey string, opts ...connect.Option) *client.Client {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return s.connectLis.DialContext(ctx)
+		},
+	}
+	opts = append([]connect.Option{connect.WithHTTPClient(&http.Client{Transport: transport})}, opts...)
+	c, err := client.NewMeterusConnectClient("http://meterustest", apiKey, opts...)
+	if err != nil {
+		// The base URL is valid.
+		panic(err)
+	}
+	return c
+}
+
+// ConnectHandler returns the handler serving the server's services over the
+// Connect protocol, for use with an http.Server or httptest.Server.
+func (s *Server) ConnectHandler() http.Handler {
+	return s.connect
+}
+
+// dial returns a new in-process connection to the server, for use with
+// grpc.WithContextDialer.
+func (s *Server) dial(ctx context.Context, _ string) (net.Conn, error) {
+	return s.lis.DialContext(ctx)
+}
+
+// Close stops the server.
+func (s *Server) Close() {
+	s.grpc.Stop()
+	s.http.Close()
+}
+
+// MeteringServer returns the server's implementation of the metering service.
+func (s *Server) MeteringServer() meter.MeteringServiceServer {
+	return s.backend.MeteringServer()
+}
+
+// SubjectServer returns the server's implementation of the subject service.
+func (s *Server) SubjectServer() subject.SubjectServiceServer {
+	return s.backend.SubjectServer()
+}
+
+// ValidationServer returns the server's implementation of the validation
+// service.
+func (s *Server) ValidationServer() validation.ValidationServiceServer {
+	return s.backend.ValidationServer()
+}
+
+// Events returns copies of the events ingested so far, in ingestion order.
+func (s *Server) Events() []*meter.CloudEvent {
+	return s.backend.Events()
+}
+
+// AddApiKey stores an API key with the given secret, subject and scopes, as if
+// it had been created through CreateApiKey.
+func (s *Server) AddApiKey(secret, subject string, scopes ...string) {
+	if err := s.backend.AddApiKey(secret, subject, scopes...); err != nil {
+		// Storing in memory cannot fail.
+		panic(err)
+	}
+}
@@ -0,0 +1,73 @@
+package meterustest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// Clock is a clock moved by hand, for WithClock and the clock options of
+// the client package.
+type Clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewClock returns a Clock reading start.
+func NewClock(start time.Time) *Clock {
+	return &Clock{now: start}
+}
+
+// Now returns the time of the clock.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// StubConn is a grpc.ClientConnInterface for code taking a connection, such
+// as the FromConn constructors of the client package. It records each
+// unary call under its full method name, with a copy of the request and the
+// outgoing metadata as arguments, and answers it with InvokeFunc if set, or
+// with an empty reply. Streams are not supported.
+type StubConn struct {
+	callLog
+
+	InvokeFunc func(ctx context.Context, method string, req proto.Message) (proto.Message, error)
+}
+
+var _ grpc.ClientConnInterface = (*StubConn)(nil)
+
+func (c *StubConn) Invoke(ctx context.Context, method string, args, reply any, _ ...grpc.CallOption) error {
+	req := args.(proto.Message)
+	md, _ := metadata.FromOutgoingContext(ctx)
+	c.record(method, proto.Clone(req), md.Copy())
+	if c.InvokeFunc == nil {
+		return nil
+	}
+	res, err := c.InvokeFunc(ctx, method, req)
+	if err != nil {
+		return err
+	}
+	if res != nil {
+		proto.Merge(reply.(proto.Message), res)
+	}
+	return nil
+}
+
+func (c *StubConn) NewStream(context.Context, *grpc.StreamDesc, string, ...grpc.CallOption) (grpc.ClientStream, error) {
+	return nil, status.Error(codes.Unimplemented, "meterustest: StubConn does not support streams")
+}
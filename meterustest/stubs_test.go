@@ -0,0 +1,58 @@
+package meterustest_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/elliot14A/meterus-go/client"
+	meter "github.com/elliot14A/meterus-go/meters/v1"
+	"github.com/elliot14A/meterus-go/meterustest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestClock(t *testing.T) {
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	clock := meterustest.NewClock(start)
+	assert.Equal(t, start, clock.Now())
+	clock.Advance(time.Minute)
+	assert.Equal(t, start.Add(time.Minute), clock.Now())
+}
+
+func TestStubConn(t *testing.T) {
+	conn := &meterustest.StubConn{}
+	m := client.NewMeteringServiceFromConn(conn, "key")
+	ctx := context.Background()
+
+	res, err := m.ListMeters(ctx, 10, 1)
+	require.NoError(t, err, "calls must get an empty reply by default")
+	assert.Empty(t, res.Meters)
+
+	conn.InvokeFunc = func(_ context.Context, method string, req proto.Message) (proto.Message, error) {
+		if method == meter.MeteringService_GetMeter_FullMethodName {
+			return &meter.Meter{Slug: req.(*meter.MeterId).MeterIdOrSlug}, nil
+		}
+		return nil, status.Error(codes.NotFound, "no meter")
+	}
+	got, err := m.GetMeter(ctx, "tokens")
+	require.NoError(t, err)
+	assert.Equal(t, "tokens", got.Slug)
+	err = m.DeleteMeter(ctx, "tokens")
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	calls := conn.Calls()
+	require.Len(t, calls, 3)
+	assert.Equal(t, meter.MeteringService_ListMeters_FullMethodName, calls[0].Method)
+	require.Len(t, conn.CallsTo(meter.MeteringService_GetMeter_FullMethodName), 1)
+	req, md := calls[1].Args[0], calls[1].Args[1]
+	assert.True(t, proto.Equal(&meter.MeterId{MeterIdOrSlug: "tokens"}, req.(proto.Message)))
+	assert.Equal(t, []string{"Bearer key"}, md.(metadata.MD).Get("authorization"))
+
+	_, err = conn.NewStream(ctx, nil, meter.MeteringService_GetMeter_FullMethodName)
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+}
@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrEmitterFull is reported through OnError for requests whose event was
+// dropped because the emitter queue was full or the emitter closed.
+var ErrEmitterFull = errors.New("metering emitter queue is full")
+
+// Emitter runs the background work of the metering middleware, resolving
+// subjects and queueing events, on a fixed pool of workers fed by a bounded
+// queue. Work that does not fit in the queue is dropped and counted, so a slow
+// subject lookup never piles up goroutines. An Emitter may be shared by
+// several middlewares.
+type Emitter struct {
+	jobs    chan func()
+	wg      sync.WaitGroup
+	mu      sync.RWMutex
+	closed  bool
+	dropped atomic.Uint64
+}
+
+// NewEmitter starts an Emitter with room for queueSize pending requests served
+// by workers goroutines. Values below 1 default to 1024 and 4. It must be
+// closed to stop its workers.
+func NewEmitter(queueSize, workers int) *Emitter {
+	if queueSize < 1 {
+		queueSize = 1024
+	}
+	if workers < 1 {
+		workers = 4
+	}
+	e := &Emitter{jobs: make(chan func(), queueSize)}
+	for n := 0; n < workers; n++ {
+		e.wg.Add(1)
+		go e.work()
+	}
+	return e
+}
+
+// Dropped returns how many requests were not metered because the queue was
+// full or the emitter closed.
+func (e *Emitter) Dropped() uint64 {
+	return e.dropped.Load()
+}
+
+// Close stops accepting work and waits for the queued work to finish.
+func (e *Emitter) Close() {
+	e.mu.Lock()
+	if e.closed {
+		e.mu.Unlock()
+		return
+	}
+	e.closed = true
+	close(e.jobs)
+	e.mu.Unlock()
+	e.wg.Wait()
+}
+
+// submit queues job without blocking. It reports false if job was dropped.
+func (e *Emitter) submit(job func()) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if !e.closed {
+		select {
+		case e.jobs <- job:
+			return true
+		default:
+		}
+	}
+	e.dropped.Add(1)
+	return false
+}
+
+func (e *Emitter) work() {
+	defer e.wg.Done()
+	for job := range e.jobs {
+		job()
+	}
+}
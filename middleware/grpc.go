@@ -0,0 +1,201 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/elliot14A/meterus-go/client"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCSubjectResolver returns the Meterus subject a call is billed to. The
+// context carries the incoming metadata of the call.
+type GRPCSubjectResolver func(ctx context.Context, fullMethod string) (string, error)
+
+// SubjectFromMetadata resolves the subject from the named incoming metadata key.
+func SubjectFromMetadata(key string) GRPCSubjectResolver {
+	return func(ctx context.Context, _ string) (string, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if values := md.Get(key); len(values) > 0 && values[0] != "" {
+			return values[0], nil
+		}
+		return "", fmt.Errorf("%w: metadata %s is empty", ErrNoSubject, key)
+	}
+}
+
+// CallInfo describes a gRPC call that has been served.
+type CallInfo struct {
+	FullMethod       string
+	Code             codes.Code
+	Duration         time.Duration
+	MessagesReceived int64
+	MessagesSent     int64
+}
+
+// GRPCMeteringConfig configures the gRPC metering interceptors.
+type GRPCMeteringConfig struct {
+	// Ingester receives the events. It is required.
+	Ingester *client.Ingester
+	// Subject resolves the subject of a call. It is required.
+	Subject GRPCSubjectResolver
+	// Emitter runs subject resolution and event construction. It is
+	// required; the caller owns it and closes it once the server has
+	// stopped.
+	Emitter *Emitter
+	// EventType is the type of the emitted events. It defaults to "rpc.call".
+	EventType string
+	// Source is the source of the emitted events. It defaults to "grpc".
+	Source string
+	// Data, if set, returns the event data for a call instead of the default
+	// method, status code, duration and message counts.
+	Data func(info CallInfo) map[string]any
+	// Skip, if set, reports methods that should not be metered.
+	Skip func(fullMethod string) bool
+	// OnError, if set, is called when no event could be emitted for a call.
+	OnError func(fullMethod string, err error)
+}
+
+// setDefaults checks the required fields of cfg, panicking if one is missing,
+// and fills in the defaults of the others.
+func (cfg *GRPCMeteringConfig) setDefaults() {
+	switch {
+	case cfg.Ingester == nil:
+		panic("middleware: GRPCMeteringConfig.Ingester is required")
+	case cfg.Subject == nil:
+		panic("middleware: GRPCMeteringConfig.Subject is required")
+	case cfg.Emitter == nil:
+		panic("middleware: GRPCMeteringConfig.Emitter is required")
+	}
+	if cfg.EventType == "" {
+		cfg.EventType = "rpc.call"
+	}
+	if cfg.Source == "" {
+		cfg.Source = "grpc"
+	}
+	if cfg.Data == nil {
+		cfg.Data = defaultCallData
+	}
+}
+
+// UnaryServerMetering returns an interceptor that emits a Meterus event for
+// every unary call once its handler has returned. Like HTTPMetering, the
+// subject is resolved and the event queued on the emitter in the background.
+// It panics if cfg lacks a required field.
+func UnaryServerMetering(cfg GRPCMeteringConfig) grpc.UnaryServerInterceptor {
+	cfg.setDefaults()
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if cfg.Skip != nil && cfg.Skip(info.FullMethod) {
+			return handler(ctx, req)
+		}
+
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		call := CallInfo{
+			FullMethod:       info.FullMethod,
+			Code:             status.Code(err),
+			Duration:         time.Since(start),
+			MessagesReceived: 1,
+		}
+		if err == nil {
+			call.MessagesSent = 1
+		}
+		submitCall(context.WithoutCancel(ctx), cfg, start, call)
+		return resp, err
+	}
+}
+
+// StreamServerMetering returns an interceptor that emits a Meterus event for
+// every streaming call once its handler has returned, counting the messages
+// received and sent. It panics if cfg lacks a required field.
+func StreamServerMetering(cfg GRPCMeteringConfig) grpc.StreamServerInterceptor {
+	cfg.setDefaults()
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if cfg.Skip != nil && cfg.Skip(info.FullMethod) {
+			return handler(srv, ss)
+		}
+
+		start := time.Now()
+		cs := &countingStream{ServerStream: ss}
+		err := handler(srv, cs)
+		call := CallInfo{
+			FullMethod:       info.FullMethod,
+			Code:             status.Code(err),
+			Duration:         time.Since(start),
+			MessagesReceived: cs.received.Load(),
+			MessagesSent:     cs.sent.Load(),
+		}
+		submitCall(context.WithoutCancel(ss.Context()), cfg, start, call)
+		return err
+	}
+}
+
+// submitCall queues the emission of the event of a call on the emitter.
+func submitCall(ctx context.Context, cfg GRPCMeteringConfig, start time.Time, call CallInfo) {
+	if !cfg.Emitter.submit(func() { emitCall(ctx, cfg, start, call) }) {
+		reportCallError(cfg, call.FullMethod, ErrEmitterFull)
+	}
+}
+
+func emitCall(ctx context.Context, cfg GRPCMeteringConfig, start time.Time, call CallInfo) {
+	subject, err := cfg.Subject(ctx, call.FullMethod)
+	if err != nil {
+		reportCallError(cfg, call.FullMethod, err)
+		return
+	}
+	event, err := client.NewCloudEvent("", cfg.Source, "1.0", cfg.EventType, start, subject, cfg.Data(call))
+	if err != nil {
+		reportCallError(cfg, call.FullMethod, err)
+		return
+	}
+	if !cfg.Ingester.Enqueue(event) {
+		reportCallError(cfg, call.FullMethod, ErrEventDropped)
+	}
+}
+
+func reportCallError(cfg GRPCMeteringConfig, fullMethod string, err error) {
+	if cfg.OnError != nil {
+		cfg.OnError(fullMethod, err)
+	}
+}
+
+func defaultCallData(info CallInfo) map[string]any {
+	service, method, _ := strings.Cut(strings.TrimPrefix(info.FullMethod, "/"), "/")
+	return map[string]any{
+		"full_method":       info.FullMethod,
+		"service":           service,
+		"method":            method,
+		"status_code":       info.Code.String(),
+		"duration_ms":       float64(info.Duration.Microseconds()) / 1000,
+		"messages_received": info.MessagesReceived,
+		"messages_sent":     info.MessagesSent,
+	}
+}
+
+// countingStream counts the messages exchanged on a server stream.
+type countingStream struct {
+	grpc.ServerStream
+	received atomic.Int64
+	sent     atomic.Int64
+}
+
+func (s *countingStream) RecvMsg(m any) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.received.Add(1)
+	}
+	return err
+}
+
+func (s *countingStream) SendMsg(m any) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.sent.Add(1)
+	}
+	return err
+}
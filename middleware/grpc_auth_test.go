@@ -0,0 +1,102 @@
+package middleware_test
+
+import (
+	"context"
+	"testing"
+
+	meter "github.com/elliot14A/meterus-go/meters/v1"
+	"github.com/elliot14A/meterus-go/meterustest"
+	"github.com/elliot14A/meterus-go/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGRPCAuthAndMetering(t *testing.T) {
+	backend, _ := newServer(t)
+	ingester := newClient(t, backend).NewMeteringService().NewIngester()
+	emitter := middleware.NewEmitter(16, 1)
+	keys := authValidator()
+	var errs errorLog
+	auth := middleware.GRPCAuthConfig{
+		Validator: keys,
+		Scopes:    []string{"meters:read"},
+		MethodScopes: map[string][]string{
+			meter.MeteringService_CreateMeter_FullMethodName: {"meters:write"},
+		},
+		Skip: func(fullMethod string) bool {
+			return fullMethod == meter.MeteringService_ListMeterSubjects_FullMethodName
+		},
+		OnError: func(_ string, err error) { errs.add(err) },
+	}
+	metering := middleware.GRPCMeteringConfig{
+		Ingester: ingester,
+		Emitter:  emitter,
+		Subject:  middleware.SubjectFromAuthContext(),
+		Skip: func(fullMethod string) bool {
+			return fullMethod == meter.MeteringService_ListMeterSubjects_FullMethodName
+		},
+	}
+	srv, _ := newServer(t, meterustest.WithServerOptions(grpc.ChainUnaryInterceptor(
+		middleware.UnaryServerAuth(auth),
+		middleware.UnaryServerMetering(metering),
+	)))
+	call := func(apiKey string, fn func(m meteringCalls) error) codes.Code {
+		c := srv.Client(apiKey)
+		defer c.Close()
+		return status.Code(fn(c.NewMeteringService()))
+	}
+	ctx := context.Background()
+	list := func(m meteringCalls) error {
+		_, err := m.ListMeters(ctx, 10, 1)
+		return err
+	}
+
+	assert.Equal(t, codes.OK, call("reader", list))
+	assert.Equal(t, codes.NotFound, call("reader", func(m meteringCalls) error {
+		_, err := m.GetMeter(ctx, "missing")
+		return err
+	}))
+	assert.Equal(t, codes.PermissionDenied, call("reader", func(m meteringCalls) error {
+		_, err := m.CreateMeter(ctx, &meter.CreateMeterRequest{Slug: "requests", Aggregation: meter.Aggregation_AGGREGATION_COUNT, EventType: "request"})
+		return err
+	}))
+	assert.Equal(t, codes.Unauthenticated, call("unknown", list))
+	assert.Equal(t, codes.Unauthenticated, call("", list))
+	assert.Equal(t, codes.Unavailable, call("broken", list))
+	assert.Len(t, errs.errs, 1, "validation failures are reported")
+	assert.Equal(t, codes.OK, call("", func(m meteringCalls) error {
+		_, err := m.ListMeterSubjects(ctx, "missing")
+		if status.Code(err) == codes.NotFound {
+			return nil
+		}
+		return err
+	}), "skipped methods need no key")
+
+	calls := keys.CallsTo("ValidateApiKey")
+	require.NotEmpty(t, calls)
+	assert.Equal(t, []string{"meters:read"}, calls[0].Args[1])
+	assert.Equal(t, []string{"meters:read", "meters:write"}, calls[2].Args[1])
+
+	emitter.Close()
+	require.NoError(t, ingester.Close(ctx))
+	var metered []string
+	for _, e := range backend.Events() {
+		assert.Equal(t, "acme", e.Subject, "the subject comes from the authenticated key")
+		assert.Equal(t, "rpc.call", e.Type)
+		data := eventData(e)
+		metered = append(metered, data["method"].(string)+" "+data["status_code"].(string))
+	}
+	assert.ElementsMatch(t, []string{"ListMeters OK", "GetMeter NotFound"}, metered,
+		"calls are metered whatever their code, rejected calls are not")
+}
+
+// meteringCalls are the metering methods the tests call.
+type meteringCalls interface {
+	ListMeters(ctx context.Context, limit, page int32) (*meter.ListMetersResponse, error)
+	GetMeter(ctx context.Context, meterIDOrSlug string) (*meter.Meter, error)
+	CreateMeter(ctx context.Context, req *meter.CreateMeterRequest) (*meter.Meter, error)
+	ListMeterSubjects(ctx context.Context, meterIDOrSlug string) (*meter.ListMeterSubjectsResponse, error)
+}
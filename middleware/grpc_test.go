@@ -0,0 +1,147 @@
+package middleware_test
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	meter "github.com/elliot14A/meterus-go/meters/v1"
+	"github.com/elliot14A/meterus-go/meterustest"
+	"github.com/elliot14A/meterus-go/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestSubjectFromMetadata(t *testing.T) {
+	backend, _ := newServer(t)
+	ingester := newClient(t, backend).NewMeteringService().NewIngester()
+	emitter := middleware.NewEmitter(16, 1)
+	var errs errorLog
+	srv, _ := newServer(t, meterustest.WithServerOptions(grpc.ChainUnaryInterceptor(
+		middleware.UnaryServerMetering(middleware.GRPCMeteringConfig{
+			Ingester: ingester,
+			Emitter:  emitter,
+			Subject:  middleware.SubjectFromMetadata("x-customer"),
+			OnError:  func(_ string, err error) { errs.add(err) },
+			Data: func(info middleware.CallInfo) map[string]any {
+				return map[string]any{"method": info.FullMethod, "received": info.MessagesReceived, "sent": info.MessagesSent}
+			},
+		}),
+	)))
+	c := newClient(t, srv)
+	m := c.NewMeteringService()
+
+	_, err := m.ListMeters(metadata.AppendToOutgoingContext(context.Background(), "x-customer", "acme"), 10, 1)
+	require.NoError(t, err)
+	_, err = m.ListMeters(context.Background(), 10, 1)
+	require.NoError(t, err)
+	emitter.Close()
+	require.NoError(t, ingester.Close(context.Background()))
+
+	require.Len(t, backend.Events(), 1)
+	e := backend.Events()[0]
+	assert.Equal(t, "acme", e.Subject)
+	assert.Equal(t, map[string]any{"method": meter.MeteringService_ListMeters_FullMethodName, "received": float64(1), "sent": float64(1)}, eventData(e))
+	assert.Equal(t, 1, errs.count(middleware.ErrNoSubject))
+}
+
+// fakeStream is a server stream receiving a fixed number of messages.
+type fakeStream struct {
+	grpc.ServerStream
+	ctx     context.Context
+	pending int
+}
+
+func (s *fakeStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *fakeStream) RecvMsg(any) error {
+	if s.pending == 0 {
+		return io.EOF
+	}
+	s.pending--
+	return nil
+}
+
+func (s *fakeStream) SendMsg(any) error {
+	return nil
+}
+
+func TestStreamServerMeteringCountsMessages(t *testing.T) {
+	backend, _ := newServer(t)
+	ingester := newClient(t, backend).NewMeteringService().NewIngester()
+	emitter := middleware.NewEmitter(16, 1)
+	interceptor := middleware.StreamServerMetering(middleware.GRPCMeteringConfig{
+		Ingester: ingester,
+		Emitter:  emitter,
+		Subject:  middleware.SubjectFromMetadata("x-customer"),
+	})
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-customer", "acme"))
+	info := &grpc.StreamServerInfo{FullMethod: "/test.v1.ChatService/Chat", IsClientStream: true, IsServerStream: true}
+
+	// The handler echoes every message and then sends a summary.
+	err := interceptor(nil, &fakeStream{ctx: ctx, pending: 3}, info, func(_ any, ss grpc.ServerStream) error {
+		for {
+			if err := ss.RecvMsg(nil); err == io.EOF {
+				break
+			}
+			if err := ss.SendMsg(nil); err != nil {
+				return err
+			}
+		}
+		return ss.SendMsg(nil)
+	})
+	require.NoError(t, err)
+	err = interceptor(nil, &fakeStream{ctx: ctx, pending: 1}, info, func(_ any, ss grpc.ServerStream) error {
+		ss.RecvMsg(nil)
+		return status.Error(codes.Aborted, "conversation over")
+	})
+	assert.Equal(t, codes.Aborted, status.Code(err))
+	emitter.Close()
+	require.NoError(t, ingester.Close(context.Background()))
+
+	require.Len(t, backend.Events(), 2)
+	byCode := make(map[string]map[string]any)
+	for _, e := range backend.Events() {
+		assert.Equal(t, "acme", e.Subject)
+		assert.Equal(t, "rpc.call", e.Type)
+		data := eventData(e)
+		byCode[data["status_code"].(string)] = data
+	}
+	ok := byCode["OK"]
+	require.NotNil(t, ok)
+	assert.Equal(t, "test.v1.ChatService", ok["service"])
+	assert.Equal(t, "Chat", ok["method"])
+	assert.Equal(t, float64(3), ok["messages_received"])
+	assert.Equal(t, float64(4), ok["messages_sent"])
+	aborted := byCode["Aborted"]
+	require.NotNil(t, aborted)
+	assert.Equal(t, float64(1), aborted["messages_received"])
+	assert.Equal(t, float64(0), aborted["messages_sent"])
+}
+
+func TestGRPCMeteringRequiresConfig(t *testing.T) {
+	backend, _ := newServer(t)
+	ingester := newClient(t, backend).NewMeteringService().NewIngester()
+	emitter := middleware.NewEmitter(16, 1)
+	defer emitter.Close()
+	subject := middleware.SubjectFromMetadata("x-customer")
+
+	for _, tt := range []struct {
+		cfg   middleware.GRPCMeteringConfig
+		field string
+	}{
+		{middleware.GRPCMeteringConfig{Subject: subject, Emitter: emitter}, "Ingester"},
+		{middleware.GRPCMeteringConfig{Ingester: ingester, Emitter: emitter}, "Subject"},
+		{middleware.GRPCMeteringConfig{Ingester: ingester, Subject: subject}, "Emitter"},
+	} {
+		msg := "middleware: GRPCMeteringConfig." + tt.field + " is required"
+		assert.PanicsWithValue(t, msg, func() { middleware.UnaryServerMetering(tt.cfg) })
+		assert.PanicsWithValue(t, msg, func() { middleware.StreamServerMetering(tt.cfg) })
+	}
+}
@@ -0,0 +1,58 @@
+package middleware_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/elliot14A/meterus-go/client"
+	meter "github.com/elliot14A/meterus-go/meters/v1"
+	"github.com/elliot14A/meterus-go/meterustest"
+	"google.golang.org/grpc"
+)
+
+// newServer starts a test server closed with the test, and returns it with
+// the faults it injects.
+func newServer(t *testing.T, opts ...meterustest.Option) (*meterustest.Server, *meterustest.Faults) {
+	t.Helper()
+	faults := meterustest.NewFaults(1)
+	srv := meterustest.NewServer(append([]meterustest.Option{meterustest.WithFaults(faults)}, opts...)...)
+	t.Cleanup(srv.Close)
+	return srv, faults
+}
+
+// newClient returns a client of srv closed with the test.
+func newClient(t *testing.T, srv *meterustest.Server, opts ...grpc.DialOption) *client.Client {
+	t.Helper()
+	c := srv.Client("key", opts...)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// errorLog collects the errors reported through OnError.
+type errorLog struct {
+	mu   sync.Mutex
+	errs []error
+}
+
+func (l *errorLog) add(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.errs = append(l.errs, err)
+}
+
+func (l *errorLog) count(target error) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := 0
+	for _, err := range l.errs {
+		if errors.Is(err, target) {
+			n++
+		}
+	}
+	return n
+}
+
+func eventData(e *meter.CloudEvent) map[string]any {
+	return e.GetData().AsMap()
+}
@@ -0,0 +1,241 @@
+// Package middleware provides net/http and gRPC server middleware that meters
+// requests with Meterus.
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/elliot14A/meterus-go/client"
+)
+
+var (
+	// ErrNoSubject is returned by subject extractors when a request does
+	// not identify a subject.
+	ErrNoSubject = errors.New("request has no subject")
+	// ErrEventDropped is reported through OnError for requests whose event
+	// the ingester did not accept because its queue was full or it was
+	// closed.
+	ErrEventDropped = errors.New("event dropped by ingester")
+)
+
+// SubjectExtractor returns the Meterus subject a request is billed to.
+type SubjectExtractor func(r *http.Request) (string, error)
+
+// SubjectFromHeader extracts the subject from the named request header.
+func SubjectFromHeader(name string) SubjectExtractor {
+	return func(r *http.Request) (string, error) {
+		subject := r.Header.Get(name)
+		if subject == "" {
+			return "", fmt.Errorf("%w: header %s is empty", ErrNoSubject, name)
+		}
+		return subject, nil
+	}
+}
+
+// SubjectFromAPIKey extracts the Bearer token from the Authorization header and
+// looks up the subject it belongs to with the validator.
+func SubjectFromAPIKey(v Validator) SubjectExtractor {
+	return func(r *http.Request) (string, error) {
+		apiKey, ok := BearerToken(r)
+		if !ok {
+			return "", fmt.Errorf("%w: missing bearer token", ErrNoSubject)
+		}
+		res, err := v.ValidateApiKey(r.Context(), apiKey, nil)
+		if err != nil {
+			return "", err
+		}
+		if !res.Valid || res.Subject == "" {
+			return "", fmt.Errorf("%w: api key has no subject", ErrNoSubject)
+		}
+		return res.Subject, nil
+	}
+}
+
+// BearerToken returns the token of a "Bearer" Authorization header.
+func BearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return token, true
+}
+
+// RequestInfo describes a request that has been served.
+type RequestInfo struct {
+	Route         string
+	Method        string
+	StatusCode    int
+	Latency       time.Duration
+	ResponseBytes int64
+}
+
+// HTTPMeteringConfig configures the HTTP metering middleware.
+type HTTPMeteringConfig struct {
+	// Ingester receives the events. It is required.
+	Ingester *client.Ingester
+	// Subject extracts the subject of a request. It is required.
+	Subject SubjectExtractor
+	// Emitter runs subject extraction and event construction. It is
+	// required; the caller owns it and closes it once the server has
+	// stopped.
+	Emitter *Emitter
+	// EventType is the type of the emitted events. It defaults to "api.request".
+	EventType string
+	// Source is the source of the emitted events. It defaults to "http".
+	Source string
+	// Route returns the route a request matched, used instead of its path so
+	// that events group well. It defaults to the URL path.
+	Route func(r *http.Request) string
+	// Data, if set, returns the event data for a request instead of the
+	// default route, method, status code, latency and response size.
+	Data func(r *http.Request, info RequestInfo) map[string]any
+	// Skip, if set, reports requests that should not be metered.
+	Skip func(r *http.Request) bool
+	// OnError, if set, is called when no event could be emitted for a request.
+	OnError func(r *http.Request, err error)
+}
+
+// HTTPMetering returns middleware that emits a Meterus event for every request
+// once its handler has returned. Subject extraction and event construction run
+// on the emitter in the background, so request latency is unaffected even
+// when the subject has to be looked up remotely. Requests that find the
+// emitter queue full are not metered and are reported with ErrEmitterFull. It
+// panics if cfg lacks a required field.
+func HTTPMetering(cfg HTTPMeteringConfig) func(http.Handler) http.Handler {
+	switch {
+	case cfg.Ingester == nil:
+		panic("middleware: HTTPMeteringConfig.Ingester is required")
+	case cfg.Subject == nil:
+		panic("middleware: HTTPMeteringConfig.Subject is required")
+	case cfg.Emitter == nil:
+		panic("middleware: HTTPMeteringConfig.Emitter is required")
+	}
+	if cfg.EventType == "" {
+		cfg.EventType = "api.request"
+	}
+	if cfg.Source == "" {
+		cfg.Source = "http"
+	}
+	if cfg.Route == nil {
+		cfg.Route = func(r *http.Request) string { return r.URL.Path }
+	}
+	if cfg.Data == nil {
+		cfg.Data = defaultData
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if cfg.Skip != nil && cfg.Skip(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			start := time.Now()
+			rw := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rw, r)
+
+			info := RequestInfo{
+				Route:         cfg.Route(r),
+				Method:        r.Method,
+				StatusCode:    rw.status,
+				Latency:       time.Since(start),
+				ResponseBytes: rw.bytes,
+			}
+			// The request must not be used once ServeHTTP returns, so the
+			// background work gets a copy detached from its cancellation.
+			rc := r.Clone(context.WithoutCancel(r.Context()))
+			if !cfg.Emitter.submit(func() { emit(cfg, rc, start, info) }) {
+				reportError(cfg, r, ErrEmitterFull)
+			}
+		})
+	}
+}
+
+func emit(cfg HTTPMeteringConfig, r *http.Request, start time.Time, info RequestInfo) {
+	subject, err := cfg.Subject(r)
+	if err != nil {
+		reportError(cfg, r, err)
+		return
+	}
+	event, err := client.NewCloudEvent("", cfg.Source, "1.0", cfg.EventType, start, subject, cfg.Data(r, info))
+	if err != nil {
+		reportError(cfg, r, err)
+		return
+	}
+	if !cfg.Ingester.Enqueue(event) {
+		reportError(cfg, r, ErrEventDropped)
+	}
+}
+
+func reportError(cfg HTTPMeteringConfig, r *http.Request, err error) {
+	if cfg.OnError != nil {
+		cfg.OnError(r, err)
+	}
+}
+
+func defaultData(_ *http.Request, info RequestInfo) map[string]any {
+	return map[string]any{
+		"route":          info.Route,
+		"method":         info.Method,
+		"status_code":    info.StatusCode,
+		"latency_ms":     float64(info.Latency.Microseconds()) / 1000,
+		"response_bytes": info.ResponseBytes,
+	}
+}
+
+// responseRecorder captures the status code and size of a response.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (rw *responseRecorder) WriteHeader(code int) {
+	if !rw.wroteHeader {
+		rw.status = code
+		rw.wroteHeader = true
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *responseRecorder) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rw *responseRecorder) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+func (rw *responseRecorder) Flush() {
+	rw.wroteHeader = true
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets handlers take over the connection, such as for websockets. The
+// request is metered with status 101 Switching Protocols.
+func (rw *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("middleware: %T does not support hijacking", rw.ResponseWriter)
+	}
+	conn, buf, err := h.Hijack()
+	if err == nil && !rw.wroteHeader {
+		rw.status = http.StatusSwitchingProtocols
+		rw.wroteHeader = true
+	}
+	return conn, buf, err
+}
@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/elliot14A/meterus-go/client"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+)
+
+// Validator validates Meterus API keys. It is implemented by
+// *client.ValidationService and *client.CachingValidator.
+type Validator interface {
+	ValidateApiKey(ctx context.Context, apiKey string, scopes []string) (*client.ValidationResult, error)
+}
+
+type validationKey struct{}
+
+// WithValidation returns a copy of ctx carrying the validation result of the
+// API key a request was authenticated with.
+func WithValidation(ctx context.Context, res *client.ValidationResult) context.Context {
+	return context.WithValue(ctx, validationKey{}, res)
+}
+
+// ValidationFromContext returns the validation result stored in ctx by the
+// authentication middleware.
+func ValidationFromContext(ctx context.Context) (*client.ValidationResult, bool) {
+	res, ok := ctx.Value(validationKey{}).(*client.ValidationResult)
+	return res, ok
+}
+
+// SubjectFromContext returns the subject of the API key a request was
+// authenticated with.
+func SubjectFromContext(ctx context.Context) (string, bool) {
+	res, ok := ValidationFromContext(ctx)
+	if !ok || res.Subject == "" {
+		return "", false
+	}
+	return res.Subject, true
+}
+
+// AttributesFromContext returns the additional attributes of the API key a
+// request was authenticated with.
+func AttributesFromContext(ctx context.Context) (*structpb.Struct, bool) {
+	res, ok := ValidationFromContext(ctx)
+	if !ok || res.Attributes == nil {
+		return nil, false
+	}
+	return res.Attributes, true
+}
+
+// SubjectFromAuth extracts the subject stored by HTTPAuth, for metering
+// requests that have already been authenticated.
+func SubjectFromAuth() SubjectExtractor {
+	return func(r *http.Request) (string, error) {
+		subject, ok := SubjectFromContext(r.Context())
+		if !ok {
+			return "", ErrNoSubject
+		}
+		return subject, nil
+	}
+}
+
+// HTTPAuthConfig configures the HTTP authentication middleware.
+type HTTPAuthConfig struct {
+	// Validator validates the API keys. It is required.
+	Validator Validator
+	// Scopes are the scopes required for every request.
+	Scopes []string
+	// RouteScopes, if set, returns further scopes required for a request,
+	// typically looked up by its route.
+	RouteScopes func(r *http.Request) []string
+	// OnError, if set, is called when a key could not be validated for a
+	// reason other than the key itself.
+	OnError func(r *http.Request, err error)
+}
+
+// HTTPAuth returns middleware that authenticates requests with the Meterus API
+// key in their Bearer Authorization header. Requests without a valid key are
+// rejected with 401, keys lacking the required scopes with 403, and a JSON
+// error body. Authenticated requests carry the validation result in their
+// context, see ValidationFromContext.
+func HTTPAuth(cfg HTTPAuthConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			apiKey, ok := BearerToken(r)
+			if !ok {
+				writeAuthError(w, http.StatusUnauthorized, "missing bearer token", nil)
+				return
+			}
+
+			scopes := cfg.Scopes
+			if cfg.RouteScopes != nil {
+				scopes = append(slices.Clip(scopes), cfg.RouteScopes(r)...)
+			}
+
+			res, err := cfg.Validator.ValidateApiKey(r.Context(), apiKey, scopes)
+			switch {
+			case errors.Is(err, client.ErrMissingScopes):
+				var missing []string
+				if res != nil {
+					missing = res.MissingScopes
+				}
+				writeAuthError(w, http.StatusForbidden, "api key is missing required scopes", missing)
+				return
+			case err != nil:
+				if cfg.OnError != nil {
+					cfg.OnError(r, err)
+				}
+				writeAuthError(w, http.StatusServiceUnavailable, "api key could not be validated", nil)
+				return
+			case res == nil || !res.Valid:
+				writeAuthError(w, http.StatusUnauthorized, "invalid api key", nil)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithValidation(r.Context(), res)))
+		})
+	}
+}
+
+type authError struct {
+	Error         string   `json:"error"`
+	Message       string   `json:"message"`
+	MissingScopes []string `json:"missing_scopes,omitempty"`
+}
+
+func writeAuthError(w http.ResponseWriter, code int, message string, missingScopes []string) {
+	if code == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="meterus"`)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(authError{
+		Error:         http.StatusText(code),
+		Message:       message,
+		MissingScopes: missingScopes,
+	})
+}
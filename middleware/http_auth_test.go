@@ -0,0 +1,108 @@
+package middleware_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/elliot14A/meterus-go/client"
+	"github.com/elliot14A/meterus-go/meterustest"
+	"github.com/elliot14A/meterus-go/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// authValidator returns a fake accepting "reader", granted meters:read, and
+// failing to validate "broken".
+func authValidator() *meterustest.FakeValidation {
+	return &meterustest.FakeValidation{
+		ValidateApiKeyFunc: func(_ context.Context, apiKey string, scopes []string) (*client.ValidationResult, error) {
+			switch apiKey {
+			case "reader":
+				res := &client.ValidationResult{Valid: true, Subject: "acme", Scopes: []string{"meters:read"}}
+				for _, s := range scopes {
+					if s != "meters:read" {
+						res.Valid = false
+						res.MissingScopes = append(res.MissingScopes, s)
+					}
+				}
+				if !res.Valid {
+					return res, client.ErrMissingScopes
+				}
+				return res, nil
+			case "broken":
+				return nil, errors.New("meterus is down")
+			}
+			return &client.ValidationResult{}, nil
+		},
+	}
+}
+
+func TestHTTPAuth(t *testing.T) {
+	keys := authValidator()
+	var errs errorLog
+	scopes := make([]string, 1, 4)
+	scopes[0] = "meters:read"
+	auth := middleware.HTTPAuth(middleware.HTTPAuthConfig{
+		Validator: keys,
+		Scopes:    scopes,
+		RouteScopes: func(r *http.Request) []string {
+			if r.Method == "POST" {
+				return []string{"meters:write"}
+			}
+			return nil
+		},
+		OnError: func(_ *http.Request, err error) { errs.add(err) },
+	})
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res, ok := middleware.ValidationFromContext(r.Context())
+		require.True(t, ok)
+		subject, _ := middleware.SubjectFromContext(r.Context())
+		assert.Equal(t, res.Subject, subject)
+		w.Write([]byte(subject))
+	}))
+
+	serve := func(method, authorization string) (*httptest.ResponseRecorder, map[string]any) {
+		req := httptest.NewRequest(method, "/meters", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		var body map[string]any
+		if rec.Code != http.StatusOK {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		}
+		return rec, body
+	}
+
+	rec, _ := serve("GET", "Bearer reader")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "acme", rec.Body.String())
+
+	rec, body := serve("GET", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, `Bearer realm="meterus"`, rec.Header().Get("WWW-Authenticate"))
+	assert.Equal(t, "missing bearer token", body["message"])
+
+	rec, body = serve("GET", "Bearer unknown")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "invalid api key", body["message"])
+
+	rec, body = serve("POST", "Bearer reader")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Equal(t, []any{"meters:write"}, body["missing_scopes"])
+
+	rec, _ = serve("GET", "Bearer broken")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Len(t, errs.errs, 1, "validation failures are reported")
+
+	calls := keys.CallsTo("ValidateApiKey")
+	require.Len(t, calls, 4)
+	assert.Equal(t, []string{"meters:read"}, calls[0].Args[1])
+	assert.Equal(t, []string{"meters:read", "meters:write"}, calls[2].Args[1])
+	assert.Empty(t, scopes[:cap(scopes)][1], "route scopes must not be written into the spare capacity of Scopes")
+}
@@ -0,0 +1,215 @@
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/elliot14A/meterus-go/client"
+	"github.com/elliot14A/meterus-go/meterustest"
+	"github.com/elliot14A/meterus-go/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPMeteringEmitsEveryStatus(t *testing.T) {
+	backend, _ := newServer(t)
+	ingester := newClient(t, backend).NewMeteringService().NewIngester()
+	emitter := middleware.NewEmitter(16, 1)
+	var errs errorLog
+	metered := middleware.HTTPMetering(middleware.HTTPMeteringConfig{
+		Ingester:  ingester,
+		Emitter:   emitter,
+		Subject:   middleware.SubjectFromHeader("X-Customer"),
+		Route:     func(*http.Request) string { return "/items/{id}" },
+		Skip:      func(r *http.Request) bool { return r.URL.Path == "/healthz" },
+		OnError:   func(_ *http.Request, err error) { errs.add(err) },
+		EventType: "test.request",
+	})
+	handler := metered(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/items/missing":
+			http.NotFound(w, r)
+		case "/items/broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.Write([]byte("hello"))
+		}
+	}))
+
+	for _, path := range []string{"/items/1", "/items/missing", "/items/broken", "/healthz"} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("X-Customer", "acme")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/items/2", nil))
+	emitter.Close()
+	require.NoError(t, ingester.Close(context.Background()))
+
+	events := backend.Events()
+	require.Len(t, events, 3, "failed requests are metered, skipped ones are not")
+	var codes []float64
+	bytes := make(map[float64]float64)
+	for _, e := range events {
+		assert.Equal(t, "acme", e.Subject)
+		assert.Equal(t, "test.request", e.Type)
+		assert.Equal(t, "http", e.Source)
+		data := eventData(e)
+		assert.Equal(t, "/items/{id}", data["route"])
+		assert.Equal(t, "GET", data["method"])
+		codes = append(codes, data["status_code"].(float64))
+		bytes[data["status_code"].(float64)] = data["response_bytes"].(float64)
+	}
+	assert.ElementsMatch(t, []float64{200, 404, 500}, codes)
+	assert.Equal(t, float64(len("hello")), bytes[200])
+	assert.Equal(t, 1, errs.count(middleware.ErrNoSubject), "a request without subject is reported")
+}
+
+func TestHTTPMeteringReportsFullEmitter(t *testing.T) {
+	backend, _ := newServer(t)
+	ingester := newClient(t, backend).NewMeteringService().NewIngester()
+	emitter := middleware.NewEmitter(1, 1)
+	release := make(chan struct{})
+	var errs errorLog
+	handler := middleware.HTTPMetering(middleware.HTTPMeteringConfig{
+		Ingester: ingester,
+		Emitter:  emitter,
+		Subject: func(*http.Request) (string, error) {
+			<-release
+			return "acme", nil
+		},
+		OnError: func(_ *http.Request, err error) { errs.add(err) },
+	})(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	for i := 0; i < 5; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}
+	close(release)
+	emitter.Close()
+	assert.GreaterOrEqual(t, errs.count(middleware.ErrEmitterFull), 3, "one job runs and one waits, the others are dropped")
+	assert.Equal(t, uint64(errs.count(middleware.ErrEmitterFull)), emitter.Dropped())
+}
+
+func TestHTTPMeteringReportsFullIngester(t *testing.T) {
+	backend, faults := newServer(t)
+	faults.Add(meterustest.FaultRule{Method: "Ingest", Latency: 200 * time.Millisecond})
+	ingester := newClient(t, backend).NewMeteringService().NewIngester(client.WithQueueSize(1), client.WithWorkers(1))
+	emitter := middleware.NewEmitter(16, 1)
+	var errs errorLog
+	handler := middleware.HTTPMetering(middleware.HTTPMeteringConfig{
+		Ingester: ingester,
+		Emitter:  emitter,
+		Subject:  middleware.SubjectFromHeader("X-Customer"),
+		OnError:  func(_ *http.Request, err error) { errs.add(err) },
+	})(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	for i := 0; i < 5; i++ {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-Customer", "acme")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	emitter.Close()
+	require.NoError(t, ingester.Close(context.Background()))
+	_, _, dropped := ingester.Stats()
+	assert.GreaterOrEqual(t, errs.count(middleware.ErrEventDropped), 3)
+	assert.Equal(t, uint64(errs.count(middleware.ErrEventDropped)), dropped)
+}
+
+func TestSubjectFromAPIKey(t *testing.T) {
+	keys := &meterustest.FakeValidation{
+		ValidateApiKeyFunc: func(_ context.Context, apiKey string, _ []string) (*client.ValidationResult, error) {
+			if apiKey == "good" {
+				return &client.ValidationResult{Valid: true, Subject: "acme"}, nil
+			}
+			return &client.ValidationResult{}, nil
+		},
+	}
+	extract := middleware.SubjectFromAPIKey(keys)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer good")
+	subject, err := extract(req)
+	require.NoError(t, err)
+	assert.Equal(t, "acme", subject)
+
+	req.Header.Set("Authorization", "Bearer bad")
+	_, err = extract(req)
+	assert.ErrorIs(t, err, middleware.ErrNoSubject)
+
+	req.Header.Set("Authorization", "Basic Zm9vOmJhcg==")
+	_, err = extract(req)
+	assert.ErrorIs(t, err, middleware.ErrNoSubject)
+}
+
+func TestHTTPMeteringRequiresConfig(t *testing.T) {
+	backend, _ := newServer(t)
+	ingester := newClient(t, backend).NewMeteringService().NewIngester()
+	emitter := middleware.NewEmitter(16, 1)
+	defer emitter.Close()
+	subject := middleware.SubjectFromHeader("X-Customer")
+
+	assert.PanicsWithValue(t, "middleware: HTTPMeteringConfig.Ingester is required", func() {
+		middleware.HTTPMetering(middleware.HTTPMeteringConfig{Subject: subject, Emitter: emitter})
+	})
+	assert.PanicsWithValue(t, "middleware: HTTPMeteringConfig.Subject is required", func() {
+		middleware.HTTPMetering(middleware.HTTPMeteringConfig{Ingester: ingester, Emitter: emitter})
+	})
+	assert.PanicsWithValue(t, "middleware: HTTPMeteringConfig.Emitter is required", func() {
+		middleware.HTTPMetering(middleware.HTTPMeteringConfig{Ingester: ingester, Subject: subject})
+	})
+}
+
+func TestHTTPMeteringKeepsFlusherAndHijacker(t *testing.T) {
+	backend, _ := newServer(t)
+	ingester := newClient(t, backend).NewMeteringService().NewIngester()
+	emitter := middleware.NewEmitter(16, 1)
+	metered := middleware.HTTPMetering(middleware.HTTPMeteringConfig{
+		Ingester: ingester,
+		Emitter:  emitter,
+		Subject:  middleware.SubjectFromHeader("X-Customer"),
+	})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: hello\n\n"))
+		require.NoError(t, http.NewResponseController(w).Flush())
+	})
+	mux.HandleFunc("/socket", func(w http.ResponseWriter, r *http.Request) {
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		require.NoError(t, err)
+		defer conn.Close()
+		buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: test\r\nConnection: Upgrade\r\n\r\n")
+		buf.Flush()
+	})
+	server := httptest.NewServer(metered(mux))
+	defer server.Close()
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/events", nil)
+	req.Header.Set("X-Customer", "acme")
+	metered(mux).ServeHTTP(rec, req)
+	assert.True(t, rec.Flushed, "flushes must reach the underlying writer")
+
+	req, err := http.NewRequest("GET", server.URL+"/socket", nil)
+	require.NoError(t, err)
+	req.Header.Set("X-Customer", "acme")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "test")
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusSwitchingProtocols, res.StatusCode, "handlers must be able to hijack the connection")
+
+	// Hijacked requests are metered once their handler returns, which may
+	// be after the client got its response.
+	require.Eventually(t, func() bool { return len(backend.Events()) == 2 }, time.Second, time.Millisecond)
+	emitter.Close()
+	require.NoError(t, ingester.Close(context.Background()))
+	var codes []float64
+	for _, e := range backend.Events() {
+		codes = append(codes, eventData(e)["status_code"].(float64))
+	}
+	assert.ElementsMatch(t, []float64{200, 101}, codes)
+}
@@ -22,6 +22,10 @@ const _ = grpc.SupportPackageIsVersion9
 const (
 	ValidationService_ValidateApiKey_FullMethodName   = "/meterus.validation.v1.ValidationService/ValidateApiKey"
 	ValidationService_ValidateAndMeter_FullMethodName = "/meterus.validation.v1.ValidationService/ValidateAndMeter"
+	ValidationService_CreateApiKey_FullMethodName     = "/meterus.validation.v1.ValidationService/CreateApiKey"
+	ValidationService_ListApiKeys_FullMethodName      = "/meterus.validation.v1.ValidationService/ListApiKeys"
+	ValidationService_RevokeApiKey_FullMethodName     = "/meterus.validation.v1.ValidationService/RevokeApiKey"
+	ValidationService_RotateApiKey_FullMethodName     = "/meterus.validation.v1.ValidationService/RotateApiKey"
 )
 
 // ValidationServiceClient is the client API for ValidationService service.
@@ -29,7 +33,11 @@ const (
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type ValidationServiceClient interface {
 	ValidateApiKey(ctx context.Context, in *ValidateApiKeyRequest, opts ...grpc.CallOption) (*ValidateApiKeyResponse, error)
-	ValidateAndMeter(ctx context.Context, in *ValidateAndMeterRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	ValidateAndMeter(ctx context.Context, in *ValidateAndMeterRequest, opts ...grpc.CallOption) (*ValidateApiKeyResponse, error)
+	CreateApiKey(ctx context.Context, in *CreateApiKeyRequest, opts ...grpc.CallOption) (*CreateApiKeyResponse, error)
+	ListApiKeys(ctx context.Context, in *ListApiKeysRequest, opts ...grpc.CallOption) (*ListApiKeysResponse, error)
+	RevokeApiKey(ctx context.Context, in *ApiKeyId, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	RotateApiKey(ctx context.Context, in *RotateApiKeyRequest, opts ...grpc.CallOption) (*CreateApiKeyResponse, error)
 }
 
 type validationServiceClient struct {
@@ -50,9 +58,9 @@ func (c *validationServiceClient) ValidateApiKey(ctx context.Context, in *Valida
 	return out, nil
 }
 
-func (c *validationServiceClient) ValidateAndMeter(ctx context.Context, in *ValidateAndMeterRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+func (c *validationServiceClient) ValidateAndMeter(ctx context.Context, in *ValidateAndMeterRequest, opts ...grpc.CallOption) (*ValidateApiKeyResponse, error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
-	out := new(emptypb.Empty)
+	out := new(ValidateApiKeyResponse)
 	err := c.cc.Invoke(ctx, ValidationService_ValidateAndMeter_FullMethodName, in, out, cOpts...)
 	if err != nil {
 		return nil, err
@@ -60,12 +68,56 @@ func (c *validationServiceClient) ValidateAndMeter(ctx context.Context, in *Vali
 	return out, nil
 }
 
+func (c *validationServiceClient) CreateApiKey(ctx context.Context, in *CreateApiKeyRequest, opts ...grpc.CallOption) (*CreateApiKeyResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CreateApiKeyResponse)
+	err := c.cc.Invoke(ctx, ValidationService_CreateApiKey_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *validationServiceClient) ListApiKeys(ctx context.Context, in *ListApiKeysRequest, opts ...grpc.CallOption) (*ListApiKeysResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListApiKeysResponse)
+	err := c.cc.Invoke(ctx, ValidationService_ListApiKeys_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *validationServiceClient) RevokeApiKey(ctx context.Context, in *ApiKeyId, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, ValidationService_RevokeApiKey_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *validationServiceClient) RotateApiKey(ctx context.Context, in *RotateApiKeyRequest, opts ...grpc.CallOption) (*CreateApiKeyResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CreateApiKeyResponse)
+	err := c.cc.Invoke(ctx, ValidationService_RotateApiKey_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // ValidationServiceServer is the server API for ValidationService service.
 // All implementations must embed UnimplementedValidationServiceServer
 // for forward compatibility.
 type ValidationServiceServer interface {
 	ValidateApiKey(context.Context, *ValidateApiKeyRequest) (*ValidateApiKeyResponse, error)
-	ValidateAndMeter(context.Context, *ValidateAndMeterRequest) (*emptypb.Empty, error)
+	ValidateAndMeter(context.Context, *ValidateAndMeterRequest) (*ValidateApiKeyResponse, error)
+	CreateApiKey(context.Context, *CreateApiKeyRequest) (*CreateApiKeyResponse, error)
+	ListApiKeys(context.Context, *ListApiKeysRequest) (*ListApiKeysResponse, error)
+	RevokeApiKey(context.Context, *ApiKeyId) (*emptypb.Empty, error)
+	RotateApiKey(context.Context, *RotateApiKeyRequest) (*CreateApiKeyResponse, error)
 	mustEmbedUnimplementedValidationServiceServer()
 }
 
@@ -79,9 +131,21 @@ type UnimplementedValidationServiceServer struct{}
 func (UnimplementedValidationServiceServer) ValidateApiKey(context.Context, *ValidateApiKeyRequest) (*ValidateApiKeyResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method ValidateApiKey not implemented")
 }
-func (UnimplementedValidationServiceServer) ValidateAndMeter(context.Context, *ValidateAndMeterRequest) (*emptypb.Empty, error) {
+func (UnimplementedValidationServiceServer) ValidateAndMeter(context.Context, *ValidateAndMeterRequest) (*ValidateApiKeyResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method ValidateAndMeter not implemented")
 }
+func (UnimplementedValidationServiceServer) CreateApiKey(context.Context, *CreateApiKeyRequest) (*CreateApiKeyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateApiKey not implemented")
+}
+func (UnimplementedValidationServiceServer) ListApiKeys(context.Context, *ListApiKeysRequest) (*ListApiKeysResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListApiKeys not implemented")
+}
+func (UnimplementedValidationServiceServer) RevokeApiKey(context.Context, *ApiKeyId) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RevokeApiKey not implemented")
+}
+func (UnimplementedValidationServiceServer) RotateApiKey(context.Context, *RotateApiKeyRequest) (*CreateApiKeyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RotateApiKey not implemented")
+}
 func (UnimplementedValidationServiceServer) mustEmbedUnimplementedValidationServiceServer() {}
 func (UnimplementedValidationServiceServer) testEmbeddedByValue()                           {}
 
@@ -139,6 +203,78 @@ func _ValidationService_ValidateAndMeter_Handler(srv interface{}, ctx context.Co
 	return interceptor(ctx, in, info, handler)
 }
 
+func _ValidationService_CreateApiKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateApiKeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ValidationServiceServer).CreateApiKey(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ValidationService_CreateApiKey_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ValidationServiceServer).CreateApiKey(ctx, req.(*CreateApiKeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ValidationService_ListApiKeys_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListApiKeysRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ValidationServiceServer).ListApiKeys(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ValidationService_ListApiKeys_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ValidationServiceServer).ListApiKeys(ctx, req.(*ListApiKeysRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ValidationService_RevokeApiKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ApiKeyId)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ValidationServiceServer).RevokeApiKey(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ValidationService_RevokeApiKey_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ValidationServiceServer).RevokeApiKey(ctx, req.(*ApiKeyId))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ValidationService_RotateApiKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RotateApiKeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ValidationServiceServer).RotateApiKey(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ValidationService_RotateApiKey_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ValidationServiceServer).RotateApiKey(ctx, req.(*RotateApiKeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // ValidationService_ServiceDesc is the grpc.ServiceDesc for ValidationService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -154,6 +290,22 @@ var ValidationService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "ValidateAndMeter",
 			Handler:    _ValidationService_ValidateAndMeter_Handler,
 		},
+		{
+			MethodName: "CreateApiKey",
+			Handler:    _ValidationService_CreateApiKey_Handler,
+		},
+		{
+			MethodName: "ListApiKeys",
+			Handler:    _ValidationService_ListApiKeys_Handler,
+		},
+		{
+			MethodName: "RevokeApiKey",
+			Handler:    _ValidationService_RevokeApiKey_Handler,
+		},
+		{
+			MethodName: "RotateApiKey",
+			Handler:    _ValidationService_RotateApiKey_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/validation.proto",